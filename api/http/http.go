@@ -55,6 +55,9 @@ func NewHTTPServer(config *configs.Config, us *service.Service) (*fiber.App, err
 	r := app.Group("")
 	v1.InitAccountRouter(r, us.Account, config)
 	v1.InitCharacterRouter(r, us.Character, config)
+	v1.InitConversationRouter(r, us.Character, config)
+	v1.InitCollectionRouter(r, us.Character, config)
+	v1.InitCreatorRouter(r, us.Character, config)
 	v1.InitFileRouter(r, config)
 	zap.S().Infof("addr:%s", config.HTTP.Addr)
 	return app, nil
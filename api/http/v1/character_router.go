@@ -6,7 +6,10 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"mime/multipart"
 	"net/http"
+	"os"
 	"path/filepath"
 	"starland-backend/configs"
 	"starland-backend/internal/pkg/middlewares"
@@ -20,7 +23,9 @@ import (
 	"github.com/valyala/fasthttp"
 
 	"github.com/gofiber/adaptor/v2"
+	"github.com/gofiber/contrib/websocket"
 	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
 	"go.uber.org/zap"
 )
 
@@ -54,6 +59,10 @@ type CharacterHTTPServer interface {
 	CharacterLike(context.Context, string, string, bool) error
 	Chat(context.Context, *character.ChatRequest) (*character.ChatResponse, error)
 	QueryCharacters(context.Context, *character.QueryCharacterRequest) ([]*character.QueryCharacterResponse, int64, error)
+	SearchCharacters(context.Context, *character.SearchCharactersRequest) ([]*character.QueryCharacterResponse, int64, error)
+	RecommendCharacters(context.Context, *character.RecommendCharactersRequest) ([]*character.QueryCharacterResponse, error)
+	QueryLikedCharacters(context.Context, *character.QueryLikedCharactersRequest) ([]*character.QueryCharacterResponse, int64, error)
+	QueryTags(context.Context, *character.QueryTagsRequest) ([]*character.TagCategoryResponse, error)
 	QueryCharacterInfo(context.Context, string) (*character.QueryCharacterResponse, error)
 	CharacterMint(context.Context, *character.CharacterMintRequest) error
 	QueryCharactersHistory(ctx context.Context, req *character.QueryCharactersHistoryRequest) ([]*character.QueryCharactersHistoryResponse,
@@ -63,28 +72,66 @@ type CharacterHTTPServer interface {
 	MessageToVoice(context.Context, string, string) (string, error)
 	QueryVoice(ctx context.Context) ([]*character.CharacterVoiceResponse, error)
 	UpdateCharacter(context.Context, *character.UpdateCharacterRequest) error
+	CreateManualCharacter(context.Context, *character.CreateManualCharacterRequest) (*character.CharacterResponse, error)
+	ForkCharacter(context.Context, *character.ForkCharacterRequest) (*character.CreationSessionResponse, error)
+	QueryRevisions(context.Context, *character.QueryRevisionsRequest) ([]*character.RevisionResponse, int64, error)
+	DiffRevisions(context.Context, *character.DiffRevisionsRequest) (*character.RevisionDiffResponse, error)
+	RollbackRevision(context.Context, *character.RevisionRequest) (*character.RevisionResponse, error)
+	ExportCharacterCard(context.Context, *character.ExportCharacterCardRequest) (*character.ExportCharacterCardResponse, error)
+	ImportCharacterCard(context.Context, *character.ImportCharacterCardRequest) (*character.CharacterResponse, error)
 	DeleteCharacter(context.Context, *character.DeleteCharacterRequest) error
+	SaveChatMessage(context.Context, *character.SaveChatMessageRequest) error
+	QueryChatMessages(context.Context, *character.QueryChatMessagesRequest) ([]*character.ChatMessageResponse, int64, error)
+	StreamReply(context.Context, *character.StreamReplyRequest) error
+	CancelSession(context.Context, *character.CancelSessionRequest) error
+	QueryCreationSession(context.Context, *character.QueryCreationSessionRequest) (*character.CreationSessionResponse, error)
+	QueryDrafts(context.Context, *character.QueryDraftsRequest) ([]*character.DraftResponse, int64, error)
+	ResumeDraft(context.Context, *character.DraftRequest) (*character.CreationSessionResponse, error)
+	DiscardDraft(context.Context, *character.DraftRequest) error
+	CancelReply(context.Context, *character.CancelReplyRequest) error
+	QueryMemories(context.Context, *character.QueryMemoriesRequest) ([]*character.MemoryResponse, error)
+	DeleteMemory(context.Context, *character.DeleteMemoryRequest) error
+	DeleteMemories(context.Context, *character.DeleteMemoriesRequest) error
 }
 
 func InitCharacterRouter(app fiber.Router, service CharacterHTTPServer, conf *configs.Config) {
 	router := app.Group("/v1")
 	q = make(chan struct{}, conf.Chat.ChatLimit)
 
+	router.Get("/tags", queryTags(service))
 	router.Get("/character/image_model", queryImageModels(service))
 	router.Get("/character/voice", queryVoice(service))
 
 	router.Get("/character", middlewares.JwtParse(), queryCharacter(service))
 	router.Get("/character/my", middlewares.JwtParse(), queryMyCharacter(service))
+	router.Get("/character/search", middlewares.JwtParse(), searchCharacters(service))
+	router.Get("/character/recommended", middlewares.JwtParse(), recommendCharacters(service))
+	router.Get("/character/liked", middlewares.JwtParse(), queryLikedCharacters(service))
+	router.Get("/character/drafts", middlewares.JwtParse(), queryDrafts(service))
+	router.Post("/character/drafts/:id/resume", middlewares.JwtParse(), resumeDraft(service))
+	router.Delete("/character/drafts/:id", middlewares.JwtParse(), discardDraft(service))
 	router.Post("/character", middlewares.JwtParse(), func(ctx *fiber.Ctx) error {
 		CreateCountMetric.WithLabelValues("count").Inc()
 		return ctx.Next()
 	}, createV2(service))
 
+	router.Get("/character/sessions/:id", middlewares.JwtParse(), querySession(service))
+	router.Post("/character/manual", middlewares.JwtParse(), func(ctx *fiber.Ctx) error {
+		CreateCountMetric.WithLabelValues("count").Inc()
+		return ctx.Next()
+	}, createManual(service))
+	router.Post("/character/import", middlewares.JwtParse(), func(ctx *fiber.Ctx) error {
+		CreateCountMetric.WithLabelValues("count").Inc()
+		return ctx.Next()
+	}, importCard(service))
+	router.Post("/character/sessions/:id/cancel", middlewares.JwtParse(), cancelSession(service))
+
 	router.Put("/character/:id", middlewares.JwtParse(), updateCharacter(service))
 
 	router.Get("/character/history", middlewares.JwtParse(), history(service))
 	router.Post("/character/:id/like", middlewares.JwtParse(), like(service))
 	router.Post("/character/:id/mint", middlewares.JwtParse(), mint(service))
+	router.Post("/character/:id/fork", middlewares.JwtParse(), fork(service))
 	router.Delete("/character/:id", middlewares.JwtParse(), deleteCharacter(service))
 	/* router.Post("/character/:id/chat", middlewares.JwtParse(), func(ctx *fiber.Ctx) error {
 		ChatCountMetric.WithLabelValues("count").Inc()
@@ -94,6 +141,18 @@ func InitCharacterRouter(app fiber.Router, service CharacterHTTPServer, conf *co
 		ChatCountMetric.WithLabelValues("count").Inc()
 		return ctx.Next()
 	}, ChatV2(service))
+	router.Get("/character/:id/card", exportCard(service))
+	router.Get("/character/:id/revisions", middlewares.JwtParse(), revisions(service))
+	router.Get("/character/:id/revisions/:version/diff", middlewares.JwtParse(), diffRevisions(service))
+	router.Post("/character/:id/revisions/:version/rollback", middlewares.JwtParse(), rollbackRevision(service))
+	router.Get("/character/:id/messages", middlewares.JwtParse(), messages(service))
+	router.Get("/character/:id/memories", middlewares.JwtParse(), memories(service))
+	router.Delete("/character/:id/memories", middlewares.JwtParse(), deleteMemories(service))
+	router.Delete("/character/:id/memories/:memory_id", middlewares.JwtParse(), deleteMemory(service))
+	router.Get("/character/:id/ws", wsUpgrade, middlewares.JwtParse(), func(ctx *fiber.Ctx) error {
+		ChatCountMetric.WithLabelValues("count").Inc()
+		return ctx.Next()
+	}, websocket.New(chatWS(service)))
 
 	router.Get("/character/:id", middlewares.JwtParse(), info(service))
 	router.Get("/stream", adaptor.HTTPHandlerFunc(stream()))
@@ -145,6 +204,11 @@ func createV2(service CharacterHTTPServer) func(ctx *fiber.Ctx) error {
 				SessionID string `json:"session_id"` 
 				State     int    `json:"state"`      
 				Is3D      bool   `json:"is_3d"`
+				// Visibility, Greeting and ExampleDialogues are read when the
+				// character is finished.
+				Visibility       int      `json:"visibility"`
+				Greeting         string   `json:"greeting"`
+				ExampleDialogues []string `json:"example_dialogues"`
 			}
 		)
 		accountID := ctx.Locals(middlewares.LocalsAccount).(string)
@@ -163,6 +227,7 @@ func createV2(service CharacterHTTPServer) func(ctx *fiber.Ctx) error {
 			return ctx.Status(http.StatusBadRequest).JSON(util.MakeResponseWithMsg(err.Error()))
 		}
 
+		streamCtx, cancel := context.WithCancel(context.Background())
 		resCh := make(chan character.ChatCompletionStreamResponseChunk)
 		errCh := make(chan error)
 		go func() {
@@ -174,6 +239,11 @@ func createV2(service CharacterHTTPServer) func(ctx *fiber.Ctx) error {
 				ResCh:     resCh,
 				Is3D:      req.Is3D,
 				AccountID: accountID,
+				StreamCtx: streamCtx,
+				// set when the character is finished.
+				Visibility:       req.Visibility,
+				Greeting:         req.Greeting,
+				ExampleDialogues: req.ExampleDialogues,
 			})
 			if err != nil {
 				zap.S().Errorf("createV2: create err: %v", err)
@@ -189,54 +259,211 @@ func createV2(service CharacterHTTPServer) func(ctx *fiber.Ctx) error {
 		ctx.Set("X-Accel-Buffering", "no")
 		ctx.Set("Cache-Control", "no-cache")
 		ctx.Context().SetBodyStreamWriter(fasthttp.StreamWriter(func(w *bufio.Writer) {
-			zap.S().Info("WRITER")
+			// a client gone mid-stream cancels the agent stream
+			defer cancel()
 			var (
-				i    int
+				sse  = newSSEWriter(w)
 				data character.ChatCompletionStreamResponseChunk
-				h    string
 			)
-			for {
-				i++
-				if resMessage, ok := <-resCh; ok {
+			for resCh != nil {
+				select {
+				case resMessage, ok := <-resCh:
+					if !ok {
+						resCh = nil
+						break
+					}
 					if req.SessionID == "" {
 						resMessage.Message = resMessage.SessionID
 					}
-					if resMessage.Message == "" || h == resMessage.Message {
+					data = resMessage
+					event, eventData := createChunkEvent(resMessage)
+					if event == "" {
 						continue
 					}
-
-					m := strings.ReplaceAll(resMessage.Message, "\n", "\\n")
-					h = resMessage.Message
-					msg := fmt.Sprintf("data: %s\n\n", m)
-					fmt.Fprint(w, msg)
-					err := w.Flush()
-					if err != nil {
-						fmt.Printf("Error while flushing: %v. Closing http connection.\n", err)
+					if err := sse.Write(event, eventData); err != nil {
+						zap.S().Errorf("createV2: write %s err: %v", event, err)
 						return
 					}
-					data = resMessage
 					time.Sleep(time.Millisecond * 50)
-				} else {
-					zap.S().Infof("%+v", data)
-
-					jsonData, err := json.Marshal(util.MakeResponse(data))
-					if err != nil {
-						zap.S().Errorf("resMessage: %v", err)
+				case err, ok := <-errCh:
+					if !ok {
+						errCh = nil
+						break
 					}
-					fmt.Fprintf(w, "data: %s\n\n", string(jsonData))
-					err = w.Flush()
-					if err != nil {
-						fmt.Printf("Error while flushing: %v. Closing http connection.\n", err)
-						return
+					if err = sse.WriteError(err); err != nil {
+						zap.S().Errorf("createV2: write error err: %v", err)
 					}
 					return
 				}
 			}
+
+			if err, ok := <-errCh; ok {
+				if err = sse.WriteError(err); err != nil {
+					zap.S().Errorf("createV2: write error err: %v", err)
+				}
+				return
+			}
+			zap.S().Infof("%+v", data)
+			if err := sse.Write(SSEEventDone, data); err != nil {
+				zap.S().Errorf("createV2: write done err: %v", err)
+			}
 		}))
 		return nil
 	}
 }
 
+// createChunkEvent maps a creation chunk to its stream event. Chunks without
+// a type only update the state reported by the done event.
+func createChunkEvent(chunk character.ChatCompletionStreamResponseChunk) (string, interface{}) {
+	switch chunk.ChunkType {
+	case character.ChunkTypeChat:
+		if chunk.Message == "" {
+			return "", nil
+		}
+		return SSEEventToken, &character.ReplyTokenData{Content: chunk.Message}
+	case character.ChunkTypeImage:
+		return SSEEventImage, &SSEImageData{
+			Images: chunk.ImageMeta,
+			Is3D:   chunk.Is3D,
+			ObjURL: chunk.ObjURL,
+		}
+	case character.ChunkTypeNeedConfirm:
+		return SSEEventNeedConfirm, &SSENeedConfirmData{
+			NeedConfirm: chunk.NeedConfirm,
+			ConfirmType: chunk.ConfirmType,
+		}
+	case character.ChunkTypeSetting:
+		return SSEEventSetting, settingData(chunk.SettingChunk)
+	}
+	if chunk.NeedConfirmChunk {
+		return SSEEventNeedConfirm, &SSENeedConfirmData{NeedConfirm: true}
+	}
+	return "", nil
+}
+
+func queryDrafts(service CharacterHTTPServer) func(ctx *fiber.Ctx) error {
+	return func(ctx *fiber.Ctx) error {
+		var (
+			req struct {
+				Page  int `query:"page"`
+				Limit int `query:"limit"`
+			}
+			res struct {
+				Data  []*character.DraftResponse `json:"data"`
+				Count int64                      `json:"count"`
+			}
+		)
+		if err := ctx.QueryParser(&req); err != nil {
+			return ctx.Status(http.StatusBadRequest).JSON(util.MakeResponseWithMsg(err.Error()))
+		}
+
+		accountID := ctx.Locals(middlewares.LocalsAccount).(string)
+		data, count, err := service.QueryDrafts(ctx.Context(), &character.QueryDraftsRequest{
+			AccountID: accountID,
+			Page:      req.Page,
+			Limit:     req.Limit,
+		})
+		if err != nil {
+			return ctx.Status(http.StatusInternalServerError).JSON(util.MakeErrResponse(err))
+		}
+		res.Data = data
+		res.Count = count
+		return ctx.Status(http.StatusOK).JSON(util.MakeResponse(res))
+	}
+}
+
+func resumeDraft(service CharacterHTTPServer) func(ctx *fiber.Ctx) error {
+	return func(ctx *fiber.Ctx) error {
+		var (
+			req struct {
+				ID string `params:"id"`
+			}
+		)
+		if err := ctx.ParamsParser(&req); err != nil {
+			return ctx.Status(http.StatusBadRequest).JSON(util.MakeResponseWithMsg(err.Error()))
+		}
+
+		accountID := ctx.Locals(middlewares.LocalsAccount).(string)
+		res, err := service.ResumeDraft(ctx.Context(), &character.DraftRequest{
+			ID:        req.ID,
+			AccountID: accountID,
+		})
+		if err != nil {
+			return ctx.Status(http.StatusInternalServerError).JSON(util.MakeErrResponse(err))
+		}
+		return ctx.Status(http.StatusOK).JSON(util.MakeResponse(res))
+	}
+}
+
+func discardDraft(service CharacterHTTPServer) func(ctx *fiber.Ctx) error {
+	return func(ctx *fiber.Ctx) error {
+		var (
+			req struct {
+				ID string `params:"id"`
+			}
+		)
+		if err := ctx.ParamsParser(&req); err != nil {
+			return ctx.Status(http.StatusBadRequest).JSON(util.MakeResponseWithMsg(err.Error()))
+		}
+
+		accountID := ctx.Locals(middlewares.LocalsAccount).(string)
+		err := service.DiscardDraft(ctx.Context(), &character.DraftRequest{
+			ID:        req.ID,
+			AccountID: accountID,
+		})
+		if err != nil {
+			return ctx.Status(http.StatusInternalServerError).JSON(util.MakeErrResponse(err))
+		}
+		return ctx.Status(http.StatusOK).JSON(util.MakeResponse("ok"))
+	}
+}
+
+func querySession(service CharacterHTTPServer) func(ctx *fiber.Ctx) error {
+	return func(ctx *fiber.Ctx) error {
+		var (
+			req struct {
+				ID string `params:"id"`
+			}
+		)
+		if err := ctx.ParamsParser(&req); err != nil {
+			return ctx.Status(http.StatusBadRequest).JSON(util.MakeResponseWithMsg(err.Error()))
+		}
+
+		accountID := ctx.Locals(middlewares.LocalsAccount).(string)
+		res, err := service.QueryCreationSession(ctx.Context(), &character.QueryCreationSessionRequest{
+			AccountID: accountID,
+			SessionID: req.ID,
+		})
+		if err != nil {
+			return ctx.Status(http.StatusInternalServerError).JSON(util.MakeErrResponse(err))
+		}
+		return ctx.Status(http.StatusOK).JSON(util.MakeResponse(res))
+	}
+}
+
+func cancelSession(service CharacterHTTPServer) func(ctx *fiber.Ctx) error {
+	return func(ctx *fiber.Ctx) error {
+		var (
+			req struct {
+				ID string `params:"id"`
+			}
+		)
+		if err := ctx.ParamsParser(&req); err != nil {
+			return ctx.Status(http.StatusBadRequest).JSON(util.MakeResponseWithMsg(err.Error()))
+		}
+
+		accountID := ctx.Locals(middlewares.LocalsAccount).(string)
+		err := service.CancelSession(ctx.Context(), &character.CancelSessionRequest{
+			AccountID: accountID,
+			SessionID: req.ID,
+		})
+		if err != nil {
+			return ctx.Status(http.StatusInternalServerError).JSON(util.MakeErrResponse(err))
+		}
+		return ctx.Status(http.StatusOK).JSON(util.MakeResponse("ok"))
+	}
+}
+
 func queryImageModels(service CharacterHTTPServer) func(ctx *fiber.Ctx) error {
 	return func(ctx *fiber.Ctx) error {
 		res, err := service.QueryImageModel(ctx.Context())
@@ -281,6 +508,8 @@ func queryCharacter(service CharacterHTTPServer) func(ctx *fiber.Ctx) error {
 		var (
 			req struct {
 				Search string `query:"Search"`
+				Tag    string `query:"tag"`
+				Sort   string `query:"sort"`
 				Page   int    `query:"page"`
 				Limit  int    `query:"limit"`
 			}
@@ -294,11 +523,13 @@ func queryCharacter(service CharacterHTTPServer) func(ctx *fiber.Ctx) error {
 		}
 		characters, count, err := service.QueryCharacters(ctx.Context(), &character.QueryCharacterRequest{
 			Search: req.Search,
+			Tag:    strings.TrimSpace(req.Tag),
+			Sort:   req.Sort,
 			Page:   req.Page,
 			Limit:  req.Limit,
 		})
 		if err != nil {
-			return ctx.Status(http.StatusInternalServerError).JSON(util.MakeResponseWithMsg(err.Error()))
+			return ctx.Status(http.StatusInternalServerError).JSON(util.MakeErrResponse(err))
 		}
 		res.Data = characters
 		res.Count = count
@@ -346,40 +577,26 @@ func queryMyCharacter(service CharacterHTTPServer) func(ctx *fiber.Ctx) error {
 	}
 }
 
-func chat(service CharacterHTTPServer) func(ctx *fiber.Ctx) error {
+// queryTags lists the tag taxonomy, named in the locale of the lang query or
+// else of the first language the client accepts.
+func queryTags(service CharacterHTTPServer) func(ctx *fiber.Ctx) error {
 	return func(ctx *fiber.Ctx) error {
 		var (
 			req struct {
-				ID      string `params:"id"`
-				Message string `json:"Message"`
-			}
-
-			res struct {
-				ChatMessage []string `json:"chat_message"`
+				Lang string `query:"lang"`
 			}
 		)
-
-		accountID := ctx.Locals(middlewares.LocalsAccount).(string)
-		if err := ctx.ParamsParser(&req); err != nil {
+		if err := ctx.QueryParser(&req); err != nil {
 			return ctx.Status(http.StatusBadRequest).JSON(util.MakeResponseWithMsg(err.Error()))
 		}
-
-		if err := ctx.BodyParser(&req); err != nil {
-			return ctx.Status(http.StatusBadRequest).JSON(util.MakeResponseWithMsg(err.Error()))
+		if req.Lang == "" {
+			lang, _, _ := strings.Cut(ctx.Get(fiber.HeaderAcceptLanguage), ",")
+			req.Lang, _, _ = strings.Cut(strings.TrimSpace(lang), ";")
 		}
 
-		zap.S().Infof("chat: req: %+v", req)
-
-		r, err := service.Chat(ctx.Context(), &character.ChatRequest{
-			Message:     req.Message,
-			CharacterID: req.ID,
-			AccountID:   accountID,
+		res, err := service.QueryTags(ctx.Context(), &character.QueryTagsRequest{
+			Locale: strings.ToLower(req.Lang),
 		})
-		if r == nil {
-			res.ChatMessage = []string{}
-		} else {
-			res.ChatMessage = []string{r.Message}
-		}
 		if err != nil {
 			return ctx.Status(http.StatusInternalServerError).JSON(util.MakeErrResponse(err))
 		}
@@ -387,90 +604,63 @@ func chat(service CharacterHTTPServer) func(ctx *fiber.Ctx) error {
 	}
 }
 
-func ChatV2(service CharacterHTTPServer) func(ctx *fiber.Ctx) error {
+func searchCharacters(service CharacterHTTPServer) func(ctx *fiber.Ctx) error {
 	return func(ctx *fiber.Ctx) error {
 		var (
-			reqData struct {
-				ID      string `params:"id"`
-				Message string `json:"Message"`
+			req struct {
+				Query  string `query:"q"`
+				Gender int    `query:"gender"`
+				Is3D   string `query:"is_3d"`
+				Tag    string `query:"tag"`
+				Minted string `query:"minted"`
+				Sort   string `query:"sort"`
+				Page   int    `query:"page"`
+				Limit  int    `query:"limit"`
 			}
-
-			resData struct {
-				ChatMessage string `json:"chat_message"`
-				Voice       string `json:"voice"`
+			res struct {
+				Data  []*character.QueryCharacterResponse `json:"data"`
+				Count int64                               `json:"count"`
 			}
-			message string
+			accountID string
 		)
-
-		accountID := ctx.Locals(middlewares.LocalsAccount).(string)
-		if err := ctx.ParamsParser(&reqData); err != nil {
+		if err := ctx.QueryParser(&req); err != nil {
 			return ctx.Status(http.StatusBadRequest).JSON(util.MakeResponseWithMsg(err.Error()))
 		}
-		if err := ctx.BodyParser(&reqData); err != nil {
-			return ctx.Status(http.StatusBadRequest).JSON(util.MakeResponseWithMsg(err.Error()))
+		is3D, err := parseOptionalBool(req.Is3D)
+		if err != nil {
+			return ctx.Status(http.StatusBadRequest).JSON(util.MakeResponseWithMsg(fmt.Sprintf("is_3d: %s", err.Error())))
+		}
+		minted, err := parseOptionalBool(req.Minted)
+		if err != nil {
+			return ctx.Status(http.StatusBadRequest).JSON(util.MakeResponseWithMsg(fmt.Sprintf("minted: %s", err.Error())))
+		}
+		if account := ctx.Locals(middlewares.LocalsAccount); account != nil {
+			accountID = account.(string)
 		}
 
-		resCh := make(chan interface{})
-		err := service.ChatV2(ctx.Context(), &character.ChatRequestV2{
-			Message:     reqData.Message,
-			CharacterID: reqData.ID,
-			AccountID:   accountID,
-			ResCh:       resCh,
+		characters, count, err := service.SearchCharacters(ctx.Context(), &character.SearchCharactersRequest{
+			AccountID: accountID,
+			Query:     strings.TrimSpace(req.Query),
+			Gender:    req.Gender,
+			Is3D:      is3D,
+			Tag:       strings.TrimSpace(req.Tag),
+			Minted:    minted,
+			Sort:      req.Sort,
+			Page:      req.Page,
+			Limit:     req.Limit,
 		})
 		if err != nil {
 			return ctx.Status(http.StatusInternalServerError).JSON(util.MakeErrResponse(err))
 		}
-		ctx.Context().SetContentType("text/event-stream")
-		ctx.Set("Content-Type", "text/event-stream")
-		ctx.Set("Cache-Control", "no-cache")
-		ctx.Set("Connection", "keep-alive")
-		ctx.Set("Transfer-Encoding", "chunked")
-		ctx.Set("X-Accel-Buffering", "no")
-		ctx.Set("Cache-Control", "no-cache")
-		ctx.Context().SetBodyStreamWriter(fasthttp.StreamWriter(func(w *bufio.Writer) {
-			zap.S().Info("WRITER")
-			var (
-				i       int
-				content string
-			)
-			for {
-				i++
-				if resMessage, ok := <-resCh; ok {
-					message = resMessage.(string)
-					msg := strings.ReplaceAll(message, "\n", "\\n")
-
-					fmt.Fprintf(w, "data: %s\n\n", msg)
-					err = w.Flush()
-					if err != nil {
-						fmt.Printf("Error while flushing: %v. Closing http connection.\n", err)
-						return
-					}
-					content = fmt.Sprintf("%s%s", content, message)
-				} else {
-					zap.S().Infof("chat res: %s", content)
-					resData.ChatMessage = content
-					voice, err := service.MessageToVoice(context.Background(), reqData.ID, content)
-					if err != nil {
-						zap.S().Errorf("MessageToVoice: err: %v", err)
-						break
-					}
-					resData.Voice = voice
-					zap.S().Errorf("resData: %+v", resData)
-					res, err := json.Marshal(util.MakeResponse(resData))
-					if err != nil {
-						zap.S().Errorf("MessageToVoice: err: %v", err)
-						break
-					}
-					fmt.Fprintf(w, "data: %s\n\n", string(res))
-					break
-				}
-			}
-		}))
-		return nil
+		res.Data = characters
+		res.Count = count
+		return ctx.Status(http.StatusOK).JSON(util.MakeResponse(res))
 	}
 }
 
-func history(service CharacterHTTPServer) func(ctx *fiber.Ctx) error {
+// queryLikedCharacters lists the characters the account likes, the last
+// liked first.
+func queryLikedCharacters(service CharacterHTTPServer) func(ctx *fiber.Ctx) error {
 	return func(ctx *fiber.Ctx) error {
 		var (
 			req struct {
@@ -478,22 +668,22 @@ func history(service CharacterHTTPServer) func(ctx *fiber.Ctx) error {
 				Limit int `query:"limit"`
 			}
 			res struct {
-				Data  []*character.QueryCharactersHistoryResponse `json:"data"`
-				Count int64                                       `json:"count"`
+				Data  []*character.QueryCharacterResponse `json:"data"`
+				Count int64                               `json:"count"`
 			}
 		)
 		if err := ctx.QueryParser(&req); err != nil {
-			return ctx.Status(http.StatusInternalServerError).JSON(util.MakeResponseWithMsg(err.Error()))
+			return ctx.Status(http.StatusBadRequest).JSON(util.MakeResponseWithMsg(err.Error()))
 		}
 		accountID := ctx.Locals(middlewares.LocalsAccount).(string)
-		characters, count, err := service.QueryCharactersHistory(ctx.Context(), &character.QueryCharactersHistoryRequest{
-			Page:    req.Page,
-			Limit:   req.Limit,
-			Account: accountID,
-		})
 
+		characters, count, err := service.QueryLikedCharacters(ctx.Context(), &character.QueryLikedCharactersRequest{
+			AccountID: accountID,
+			Page:      req.Page,
+			Limit:     req.Limit,
+		})
 		if err != nil {
-			return ctx.Status(http.StatusInternalServerError).JSON(util.MakeResponseWithMsg(err.Error()))
+			return ctx.Status(http.StatusInternalServerError).JSON(util.MakeErrResponse(err))
 		}
 		res.Data = characters
 		res.Count = count
@@ -501,37 +691,413 @@ func history(service CharacterHTTPServer) func(ctx *fiber.Ctx) error {
 	}
 }
 
-func info(service CharacterHTTPServer) func(ctx *fiber.Ctx) error {
+func recommendCharacters(service CharacterHTTPServer) func(ctx *fiber.Ctx) error {
 	return func(ctx *fiber.Ctx) error {
 		var (
 			req struct {
-				ID string `params:"id"`
+				Limit int `query:"limit"`
 			}
 		)
-		if err := ctx.ParamsParser(&req); err != nil {
-			return ctx.Status(http.StatusInternalServerError).JSON(util.MakeResponseWithMsg(err.Error()))
+		if err := ctx.QueryParser(&req); err != nil {
+			return ctx.Status(http.StatusBadRequest).JSON(util.MakeResponseWithMsg(err.Error()))
 		}
+		accountID := ctx.Locals(middlewares.LocalsAccount).(string)
 
-		characters, err := service.QueryCharacterInfo(ctx.Context(), req.ID)
-
+		res, err := service.RecommendCharacters(ctx.Context(), &character.RecommendCharactersRequest{
+			AccountID: accountID,
+			Limit:     req.Limit,
+		})
 		if err != nil {
-			return ctx.Status(http.StatusInternalServerError).JSON(util.MakeResponseWithMsg(err.Error()))
+			return ctx.Status(http.StatusInternalServerError).JSON(util.MakeErrResponse(err))
 		}
-		return ctx.Status(http.StatusOK).JSON(util.MakeResponse(characters))
+		return ctx.Status(http.StatusOK).JSON(util.MakeResponse(res))
 	}
 }
 
-func mint(service CharacterHTTPServer) func(ctx *fiber.Ctx) error {
+// parseOptionalBool reads a boolean query value, nil when it is not set.
+func parseOptionalBool(value string) (*bool, error) {
+	if value == "" {
+		return nil, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+func chat(service CharacterHTTPServer) func(ctx *fiber.Ctx) error {
 	return func(ctx *fiber.Ctx) error {
 		var (
 			req struct {
-				ID   string `params:"id"`
-				Mint string `json:"mint"`
+				ID      string `params:"id"`
+				Message string `json:"Message"`
+			}
+
+			res struct {
+				ChatMessage []string `json:"chat_message"`
 			}
 		)
-		if err := ctx.ParamsParser(&req); err != nil {
-			return ctx.Status(http.StatusInternalServerError).JSON(util.MakeResponseWithMsg(err.Error()))
-		}
+
+		accountID := ctx.Locals(middlewares.LocalsAccount).(string)
+		if err := ctx.ParamsParser(&req); err != nil {
+			return ctx.Status(http.StatusBadRequest).JSON(util.MakeResponseWithMsg(err.Error()))
+		}
+
+		if err := ctx.BodyParser(&req); err != nil {
+			return ctx.Status(http.StatusBadRequest).JSON(util.MakeResponseWithMsg(err.Error()))
+		}
+
+		zap.S().Infof("chat: req: %+v", req)
+
+		r, err := service.Chat(ctx.Context(), &character.ChatRequest{
+			Message:     req.Message,
+			CharacterID: req.ID,
+			AccountID:   accountID,
+		})
+		if r == nil {
+			res.ChatMessage = []string{}
+		} else {
+			res.ChatMessage = []string{r.Message}
+		}
+		if err != nil {
+			return ctx.Status(http.StatusInternalServerError).JSON(util.MakeErrResponse(err))
+		}
+		return ctx.Status(http.StatusOK).JSON(util.MakeResponse(res))
+	}
+}
+
+func ChatV2(service CharacterHTTPServer) func(ctx *fiber.Ctx) error {
+	return func(ctx *fiber.Ctx) error {
+		var (
+			reqData struct {
+				ID             string `params:"id"`
+				Message        string `json:"Message"`
+				ConversationID string `json:"conversation_id"`
+				Action         string `json:"action"`
+				MessageID      string `json:"message_id"`
+			}
+		)
+
+		accountID := ctx.Locals(middlewares.LocalsAccount).(string)
+		if err := ctx.ParamsParser(&reqData); err != nil {
+			return ctx.Status(http.StatusBadRequest).JSON(util.MakeResponseWithMsg(err.Error()))
+		}
+		if err := ctx.BodyParser(&reqData); err != nil {
+			return ctx.Status(http.StatusBadRequest).JSON(util.MakeResponseWithMsg(err.Error()))
+		}
+
+		chatReq := &character.ChatRequestV2{
+			Message:        reqData.Message,
+			CharacterID:    reqData.ID,
+			AccountID:      accountID,
+			ConversationID: reqData.ConversationID,
+			Action:         reqData.Action,
+			MessageID:      reqData.MessageID,
+		}
+		err := service.ChatV2(ctx.Context(), chatReq)
+		if err != nil {
+			return ctx.Status(http.StatusInternalServerError).JSON(util.MakeErrResponse(err))
+		}
+
+		streamCtx, cancel := context.WithCancel(context.Background())
+		resCh := make(chan *character.ReplyEvent)
+		err = service.StreamReply(streamCtx, &character.StreamReplyRequest{
+			AccountID:      accountID,
+			ConversationID: chatReq.ConversationID,
+			ReplyID:        chatReq.ReplyID,
+			ResCh:          resCh,
+		})
+		if err != nil {
+			cancel()
+			return ctx.Status(http.StatusInternalServerError).JSON(util.MakeErrResponse(err))
+		}
+		writeReplyStream(ctx, resCh, cancel)
+		return nil
+	}
+}
+
+func history(service CharacterHTTPServer) func(ctx *fiber.Ctx) error {
+	return func(ctx *fiber.Ctx) error {
+		var (
+			req struct {
+				Page  int `query:"page"`
+				Limit int `query:"limit"`
+			}
+			res struct {
+				Data  []*character.QueryCharactersHistoryResponse `json:"data"`
+				Count int64                                       `json:"count"`
+			}
+		)
+		if err := ctx.QueryParser(&req); err != nil {
+			return ctx.Status(http.StatusInternalServerError).JSON(util.MakeResponseWithMsg(err.Error()))
+		}
+		accountID := ctx.Locals(middlewares.LocalsAccount).(string)
+		characters, count, err := service.QueryCharactersHistory(ctx.Context(), &character.QueryCharactersHistoryRequest{
+			Page:    req.Page,
+			Limit:   req.Limit,
+			Account: accountID,
+		})
+
+		if err != nil {
+			return ctx.Status(http.StatusInternalServerError).JSON(util.MakeResponseWithMsg(err.Error()))
+		}
+		res.Data = characters
+		res.Count = count
+		return ctx.Status(http.StatusOK).JSON(util.MakeResponse(res))
+	}
+}
+
+func messages(service CharacterHTTPServer) func(ctx *fiber.Ctx) error {
+	return func(ctx *fiber.Ctx) error {
+		var (
+			req struct {
+				ID             string `params:"id"`
+				ConversationID string `query:"conversation_id"`
+				Page           int    `query:"page"`
+				Limit          int    `query:"limit"`
+			}
+			res struct {
+				Data  []*character.ChatMessageResponse `json:"data"`
+				Count int64                            `json:"count"`
+			}
+		)
+		if err := ctx.ParamsParser(&req); err != nil {
+			return ctx.Status(http.StatusBadRequest).JSON(util.MakeResponseWithMsg(err.Error()))
+		}
+		if err := ctx.QueryParser(&req); err != nil {
+			return ctx.Status(http.StatusBadRequest).JSON(util.MakeResponseWithMsg(err.Error()))
+		}
+		accountID := ctx.Locals(middlewares.LocalsAccount).(string)
+		data, count, err := service.QueryChatMessages(ctx.Context(), &character.QueryChatMessagesRequest{
+			CharacterID:    req.ID,
+			AccountID:      accountID,
+			ConversationID: req.ConversationID,
+			Page:           req.Page,
+			Limit:          req.Limit,
+		})
+		if err != nil {
+			return ctx.Status(http.StatusInternalServerError).JSON(util.MakeErrResponse(err))
+		}
+		res.Data = data
+		res.Count = count
+		return ctx.Status(http.StatusOK).JSON(util.MakeResponse(res))
+	}
+}
+
+func fork(service CharacterHTTPServer) func(ctx *fiber.Ctx) error {
+	return func(ctx *fiber.Ctx) error {
+		var (
+			req struct {
+				ID string `params:"id"`
+			}
+		)
+		if err := ctx.ParamsParser(&req); err != nil {
+			return ctx.Status(http.StatusBadRequest).JSON(util.MakeResponseWithMsg(err.Error()))
+		}
+
+		accountID := ctx.Locals(middlewares.LocalsAccount).(string)
+		res, err := service.ForkCharacter(ctx.Context(), &character.ForkCharacterRequest{
+			AccountID:   accountID,
+			CharacterID: req.ID,
+		})
+		if err != nil {
+			return ctx.Status(http.StatusInternalServerError).JSON(util.MakeErrResponse(err))
+		}
+		return ctx.Status(http.StatusOK).JSON(util.MakeResponse(res))
+	}
+}
+
+func revisions(service CharacterHTTPServer) func(ctx *fiber.Ctx) error {
+	return func(ctx *fiber.Ctx) error {
+		var (
+			req struct {
+				ID    string `params:"id"`
+				Page  int    `query:"page"`
+				Limit int    `query:"limit"`
+			}
+			res struct {
+				Data  []*character.RevisionResponse `json:"data"`
+				Count int64                         `json:"count"`
+			}
+		)
+		if err := ctx.ParamsParser(&req); err != nil {
+			return ctx.Status(http.StatusBadRequest).JSON(util.MakeResponseWithMsg(err.Error()))
+		}
+		if err := ctx.QueryParser(&req); err != nil {
+			return ctx.Status(http.StatusBadRequest).JSON(util.MakeResponseWithMsg(err.Error()))
+		}
+
+		accountID := ctx.Locals(middlewares.LocalsAccount).(string)
+		data, count, err := service.QueryRevisions(ctx.Context(), &character.QueryRevisionsRequest{
+			AccountID:   accountID,
+			CharacterID: req.ID,
+			Page:        req.Page,
+			Limit:       req.Limit,
+		})
+		if err != nil {
+			return ctx.Status(http.StatusInternalServerError).JSON(util.MakeErrResponse(err))
+		}
+		res.Data = data
+		res.Count = count
+		return ctx.Status(http.StatusOK).JSON(util.MakeResponse(res))
+	}
+}
+
+func diffRevisions(service CharacterHTTPServer) func(ctx *fiber.Ctx) error {
+	return func(ctx *fiber.Ctx) error {
+		var (
+			req struct {
+				ID      string `params:"id"`
+				Version int    `params:"version"`
+				Against int    `query:"against"`
+			}
+		)
+		if err := ctx.ParamsParser(&req); err != nil {
+			return ctx.Status(http.StatusBadRequest).JSON(util.MakeResponseWithMsg(err.Error()))
+		}
+		if err := ctx.QueryParser(&req); err != nil {
+			return ctx.Status(http.StatusBadRequest).JSON(util.MakeResponseWithMsg(err.Error()))
+		}
+
+		accountID := ctx.Locals(middlewares.LocalsAccount).(string)
+		res, err := service.DiffRevisions(ctx.Context(), &character.DiffRevisionsRequest{
+			AccountID:   accountID,
+			CharacterID: req.ID,
+			Version:     req.Version,
+			Against:     req.Against,
+		})
+		if err != nil {
+			return ctx.Status(http.StatusInternalServerError).JSON(util.MakeErrResponse(err))
+		}
+		return ctx.Status(http.StatusOK).JSON(util.MakeResponse(res))
+	}
+}
+
+func rollbackRevision(service CharacterHTTPServer) func(ctx *fiber.Ctx) error {
+	return func(ctx *fiber.Ctx) error {
+		var (
+			req struct {
+				ID      string `params:"id"`
+				Version int    `params:"version"`
+			}
+		)
+		if err := ctx.ParamsParser(&req); err != nil {
+			return ctx.Status(http.StatusBadRequest).JSON(util.MakeResponseWithMsg(err.Error()))
+		}
+
+		accountID := ctx.Locals(middlewares.LocalsAccount).(string)
+		res, err := service.RollbackRevision(ctx.Context(), &character.RevisionRequest{
+			AccountID:   accountID,
+			CharacterID: req.ID,
+			Version:     req.Version,
+		})
+		if err != nil {
+			return ctx.Status(http.StatusInternalServerError).JSON(util.MakeErrResponse(err))
+		}
+		return ctx.Status(http.StatusOK).JSON(util.MakeResponse(res))
+	}
+}
+
+func memories(service CharacterHTTPServer) func(ctx *fiber.Ctx) error {
+	return func(ctx *fiber.Ctx) error {
+		var (
+			req struct {
+				ID string `params:"id"`
+			}
+		)
+		if err := ctx.ParamsParser(&req); err != nil {
+			return ctx.Status(http.StatusBadRequest).JSON(util.MakeResponseWithMsg(err.Error()))
+		}
+		accountID := ctx.Locals(middlewares.LocalsAccount).(string)
+		res, err := service.QueryMemories(ctx.Context(), &character.QueryMemoriesRequest{
+			AccountID:   accountID,
+			CharacterID: req.ID,
+		})
+		if err != nil {
+			return ctx.Status(http.StatusInternalServerError).JSON(util.MakeErrResponse(err))
+		}
+		return ctx.Status(http.StatusOK).JSON(util.MakeResponse(res))
+	}
+}
+
+func deleteMemory(service CharacterHTTPServer) func(ctx *fiber.Ctx) error {
+	return func(ctx *fiber.Ctx) error {
+		var (
+			req struct {
+				ID       string `params:"id"`
+				MemoryID string `params:"memory_id"`
+			}
+		)
+		if err := ctx.ParamsParser(&req); err != nil {
+			return ctx.Status(http.StatusBadRequest).JSON(util.MakeResponseWithMsg(err.Error()))
+		}
+		accountID := ctx.Locals(middlewares.LocalsAccount).(string)
+		err := service.DeleteMemory(ctx.Context(), &character.DeleteMemoryRequest{
+			AccountID:   accountID,
+			CharacterID: req.ID,
+			MemoryID:    req.MemoryID,
+		})
+		if err != nil {
+			return ctx.Status(http.StatusInternalServerError).JSON(util.MakeErrResponse(err))
+		}
+		return ctx.Status(http.StatusOK).JSON(util.MakeResponse("ok"))
+	}
+}
+
+func deleteMemories(service CharacterHTTPServer) func(ctx *fiber.Ctx) error {
+	return func(ctx *fiber.Ctx) error {
+		var (
+			req struct {
+				ID string `params:"id"`
+			}
+		)
+		if err := ctx.ParamsParser(&req); err != nil {
+			return ctx.Status(http.StatusBadRequest).JSON(util.MakeResponseWithMsg(err.Error()))
+		}
+		accountID := ctx.Locals(middlewares.LocalsAccount).(string)
+		err := service.DeleteMemories(ctx.Context(), &character.DeleteMemoriesRequest{
+			AccountID:   accountID,
+			CharacterID: req.ID,
+		})
+		if err != nil {
+			return ctx.Status(http.StatusInternalServerError).JSON(util.MakeErrResponse(err))
+		}
+		return ctx.Status(http.StatusOK).JSON(util.MakeResponse("ok"))
+	}
+}
+
+func info(service CharacterHTTPServer) func(ctx *fiber.Ctx) error {
+	return func(ctx *fiber.Ctx) error {
+		var (
+			req struct {
+				ID string `params:"id"`
+			}
+		)
+		if err := ctx.ParamsParser(&req); err != nil {
+			return ctx.Status(http.StatusInternalServerError).JSON(util.MakeResponseWithMsg(err.Error()))
+		}
+
+		characters, err := service.QueryCharacterInfo(ctx.Context(), req.ID)
+
+		if err != nil {
+			return ctx.Status(http.StatusInternalServerError).JSON(util.MakeResponseWithMsg(err.Error()))
+		}
+		return ctx.Status(http.StatusOK).JSON(util.MakeResponse(characters))
+	}
+}
+
+func mint(service CharacterHTTPServer) func(ctx *fiber.Ctx) error {
+	return func(ctx *fiber.Ctx) error {
+		var (
+			req struct {
+				ID   string `params:"id"`
+				Mint string `json:"mint"`
+			}
+		)
+		if err := ctx.ParamsParser(&req); err != nil {
+			return ctx.Status(http.StatusInternalServerError).JSON(util.MakeResponseWithMsg(err.Error()))
+		}
 
 		if err := ctx.BodyParser(&req); err != nil {
 			return ctx.Status(http.StatusBadRequest).JSON(util.MakeResponseWithMsg(err.Error()))
@@ -559,6 +1125,11 @@ func updateCharacter(service CharacterHTTPServer) func(ctx *fiber.Ctx) error {
 				Image       string   `form:"image"`
 				Name        string   `form:"name"`
 				Voice       string   `form:"voice"`
+				Visibility  int      `form:"visibility"`
+
+				Temperature    string `form:"temperature"`
+				MaxHistory     string `form:"max_history"`
+				MaxReplyLength string `form:"max_reply_length"`
 			}
 		)
 
@@ -578,37 +1149,26 @@ func updateCharacter(service CharacterHTTPServer) func(ctx *fiber.Ctx) error {
 			return ctx.Status(http.StatusBadRequest).JSON(util.MakeErrResponse(err))
 		}
 
-		accountID := ctx.Locals(middlewares.LocalsAccount).(string)
-		zap.S().Infof("updateCharacter: file size: %d", len(files.File["files"]))
-		dir := fmt.Sprintf("%s%s", configs.GetConfig().File.ImagePath, accountID)
-		if err = util.Mkdir(dir); err != nil {
-			return ctx.Status(http.StatusBadRequest).JSON(util.MakeErrResponse(err))
+		settings, err := parseGenerationSettings(req.Temperature, req.MaxHistory, req.MaxReplyLength,
+			files.Value["stop_sequences"])
+		if err != nil {
+			return ctx.Status(http.StatusBadRequest).JSON(util.MakeResponseWithMsg(err.Error()))
 		}
 
-		imageMap := map[string]struct{}{"1": {}, "2": {}, "3": {}, "4": {}}
-
-		for i := range req.Images {
-			fileName := util.URL2FileName(req.Images[i])
-			fileKey := strings.Split(fileName, ".")[0]
-			delete(imageMap, fileKey)
-		}
+		accountID := ctx.Locals(middlewares.LocalsAccount).(string)
+		zap.S().Infof("updateCharacter: file size: %d", len(files.File["files"]))
 		if len(req.Images)+len(files.File["files"]) > ImageCountLimit {
 			return ctx.Status(http.StatusBadRequest).JSON(util.MakeErrResponse(errors.New(" You've reached the limit for upload image")))
 		}
+		// every update writes to a directory of its own, the images of the
+		// earlier revisions stay in place for a rollback.
+		imageMap := map[string]struct{}{"1": {}, "2": {}, "3": {}, "4": {}}
 		urlLen := len(req.Images)
-		for _, file := range files.File["files"] {
-			for key := range imageMap {
-				fileExt := filepath.Ext(file.Filename)
-				filePath := fmt.Sprintf("%s/%s%s", dir, key, fileExt)
-				if err = ctx.SaveFile(file, filePath); err != nil {
-					return ctx.Status(http.StatusInternalServerError).JSON(util.MakeErrResponse(err))
-				}
-				req.Images = append(req.Images, fmt.Sprintf("%s?t=%d", configs.GetConfig().File.ImagesEndpoint+accountID+"/"+key+fileExt, time.Now().Nanosecond()))
-				zap.S().Infof("images :%s", req.Images[len(req.Images)-1])
-				delete(imageMap, key)
-				break
-			}
+		images, err := saveImageFiles(ctx, accountID+"/"+req.ID+"/"+uuid.NewString(), files.File["files"], imageMap)
+		if err != nil {
+			return ctx.Status(http.StatusInternalServerError).JSON(util.MakeErrResponse(err))
 		}
+		req.Images = append(req.Images, images...)
 
 		if num > len(req.Images) && num <= 9+len(files.File["files"]) {
 			num = num%10 + urlLen
@@ -617,7 +1177,7 @@ func updateCharacter(service CharacterHTTPServer) func(ctx *fiber.Ctx) error {
 			req.Image = req.Images[num]
 		}
 
-		err = service.UpdateCharacter(ctx.Context(), &character.UpdateCharacterRequest{
+		update := &character.UpdateCharacterRequest{
 			ID:          req.ID,
 			AccountID:   accountID,
 			Description: req.Description,
@@ -625,7 +1185,18 @@ func updateCharacter(service CharacterHTTPServer) func(ctx *fiber.Ctx) error {
 			Images:      req.Images,
 			Image:       req.Image,
 			Voice:       req.Voice,
-		})
+			Visibility:  req.Visibility,
+			Settings:    settings,
+		}
+		// the greeting and the examples change only when sent, an empty value
+		// clears them.
+		if greeting, ok := files.Value["greeting"]; ok && len(greeting) > 0 {
+			update.Greeting = &greeting[0]
+		}
+		if examples, ok := files.Value["example_dialogues"]; ok {
+			update.ExampleDialogues = parseExampleDialogues(examples)
+		}
+		err = service.UpdateCharacter(ctx.Context(), update)
 		if err != nil {
 			return ctx.Status(http.StatusInternalServerError).JSON(util.MakeErrResponse(err))
 		}
@@ -633,6 +1204,233 @@ func updateCharacter(service CharacterHTTPServer) func(ctx *fiber.Ctx) error {
 	}
 }
 
+// createManual creates a character from a multipart form. The uploaded
+// portraits are stored like the ones of updateCharacter, in a directory of
+// their own so they do not replace the images of other characters.
+func createManual(service CharacterHTTPServer) func(ctx *fiber.Ctx) error {
+	return func(ctx *fiber.Ctx) error {
+		var (
+			req struct {
+				Name         string `form:"name"`
+				Gender       int    `form:"gender"`
+				Description  string `form:"description"`
+				Introduction string `form:"introduction"`
+				Tags         string `form:"tags"`
+				Voice        string `form:"voice"`
+				Image        int    `form:"image"`
+				Is3D         bool   `form:"is_3d"`
+				Visibility   int    `form:"visibility"`
+				Greeting     string `form:"greeting"`
+			}
+			tags map[string]string
+		)
+		if err := ctx.BodyParser(&req); err != nil {
+			return ctx.Status(http.StatusBadRequest).JSON(util.MakeResponseWithMsg(err.Error()))
+		}
+		if req.Tags != "" {
+			if err := json.Unmarshal([]byte(req.Tags), &tags); err != nil {
+				return ctx.Status(http.StatusBadRequest).JSON(util.MakeResponseWithMsg(fmt.Sprintf("tags: %s", err.Error())))
+			}
+		}
+		files, err := ctx.MultipartForm()
+		if err != nil {
+			return ctx.Status(http.StatusBadRequest).JSON(util.MakeErrResponse(err))
+		}
+		if len(files.File["files"]) == 0 || len(files.File["files"]) > ImageCountLimit {
+			return ctx.Status(http.StatusBadRequest).
+				JSON(util.MakeResponseWithMsg(fmt.Sprintf("upload between 1 and %d images", ImageCountLimit)))
+		}
+		if req.Image < 0 || req.Image >= len(files.File["files"]) {
+			return ctx.Status(http.StatusBadRequest).JSON(util.MakeResponseWithMsg("image is out of range"))
+		}
+
+		accountID := ctx.Locals(middlewares.LocalsAccount).(string)
+		id := uuid.NewString()
+		dir := accountID + "/" + id
+		imageMap := map[string]struct{}{"1": {}, "2": {}, "3": {}, "4": {}}
+		images, err := saveImageFiles(ctx, dir, files.File["files"], imageMap)
+		if err != nil {
+			return ctx.Status(http.StatusInternalServerError).JSON(util.MakeErrResponse(err))
+		}
+
+		res, err := service.CreateManualCharacter(ctx.Context(), &character.CreateManualCharacterRequest{
+			ID:           id,
+			AccountID:    accountID,
+			Name:         req.Name,
+			Gender:       req.Gender,
+			Description:  req.Description,
+			Introduction: req.Introduction,
+			Tags:         tags,
+			Voice:        req.Voice,
+			Images:       images,
+			Image:        images[req.Image],
+			Is3D:         req.Is3D,
+			Visibility:   req.Visibility,
+
+			Greeting:         req.Greeting,
+			ExampleDialogues: parseExampleDialogues(files.Value["example_dialogues"]),
+		})
+		if err != nil {
+			if rmErr := os.RemoveAll(configs.GetConfig().File.ImagePath + dir); rmErr != nil {
+				zap.S().Errorf("createManual: remove images err: %v", rmErr)
+			}
+			return ctx.Status(http.StatusInternalServerError).JSON(util.MakeErrResponse(err))
+		}
+		return ctx.Status(http.StatusOK).JSON(util.MakeResponse(res))
+	}
+}
+
+// parseExampleDialogues drops the blank example dialogues of a form. The
+// result is never nil, so that an update sending only blanks clears them.
+func parseExampleDialogues(values []string) []string {
+	examples := make([]string, 0, len(values))
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			examples = append(examples, v)
+		}
+	}
+	return examples
+}
+
+func exportCard(service CharacterHTTPServer) func(ctx *fiber.Ctx) error {
+	return func(ctx *fiber.Ctx) error {
+		var (
+			req struct {
+				ID     string `params:"id"`
+				Format string `query:"format"`
+			}
+		)
+		if err := ctx.ParamsParser(&req); err != nil {
+			return ctx.Status(http.StatusBadRequest).JSON(util.MakeResponseWithMsg(err.Error()))
+		}
+		if err := ctx.QueryParser(&req); err != nil {
+			return ctx.Status(http.StatusBadRequest).JSON(util.MakeResponseWithMsg(err.Error()))
+		}
+
+		res, err := service.ExportCharacterCard(ctx.Context(), &character.ExportCharacterCardRequest{
+			CharacterID: req.ID,
+			Format:      req.Format,
+		})
+		if err != nil {
+			return ctx.Status(http.StatusInternalServerError).JSON(util.MakeErrResponse(err))
+		}
+		ctx.Attachment(res.FileName)
+		ctx.Set(fiber.HeaderContentType, res.ContentType)
+		return ctx.Status(http.StatusOK).Send(res.Body)
+	}
+}
+
+// importCard creates a character from an uploaded JSON or PNG card. The
+// picture of a PNG card is kept as the portrait of the new character.
+func importCard(service CharacterHTTPServer) func(ctx *fiber.Ctx) error {
+	return func(ctx *fiber.Ctx) error {
+		file, err := ctx.FormFile("file")
+		if err != nil {
+			return ctx.Status(http.StatusBadRequest).JSON(util.MakeResponseWithMsg(err.Error()))
+		}
+		f, err := file.Open()
+		if err != nil {
+			return ctx.Status(http.StatusBadRequest).JSON(util.MakeErrResponse(err))
+		}
+		card, err := io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			return ctx.Status(http.StatusBadRequest).JSON(util.MakeErrResponse(err))
+		}
+
+		accountID := ctx.Locals(middlewares.LocalsAccount).(string)
+		id := uuid.NewString()
+		dir := accountID + "/" + id
+		var image string
+		if util.IsPNG(card) {
+			images, err := saveImageFiles(ctx, dir, []*multipart.FileHeader{file}, map[string]struct{}{"1": {}})
+			if err != nil {
+				return ctx.Status(http.StatusInternalServerError).JSON(util.MakeErrResponse(err))
+			}
+			image = images[0]
+		}
+
+		res, err := service.ImportCharacterCard(ctx.Context(), &character.ImportCharacterCardRequest{
+			ID:        id,
+			AccountID: accountID,
+			Card:      card,
+			Image:     image,
+		})
+		if err != nil {
+			if image != "" {
+				if rmErr := os.RemoveAll(configs.GetConfig().File.ImagePath + dir); rmErr != nil {
+					zap.S().Errorf("importCard: remove images err: %v", rmErr)
+				}
+			}
+			return ctx.Status(http.StatusInternalServerError).JSON(util.MakeErrResponse(err))
+		}
+		return ctx.Status(http.StatusOK).JSON(util.MakeResponse(res))
+	}
+}
+
+// saveImageFiles stores the uploaded images under dir of the image path, each
+// one taking a free key as its file name, and returns their urls.
+func saveImageFiles(ctx *fiber.Ctx, dir string, files []*multipart.FileHeader, free map[string]struct{}) ([]string, error) {
+	if err := util.Mkdir(configs.GetConfig().File.ImagePath + dir); err != nil {
+		return nil, err
+	}
+	images := make([]string, 0, len(files))
+	for _, file := range files {
+		for key := range free {
+			fileExt := filepath.Ext(file.Filename)
+			filePath := fmt.Sprintf("%s%s/%s%s", configs.GetConfig().File.ImagePath, dir, key, fileExt)
+			if err := ctx.SaveFile(file, filePath); err != nil {
+				return nil, err
+			}
+			images = append(images, fmt.Sprintf("%s?t=%d", configs.GetConfig().File.ImagesEndpoint+dir+"/"+key+fileExt, time.Now().Nanosecond()))
+			zap.S().Infof("images :%s", images[len(images)-1])
+			delete(free, key)
+			break
+		}
+	}
+	return images, nil
+}
+
+// parseGenerationSettings reads the generation settings of the update form,
+// fields that are absent keep their current value.
+func parseGenerationSettings(temperature, maxHistory, maxReplyLength string,
+	stopSequences []string) (*character.GenerationSettings, error) {
+	var settings character.GenerationSettings
+	if temperature != "" {
+		v, err := strconv.ParseFloat(temperature, 32)
+		if err != nil {
+			return nil, fmt.Errorf("temperature: %w", err)
+		}
+		t := float32(v)
+		settings.Temperature = &t
+	}
+	if maxHistory != "" {
+		v, err := strconv.ParseInt(maxHistory, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("max_history: %w", err)
+		}
+		n := int32(v)
+		settings.MaxHistory = &n
+	}
+	if maxReplyLength != "" {
+		v, err := strconv.ParseInt(maxReplyLength, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("max_reply_length: %w", err)
+		}
+		n := int32(v)
+		settings.MaxReplyLength = &n
+	}
+	if stopSequences != nil {
+		settings.StopSequences = make([]string, 0, len(stopSequences))
+		for i := range stopSequences {
+			if stopSequences[i] != "" {
+				settings.StopSequences = append(settings.StopSequences, stopSequences[i])
+			}
+		}
+	}
+	return &settings, nil
+}
+
 func queryVoice(service CharacterHTTPServer) func(ctx *fiber.Ctx) error {
 	return func(ctx *fiber.Ctx) error {
 		res, err := service.QueryVoice(ctx.Context())
@@ -0,0 +1,168 @@
+package v1
+
+import (
+	"context"
+	"fmt"
+	"starland-backend/internal/pkg/middlewares"
+	"starland-backend/internal/pkg/util"
+	"starland-backend/internal/service/character"
+
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+)
+
+// Events exchanged over the chat WebSocket. Clients send message, cancel and
+// typing events, the server answers with typing events next to the token,
+// voice, done and error events of the SSE stream. A cancelled reply ends with
+// a done event marked as truncated.
+const (
+	WSEventMessage = "message"
+	WSEventCancel  = "cancel"
+	WSEventTyping  = "typing"
+	WSEventError   = SSEEventError
+)
+
+type WSEvent struct {
+	Type           string      `json:"type"`
+	ID             string      `json:"id,omitempty"`
+	ConversationID string      `json:"conversation_id,omitempty"`
+	Message        string      `json:"message,omitempty"`
+	Action         string      `json:"action,omitempty"`
+	MessageID      string      `json:"message_id,omitempty"`
+	Typing         bool        `json:"typing,omitempty"`
+	Data           interface{} `json:"data,omitempty"`
+}
+
+func wsUpgrade(ctx *fiber.Ctx) error {
+	if !websocket.IsWebSocketUpgrade(ctx) {
+		return fiber.ErrUpgradeRequired
+	}
+	return ctx.Next()
+}
+
+// chatWS serves several chat turns over one connection. Each turn goes
+// through CharacterService.ChatV2 like the SSE endpoint, while the client can
+// still cancel the reply that is being generated.
+func chatWS(service CharacterHTTPServer) func(conn *websocket.Conn) {
+	return func(conn *websocket.Conn) {
+		accountID := conn.Locals(middlewares.LocalsAccount).(string)
+		characterID := conn.Params("id")
+
+		in := make(chan *WSEvent)
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			defer close(in)
+			for {
+				event := new(WSEvent)
+				if err := conn.ReadJSON(event); err != nil {
+					if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+						zap.S().Errorf("chatWS: read err: %v", err)
+					}
+					return
+				}
+				select {
+				case in <- event:
+				case <-done:
+					return
+				}
+			}
+		}()
+
+		for event := range in {
+			switch event.Type {
+			case WSEventMessage:
+				if !chatWSTurn(conn, service, in, accountID, characterID, event) {
+					return
+				}
+			case WSEventTyping, WSEventCancel:
+				// nothing is generated between turns
+			default:
+				if err := writeWSError(conn, fmt.Errorf("unknown event type %q", event.Type)); err != nil {
+					return
+				}
+			}
+		}
+	}
+}
+
+// chatWSTurn streams one reply and reports whether the connection is still
+// usable. A cancel stops the generation, while a dropped connection only
+// stops reading so the reply is still persisted and can be resumed.
+func chatWSTurn(conn *websocket.Conn, service CharacterHTTPServer, in <-chan *WSEvent,
+	accountID, characterID string, event *WSEvent) bool {
+	chatReq := &character.ChatRequestV2{
+		Message:        event.Message,
+		CharacterID:    characterID,
+		AccountID:      accountID,
+		ConversationID: event.ConversationID,
+		Action:         event.Action,
+		MessageID:      event.MessageID,
+	}
+	if err := service.ChatV2(context.Background(), chatReq); err != nil {
+		return writeWSError(conn, err) == nil
+	}
+
+	readCtx, stopRead := context.WithCancel(context.Background())
+	defer stopRead()
+	resCh := make(chan *character.ReplyEvent)
+	err := service.StreamReply(readCtx, &character.StreamReplyRequest{
+		AccountID:      accountID,
+		ConversationID: chatReq.ConversationID,
+		ReplyID:        chatReq.ReplyID,
+		ResCh:          resCh,
+	})
+	if err != nil {
+		return writeWSError(conn, err) == nil
+	}
+
+	if err = conn.WriteJSON(&WSEvent{Type: WSEventTyping, ConversationID: chatReq.ConversationID, Typing: true}); err != nil {
+		return false
+	}
+	for resCh != nil {
+		select {
+		case e, ok := <-resCh:
+			if !ok {
+				resCh = nil
+				break
+			}
+			res := &WSEvent{
+				Type:           e.Event,
+				ID:             e.ID,
+				ConversationID: chatReq.ConversationID,
+				Data:           e.Data,
+			}
+			if err = conn.WriteJSON(res); err != nil {
+				zap.S().Errorf("chatWS: write %s err: %v", e.Event, err)
+				return false
+			}
+		case e, ok := <-in:
+			if !ok {
+				return false
+			}
+			switch e.Type {
+			case WSEventCancel:
+				err = service.CancelReply(context.Background(), &character.CancelReplyRequest{
+					AccountID:      accountID,
+					ConversationID: chatReq.ConversationID,
+					ReplyID:        chatReq.ReplyID,
+				})
+				if err != nil && writeWSError(conn, err) != nil {
+					return false
+				}
+			case WSEventTyping:
+			default:
+				if err = writeWSError(conn, fmt.Errorf("a reply is still being generated")); err != nil {
+					return false
+				}
+			}
+		}
+	}
+
+	return conn.WriteJSON(&WSEvent{Type: WSEventTyping, ConversationID: chatReq.ConversationID}) == nil
+}
+
+func writeWSError(conn *websocket.Conn, err error) error {
+	return conn.WriteJSON(&WSEvent{Type: WSEventError, Data: util.MakeErrResponse(err)})
+}
@@ -0,0 +1,298 @@
+package v1
+
+import (
+	"context"
+	"net/http"
+	"starland-backend/configs"
+	"starland-backend/internal/pkg/middlewares"
+	"starland-backend/internal/pkg/util"
+	"starland-backend/internal/service/character"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type CollectionHTTPServer interface {
+	CreateCollection(context.Context, *character.CreateCollectionRequest) (*character.CollectionResponse, error)
+	QueryCollections(context.Context, *character.QueryCollectionsRequest) ([]*character.CollectionResponse, int64, error)
+	QueryCollection(context.Context, *character.CollectionRequest) (*character.CollectionResponse, error)
+	UpdateCollection(context.Context, *character.UpdateCollectionRequest) (*character.CollectionResponse, error)
+	DeleteCollection(context.Context, *character.CollectionRequest) error
+	QueryCollectionCharacters(context.Context, *character.QueryCollectionCharactersRequest) ([]*character.QueryCharacterResponse, int64, error)
+	AddCollectionCharacter(context.Context, *character.CollectionCharacterRequest) error
+	RemoveCollectionCharacter(context.Context, *character.CollectionCharacterRequest) error
+	SortCollection(context.Context, *character.SortCollectionRequest) error
+}
+
+func InitCollectionRouter(app fiber.Router, service CollectionHTTPServer, conf *configs.Config) {
+	router := app.Group("/v1")
+
+	authRouter := router.Group("/collections", middlewares.JwtParse())
+	authRouter.Post("", createCollection(service))
+	authRouter.Get("", queryCollections(service))
+	authRouter.Get("/:id", queryCollection(service))
+	authRouter.Put("/:id", updateCollection(service))
+	authRouter.Delete("/:id", deleteCollection(service))
+	authRouter.Get("/:id/characters", queryCollectionCharacters(service))
+	authRouter.Post("/:id/characters", addCollectionCharacter(service))
+	authRouter.Put("/:id/characters", sortCollection(service))
+	authRouter.Delete("/:id/characters/:character_id", removeCollectionCharacter(service))
+}
+
+func createCollection(service CollectionHTTPServer) func(ctx *fiber.Ctx) error {
+	return func(ctx *fiber.Ctx) error {
+		var (
+			req struct {
+				Name        string `json:"name"`
+				Description string `json:"description"`
+				Visibility  int    `json:"visibility"`
+			}
+		)
+		if err := ctx.BodyParser(&req); err != nil {
+			return ctx.Status(http.StatusBadRequest).JSON(util.MakeResponseWithMsg(err.Error()))
+		}
+
+		accountID := ctx.Locals(middlewares.LocalsAccount).(string)
+		res, err := service.CreateCollection(ctx.Context(), &character.CreateCollectionRequest{
+			AccountID:   accountID,
+			Name:        req.Name,
+			Description: req.Description,
+			Visibility:  req.Visibility,
+		})
+		if err != nil {
+			return ctx.Status(http.StatusInternalServerError).JSON(util.MakeErrResponse(err))
+		}
+		return ctx.Status(http.StatusOK).JSON(util.MakeResponse(res))
+	}
+}
+
+// queryCollections lists the collections of the account, or the public ones
+// of the account_id query.
+func queryCollections(service CollectionHTTPServer) func(ctx *fiber.Ctx) error {
+	return func(ctx *fiber.Ctx) error {
+		var (
+			req struct {
+				AccountID string `query:"account_id"`
+				Page      int    `query:"page"`
+				Limit     int    `query:"limit"`
+			}
+			res struct {
+				Data  []*character.CollectionResponse `json:"data"`
+				Count int64                           `json:"count"`
+			}
+		)
+		if err := ctx.QueryParser(&req); err != nil {
+			return ctx.Status(http.StatusBadRequest).JSON(util.MakeResponseWithMsg(err.Error()))
+		}
+
+		accountID := ctx.Locals(middlewares.LocalsAccount).(string)
+		data, count, err := service.QueryCollections(ctx.Context(), &character.QueryCollectionsRequest{
+			AccountID: accountID,
+			Owner:     req.AccountID,
+			Page:      req.Page,
+			Limit:     req.Limit,
+		})
+		if err != nil {
+			return ctx.Status(http.StatusInternalServerError).JSON(util.MakeErrResponse(err))
+		}
+		res.Data = data
+		res.Count = count
+		return ctx.Status(http.StatusOK).JSON(util.MakeResponse(res))
+	}
+}
+
+func queryCollection(service CollectionHTTPServer) func(ctx *fiber.Ctx) error {
+	return func(ctx *fiber.Ctx) error {
+		var (
+			req struct {
+				ID string `params:"id"`
+			}
+		)
+		if err := ctx.ParamsParser(&req); err != nil {
+			return ctx.Status(http.StatusBadRequest).JSON(util.MakeResponseWithMsg(err.Error()))
+		}
+
+		accountID := ctx.Locals(middlewares.LocalsAccount).(string)
+		res, err := service.QueryCollection(ctx.Context(), &character.CollectionRequest{
+			AccountID:    accountID,
+			CollectionID: req.ID,
+		})
+		if err != nil {
+			return ctx.Status(http.StatusInternalServerError).JSON(util.MakeErrResponse(err))
+		}
+		return ctx.Status(http.StatusOK).JSON(util.MakeResponse(res))
+	}
+}
+
+func updateCollection(service CollectionHTTPServer) func(ctx *fiber.Ctx) error {
+	return func(ctx *fiber.Ctx) error {
+		var (
+			req struct {
+				ID          string  `params:"id"`
+				Name        *string `json:"name"`
+				Description *string `json:"description"`
+				Visibility  *int    `json:"visibility"`
+			}
+		)
+		if err := ctx.ParamsParser(&req); err != nil {
+			return ctx.Status(http.StatusBadRequest).JSON(util.MakeResponseWithMsg(err.Error()))
+		}
+		if err := ctx.BodyParser(&req); err != nil {
+			return ctx.Status(http.StatusBadRequest).JSON(util.MakeResponseWithMsg(err.Error()))
+		}
+
+		accountID := ctx.Locals(middlewares.LocalsAccount).(string)
+		res, err := service.UpdateCollection(ctx.Context(), &character.UpdateCollectionRequest{
+			AccountID:    accountID,
+			CollectionID: req.ID,
+			Name:         req.Name,
+			Description:  req.Description,
+			Visibility:   req.Visibility,
+		})
+		if err != nil {
+			return ctx.Status(http.StatusInternalServerError).JSON(util.MakeErrResponse(err))
+		}
+		return ctx.Status(http.StatusOK).JSON(util.MakeResponse(res))
+	}
+}
+
+func deleteCollection(service CollectionHTTPServer) func(ctx *fiber.Ctx) error {
+	return func(ctx *fiber.Ctx) error {
+		var (
+			req struct {
+				ID string `params:"id"`
+			}
+		)
+		if err := ctx.ParamsParser(&req); err != nil {
+			return ctx.Status(http.StatusBadRequest).JSON(util.MakeResponseWithMsg(err.Error()))
+		}
+
+		accountID := ctx.Locals(middlewares.LocalsAccount).(string)
+		err := service.DeleteCollection(ctx.Context(), &character.CollectionRequest{
+			AccountID:    accountID,
+			CollectionID: req.ID,
+		})
+		if err != nil {
+			return ctx.Status(http.StatusInternalServerError).JSON(util.MakeErrResponse(err))
+		}
+		return ctx.Status(http.StatusOK).JSON(util.MakeResponse("ok"))
+	}
+}
+
+func queryCollectionCharacters(service CollectionHTTPServer) func(ctx *fiber.Ctx) error {
+	return func(ctx *fiber.Ctx) error {
+		var (
+			req struct {
+				ID    string `params:"id"`
+				Page  int    `query:"page"`
+				Limit int    `query:"limit"`
+			}
+			res struct {
+				Data  []*character.QueryCharacterResponse `json:"data"`
+				Count int64                               `json:"count"`
+			}
+		)
+		if err := ctx.ParamsParser(&req); err != nil {
+			return ctx.Status(http.StatusBadRequest).JSON(util.MakeResponseWithMsg(err.Error()))
+		}
+		if err := ctx.QueryParser(&req); err != nil {
+			return ctx.Status(http.StatusBadRequest).JSON(util.MakeResponseWithMsg(err.Error()))
+		}
+
+		accountID := ctx.Locals(middlewares.LocalsAccount).(string)
+		data, count, err := service.QueryCollectionCharacters(ctx.Context(), &character.QueryCollectionCharactersRequest{
+			AccountID:    accountID,
+			CollectionID: req.ID,
+			Page:         req.Page,
+			Limit:        req.Limit,
+		})
+		if err != nil {
+			return ctx.Status(http.StatusInternalServerError).JSON(util.MakeErrResponse(err))
+		}
+		res.Data = data
+		res.Count = count
+		return ctx.Status(http.StatusOK).JSON(util.MakeResponse(res))
+	}
+}
+
+func addCollectionCharacter(service CollectionHTTPServer) func(ctx *fiber.Ctx) error {
+	return func(ctx *fiber.Ctx) error {
+		var (
+			req struct {
+				ID          string `params:"id"`
+				CharacterID string `json:"character_id"`
+			}
+		)
+		if err := ctx.ParamsParser(&req); err != nil {
+			return ctx.Status(http.StatusBadRequest).JSON(util.MakeResponseWithMsg(err.Error()))
+		}
+		if err := ctx.BodyParser(&req); err != nil {
+			return ctx.Status(http.StatusBadRequest).JSON(util.MakeResponseWithMsg(err.Error()))
+		}
+
+		accountID := ctx.Locals(middlewares.LocalsAccount).(string)
+		err := service.AddCollectionCharacter(ctx.Context(), &character.CollectionCharacterRequest{
+			AccountID:    accountID,
+			CollectionID: req.ID,
+			CharacterID:  req.CharacterID,
+		})
+		if err != nil {
+			return ctx.Status(http.StatusInternalServerError).JSON(util.MakeErrResponse(err))
+		}
+		return ctx.Status(http.StatusOK).JSON(util.MakeResponse("ok"))
+	}
+}
+
+// sortCollection orders the characters of the collection as the
+// character_ids of the body, which lists all of them.
+func sortCollection(service CollectionHTTPServer) func(ctx *fiber.Ctx) error {
+	return func(ctx *fiber.Ctx) error {
+		var (
+			req struct {
+				ID           string   `params:"id"`
+				CharacterIDs []string `json:"character_ids"`
+			}
+		)
+		if err := ctx.ParamsParser(&req); err != nil {
+			return ctx.Status(http.StatusBadRequest).JSON(util.MakeResponseWithMsg(err.Error()))
+		}
+		if err := ctx.BodyParser(&req); err != nil {
+			return ctx.Status(http.StatusBadRequest).JSON(util.MakeResponseWithMsg(err.Error()))
+		}
+
+		accountID := ctx.Locals(middlewares.LocalsAccount).(string)
+		err := service.SortCollection(ctx.Context(), &character.SortCollectionRequest{
+			AccountID:    accountID,
+			CollectionID: req.ID,
+			CharacterIDs: req.CharacterIDs,
+		})
+		if err != nil {
+			return ctx.Status(http.StatusInternalServerError).JSON(util.MakeErrResponse(err))
+		}
+		return ctx.Status(http.StatusOK).JSON(util.MakeResponse("ok"))
+	}
+}
+
+func removeCollectionCharacter(service CollectionHTTPServer) func(ctx *fiber.Ctx) error {
+	return func(ctx *fiber.Ctx) error {
+		var (
+			req struct {
+				ID          string `params:"id"`
+				CharacterID string `params:"character_id"`
+			}
+		)
+		if err := ctx.ParamsParser(&req); err != nil {
+			return ctx.Status(http.StatusBadRequest).JSON(util.MakeResponseWithMsg(err.Error()))
+		}
+
+		accountID := ctx.Locals(middlewares.LocalsAccount).(string)
+		err := service.RemoveCollectionCharacter(ctx.Context(), &character.CollectionCharacterRequest{
+			AccountID:    accountID,
+			CollectionID: req.ID,
+			CharacterID:  req.CharacterID,
+		})
+		if err != nil {
+			return ctx.Status(http.StatusInternalServerError).JSON(util.MakeErrResponse(err))
+		}
+		return ctx.Status(http.StatusOK).JSON(util.MakeResponse("ok"))
+	}
+}
@@ -0,0 +1,324 @@
+package v1
+
+import (
+	"context"
+	"net/http"
+	"starland-backend/configs"
+	"starland-backend/internal/pkg/middlewares"
+	"starland-backend/internal/pkg/util"
+	"starland-backend/internal/service/character"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type ConversationHTTPServer interface {
+	CreateConversation(context.Context, *character.CreateConversationRequest) (*character.ConversationResponse, error)
+	QueryConversations(context.Context, *character.QueryConversationsRequest) ([]*character.ConversationResponse, int64, error)
+	UpdateConversation(context.Context, *character.UpdateConversationRequest) error
+	DeleteConversation(context.Context, *character.DeleteConversationRequest) error
+	SwitchBranch(context.Context, *character.SwitchBranchRequest) error
+	StreamReply(context.Context, *character.StreamReplyRequest) error
+	CancelReply(context.Context, *character.CancelReplyRequest) error
+	ExportConversation(context.Context, *character.ExportConversationRequest) (*character.ExportConversationResponse, error)
+	ImportConversation(context.Context, *character.ImportConversationRequest) (*character.ConversationResponse, error)
+}
+
+func InitConversationRouter(app fiber.Router, service ConversationHTTPServer, conf *configs.Config) {
+	router := app.Group("/v1")
+
+	authRouter := router.Group("/conversations", middlewares.JwtParse())
+	authRouter.Post("", createConversation(service))
+	authRouter.Get("", queryConversations(service))
+	authRouter.Post("/import", importConversation(service))
+	authRouter.Put("/:id", renameConversation(service))
+	authRouter.Post("/:id/archive", archiveConversation(service))
+	authRouter.Put("/:id/branch", switchBranch(service))
+	authRouter.Get("/:id/stream", resumeReply(service))
+	authRouter.Post("/:id/cancel", cancelReply(service))
+	authRouter.Get("/:id/export", exportConversation(service))
+	authRouter.Delete("/:id", deleteConversation(service))
+}
+
+func createConversation(service ConversationHTTPServer) func(ctx *fiber.Ctx) error {
+	return func(ctx *fiber.Ctx) error {
+		var (
+			req struct {
+				CharacterID string `json:"character_id"`
+				Title       string `json:"title"`
+			}
+		)
+		if err := ctx.BodyParser(&req); err != nil {
+			return ctx.Status(http.StatusBadRequest).JSON(util.MakeResponseWithMsg(err.Error()))
+		}
+
+		accountID := ctx.Locals(middlewares.LocalsAccount).(string)
+		res, err := service.CreateConversation(ctx.Context(), &character.CreateConversationRequest{
+			AccountID:   accountID,
+			CharacterID: req.CharacterID,
+			Title:       req.Title,
+		})
+		if err != nil {
+			return ctx.Status(http.StatusInternalServerError).JSON(util.MakeErrResponse(err))
+		}
+		return ctx.Status(http.StatusOK).JSON(util.MakeResponse(res))
+	}
+}
+
+func queryConversations(service ConversationHTTPServer) func(ctx *fiber.Ctx) error {
+	return func(ctx *fiber.Ctx) error {
+		var (
+			req struct {
+				CharacterID string `query:"character_id"`
+				Archived    bool   `query:"archived"`
+				Page        int    `query:"page"`
+				Limit       int    `query:"limit"`
+			}
+			res struct {
+				Data  []*character.ConversationResponse `json:"data"`
+				Count int64                             `json:"count"`
+			}
+		)
+		if err := ctx.QueryParser(&req); err != nil {
+			return ctx.Status(http.StatusBadRequest).JSON(util.MakeResponseWithMsg(err.Error()))
+		}
+
+		accountID := ctx.Locals(middlewares.LocalsAccount).(string)
+		data, count, err := service.QueryConversations(ctx.Context(), &character.QueryConversationsRequest{
+			AccountID:   accountID,
+			CharacterID: req.CharacterID,
+			Archived:    req.Archived,
+			Page:        req.Page,
+			Limit:       req.Limit,
+		})
+		if err != nil {
+			return ctx.Status(http.StatusInternalServerError).JSON(util.MakeErrResponse(err))
+		}
+		res.Data = data
+		res.Count = count
+		return ctx.Status(http.StatusOK).JSON(util.MakeResponse(res))
+	}
+}
+
+func exportConversation(service ConversationHTTPServer) func(ctx *fiber.Ctx) error {
+	return func(ctx *fiber.Ctx) error {
+		var (
+			req struct {
+				ID     string `params:"id"`
+				Format string `query:"format"`
+			}
+		)
+		if err := ctx.ParamsParser(&req); err != nil {
+			return ctx.Status(http.StatusBadRequest).JSON(util.MakeResponseWithMsg(err.Error()))
+		}
+		if err := ctx.QueryParser(&req); err != nil {
+			return ctx.Status(http.StatusBadRequest).JSON(util.MakeResponseWithMsg(err.Error()))
+		}
+
+		accountID := ctx.Locals(middlewares.LocalsAccount).(string)
+		res, err := service.ExportConversation(ctx.Context(), &character.ExportConversationRequest{
+			AccountID:      accountID,
+			ConversationID: req.ID,
+			Format:         req.Format,
+		})
+		if err != nil {
+			return ctx.Status(http.StatusInternalServerError).JSON(util.MakeErrResponse(err))
+		}
+		ctx.Attachment(res.FileName)
+		ctx.Set(fiber.HeaderContentType, res.ContentType)
+		return ctx.Status(http.StatusOK).Send(res.Body)
+	}
+}
+
+func importConversation(service ConversationHTTPServer) func(ctx *fiber.Ctx) error {
+	return func(ctx *fiber.Ctx) error {
+		var req character.ConversationExport
+		if err := ctx.BodyParser(&req); err != nil {
+			return ctx.Status(http.StatusBadRequest).JSON(util.MakeResponseWithMsg(err.Error()))
+		}
+
+		accountID := ctx.Locals(middlewares.LocalsAccount).(string)
+		res, err := service.ImportConversation(ctx.Context(), &character.ImportConversationRequest{
+			AccountID: accountID,
+			Export:    &req,
+		})
+		if err != nil {
+			return ctx.Status(http.StatusInternalServerError).JSON(util.MakeErrResponse(err))
+		}
+		return ctx.Status(http.StatusOK).JSON(util.MakeResponse(res))
+	}
+}
+
+func renameConversation(service ConversationHTTPServer) func(ctx *fiber.Ctx) error {
+	return func(ctx *fiber.Ctx) error {
+		var (
+			req struct {
+				ID    string `params:"id"`
+				Title string `json:"title"`
+			}
+		)
+		if err := ctx.ParamsParser(&req); err != nil {
+			return ctx.Status(http.StatusBadRequest).JSON(util.MakeResponseWithMsg(err.Error()))
+		}
+		if err := ctx.BodyParser(&req); err != nil {
+			return ctx.Status(http.StatusBadRequest).JSON(util.MakeResponseWithMsg(err.Error()))
+		}
+
+		accountID := ctx.Locals(middlewares.LocalsAccount).(string)
+		err := service.UpdateConversation(ctx.Context(), &character.UpdateConversationRequest{
+			ID:        req.ID,
+			AccountID: accountID,
+			Title:     &req.Title,
+		})
+		if err != nil {
+			return ctx.Status(http.StatusInternalServerError).JSON(util.MakeErrResponse(err))
+		}
+		return ctx.Status(http.StatusOK).JSON(util.MakeResponse("ok"))
+	}
+}
+
+func archiveConversation(service ConversationHTTPServer) func(ctx *fiber.Ctx) error {
+	return func(ctx *fiber.Ctx) error {
+		var (
+			req struct {
+				ID   string `params:"id"`
+				Flag bool   `json:"flag"`
+			}
+		)
+		if err := ctx.ParamsParser(&req); err != nil {
+			return ctx.Status(http.StatusBadRequest).JSON(util.MakeResponseWithMsg(err.Error()))
+		}
+		if err := ctx.BodyParser(&req); err != nil {
+			return ctx.Status(http.StatusBadRequest).JSON(util.MakeResponseWithMsg(err.Error()))
+		}
+
+		accountID := ctx.Locals(middlewares.LocalsAccount).(string)
+		err := service.UpdateConversation(ctx.Context(), &character.UpdateConversationRequest{
+			ID:        req.ID,
+			AccountID: accountID,
+			Archived:  &req.Flag,
+		})
+		if err != nil {
+			return ctx.Status(http.StatusInternalServerError).JSON(util.MakeErrResponse(err))
+		}
+		return ctx.Status(http.StatusOK).JSON(util.MakeResponse("ok"))
+	}
+}
+
+func switchBranch(service ConversationHTTPServer) func(ctx *fiber.Ctx) error {
+	return func(ctx *fiber.Ctx) error {
+		var (
+			req struct {
+				ID        string `params:"id"`
+				MessageID string `json:"message_id"`
+			}
+		)
+		if err := ctx.ParamsParser(&req); err != nil {
+			return ctx.Status(http.StatusBadRequest).JSON(util.MakeResponseWithMsg(err.Error()))
+		}
+		if err := ctx.BodyParser(&req); err != nil {
+			return ctx.Status(http.StatusBadRequest).JSON(util.MakeResponseWithMsg(err.Error()))
+		}
+
+		accountID := ctx.Locals(middlewares.LocalsAccount).(string)
+		err := service.SwitchBranch(ctx.Context(), &character.SwitchBranchRequest{
+			ConversationID: req.ID,
+			AccountID:      accountID,
+			MessageID:      req.MessageID,
+		})
+		if err != nil {
+			return ctx.Status(http.StatusInternalServerError).JSON(util.MakeErrResponse(err))
+		}
+		return ctx.Status(http.StatusOK).JSON(util.MakeResponse("ok"))
+	}
+}
+
+// resumeReply replays a reply from the event after Last-Event-ID, or the
+// latest reply of the conversation from its start, and follows it live.
+func resumeReply(service ConversationHTTPServer) func(ctx *fiber.Ctx) error {
+	return func(ctx *fiber.Ctx) error {
+		var (
+			req struct {
+				ID          string `params:"id"`
+				LastEventID string `query:"last_event_id"`
+			}
+		)
+		if err := ctx.ParamsParser(&req); err != nil {
+			return ctx.Status(http.StatusBadRequest).JSON(util.MakeResponseWithMsg(err.Error()))
+		}
+		if err := ctx.QueryParser(&req); err != nil {
+			return ctx.Status(http.StatusBadRequest).JSON(util.MakeResponseWithMsg(err.Error()))
+		}
+		if id := ctx.Get("Last-Event-ID"); id != "" {
+			req.LastEventID = id
+		}
+
+		accountID := ctx.Locals(middlewares.LocalsAccount).(string)
+		streamCtx, cancel := context.WithCancel(context.Background())
+		resCh := make(chan *character.ReplyEvent)
+		err := service.StreamReply(streamCtx, &character.StreamReplyRequest{
+			AccountID:      accountID,
+			ConversationID: req.ID,
+			LastEventID:    req.LastEventID,
+			ResCh:          resCh,
+		})
+		if err != nil {
+			cancel()
+			return ctx.Status(http.StatusInternalServerError).JSON(util.MakeErrResponse(err))
+		}
+		writeReplyStream(ctx, resCh, cancel)
+		return nil
+	}
+}
+
+func cancelReply(service ConversationHTTPServer) func(ctx *fiber.Ctx) error {
+	return func(ctx *fiber.Ctx) error {
+		var (
+			req struct {
+				ID      string `params:"id"`
+				ReplyID string `json:"reply_id"`
+			}
+		)
+		if err := ctx.ParamsParser(&req); err != nil {
+			return ctx.Status(http.StatusBadRequest).JSON(util.MakeResponseWithMsg(err.Error()))
+		}
+		if len(ctx.Body()) > 0 {
+			if err := ctx.BodyParser(&req); err != nil {
+				return ctx.Status(http.StatusBadRequest).JSON(util.MakeResponseWithMsg(err.Error()))
+			}
+		}
+
+		accountID := ctx.Locals(middlewares.LocalsAccount).(string)
+		err := service.CancelReply(ctx.Context(), &character.CancelReplyRequest{
+			AccountID:      accountID,
+			ConversationID: req.ID,
+			ReplyID:        req.ReplyID,
+		})
+		if err != nil {
+			return ctx.Status(http.StatusInternalServerError).JSON(util.MakeErrResponse(err))
+		}
+		return ctx.Status(http.StatusOK).JSON(util.MakeResponse("ok"))
+	}
+}
+
+func deleteConversation(service ConversationHTTPServer) func(ctx *fiber.Ctx) error {
+	return func(ctx *fiber.Ctx) error {
+		var (
+			req struct {
+				ID string `params:"id"`
+			}
+		)
+		if err := ctx.ParamsParser(&req); err != nil {
+			return ctx.Status(http.StatusBadRequest).JSON(util.MakeResponseWithMsg(err.Error()))
+		}
+
+		accountID := ctx.Locals(middlewares.LocalsAccount).(string)
+		err := service.DeleteConversation(ctx.Context(), &character.DeleteConversationRequest{
+			ID:        req.ID,
+			AccountID: accountID,
+		})
+		if err != nil {
+			return ctx.Status(http.StatusInternalServerError).JSON(util.MakeErrResponse(err))
+		}
+		return ctx.Status(http.StatusOK).JSON(util.MakeResponse("ok"))
+	}
+}
@@ -0,0 +1,169 @@
+package v1
+
+import (
+	"context"
+	"net/http"
+	"starland-backend/configs"
+	"starland-backend/internal/pkg/middlewares"
+	"starland-backend/internal/pkg/util"
+	"starland-backend/internal/service/character"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type CreatorHTTPServer interface {
+	QueryCreatorProfile(context.Context, *character.CreatorRequest) (*character.CreatorProfileResponse, error)
+	QueryCreatorCharacters(context.Context, *character.QueryCreatorCharactersRequest) ([]*character.QueryCharacterResponse, int64, error)
+	FollowCreator(context.Context, *character.CreatorRequest) error
+	UnfollowCreator(context.Context, *character.CreatorRequest) error
+	QueryFollowingFeed(context.Context, *character.QueryFollowingFeedRequest) ([]*character.QueryCharacterResponse, int64, error)
+}
+
+func InitCreatorRouter(app fiber.Router, service CreatorHTTPServer, conf *configs.Config) {
+	router := app.Group("/v1")
+
+	authRouter := router.Group("/creators", middlewares.JwtParse())
+	authRouter.Get("/following/characters", queryFollowingFeed(service))
+	authRouter.Get("/:id", queryCreatorProfile(service))
+	authRouter.Get("/:id/characters", queryCreatorCharacters(service))
+	authRouter.Post("/:id/follow", followCreator(service))
+	authRouter.Delete("/:id/follow", unfollowCreator(service))
+}
+
+func queryCreatorProfile(service CreatorHTTPServer) func(ctx *fiber.Ctx) error {
+	return func(ctx *fiber.Ctx) error {
+		var (
+			req struct {
+				ID string `params:"id"`
+			}
+		)
+		if err := ctx.ParamsParser(&req); err != nil {
+			return ctx.Status(http.StatusBadRequest).JSON(util.MakeResponseWithMsg(err.Error()))
+		}
+
+		accountID := ctx.Locals(middlewares.LocalsAccount).(string)
+		res, err := service.QueryCreatorProfile(ctx.Context(), &character.CreatorRequest{
+			AccountID: accountID,
+			CreatorID: req.ID,
+		})
+		if err != nil {
+			return ctx.Status(http.StatusInternalServerError).JSON(util.MakeErrResponse(err))
+		}
+		return ctx.Status(http.StatusOK).JSON(util.MakeResponse(res))
+	}
+}
+
+func queryCreatorCharacters(service CreatorHTTPServer) func(ctx *fiber.Ctx) error {
+	return func(ctx *fiber.Ctx) error {
+		var (
+			req struct {
+				ID    string `params:"id"`
+				Page  int    `query:"page"`
+				Limit int    `query:"limit"`
+			}
+			res struct {
+				Data  []*character.QueryCharacterResponse `json:"data"`
+				Count int64                               `json:"count"`
+			}
+		)
+		if err := ctx.ParamsParser(&req); err != nil {
+			return ctx.Status(http.StatusBadRequest).JSON(util.MakeResponseWithMsg(err.Error()))
+		}
+		if err := ctx.QueryParser(&req); err != nil {
+			return ctx.Status(http.StatusBadRequest).JSON(util.MakeResponseWithMsg(err.Error()))
+		}
+
+		accountID := ctx.Locals(middlewares.LocalsAccount).(string)
+		data, count, err := service.QueryCreatorCharacters(ctx.Context(), &character.QueryCreatorCharactersRequest{
+			AccountID: accountID,
+			CreatorID: req.ID,
+			Page:      req.Page,
+			Limit:     req.Limit,
+		})
+		if err != nil {
+			return ctx.Status(http.StatusInternalServerError).JSON(util.MakeErrResponse(err))
+		}
+		res.Data = data
+		res.Count = count
+		return ctx.Status(http.StatusOK).JSON(util.MakeResponse(res))
+	}
+}
+
+func followCreator(service CreatorHTTPServer) func(ctx *fiber.Ctx) error {
+	return func(ctx *fiber.Ctx) error {
+		var (
+			req struct {
+				ID string `params:"id"`
+			}
+		)
+		if err := ctx.ParamsParser(&req); err != nil {
+			return ctx.Status(http.StatusBadRequest).JSON(util.MakeResponseWithMsg(err.Error()))
+		}
+
+		accountID := ctx.Locals(middlewares.LocalsAccount).(string)
+		err := service.FollowCreator(ctx.Context(), &character.CreatorRequest{
+			AccountID: accountID,
+			CreatorID: req.ID,
+		})
+		if err != nil {
+			return ctx.Status(http.StatusInternalServerError).JSON(util.MakeErrResponse(err))
+		}
+		return ctx.Status(http.StatusOK).JSON(util.MakeResponse("ok"))
+	}
+}
+
+func unfollowCreator(service CreatorHTTPServer) func(ctx *fiber.Ctx) error {
+	return func(ctx *fiber.Ctx) error {
+		var (
+			req struct {
+				ID string `params:"id"`
+			}
+		)
+		if err := ctx.ParamsParser(&req); err != nil {
+			return ctx.Status(http.StatusBadRequest).JSON(util.MakeResponseWithMsg(err.Error()))
+		}
+
+		accountID := ctx.Locals(middlewares.LocalsAccount).(string)
+		err := service.UnfollowCreator(ctx.Context(), &character.CreatorRequest{
+			AccountID: accountID,
+			CreatorID: req.ID,
+		})
+		if err != nil {
+			return ctx.Status(http.StatusInternalServerError).JSON(util.MakeErrResponse(err))
+		}
+		return ctx.Status(http.StatusOK).JSON(util.MakeResponse("ok"))
+	}
+}
+
+// queryFollowingFeed lists the new characters of the creators the account
+// follows.
+func queryFollowingFeed(service CreatorHTTPServer) func(ctx *fiber.Ctx) error {
+	return func(ctx *fiber.Ctx) error {
+		var (
+			req struct {
+				Page  int `query:"page"`
+				Limit int `query:"limit"`
+			}
+			res struct {
+				Data  []*character.QueryCharacterResponse `json:"data"`
+				Count int64                               `json:"count"`
+			}
+		)
+		if err := ctx.QueryParser(&req); err != nil {
+			return ctx.Status(http.StatusBadRequest).JSON(util.MakeResponseWithMsg(err.Error()))
+		}
+
+		accountID := ctx.Locals(middlewares.LocalsAccount).(string)
+		data, count, err := service.QueryFollowingFeed(ctx.Context(), &character.QueryFollowingFeedRequest{
+			AccountID: accountID,
+			Page:      req.Page,
+			Limit:     req.Limit,
+		})
+		if err != nil {
+			return ctx.Status(http.StatusInternalServerError).JSON(util.MakeErrResponse(err))
+		}
+		res.Data = data
+		res.Count = count
+		return ctx.Status(http.StatusOK).JSON(util.MakeResponse(res))
+	}
+}
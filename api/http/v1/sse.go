@@ -0,0 +1,121 @@
+package v1
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"starland-backend/internal/pkg/util"
+	"starland-backend/internal/service/character"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+	"go.uber.org/zap"
+)
+
+// SSEVersion is bumped whenever the payload of an existing event changes.
+const SSEVersion = 1
+
+// Events written by the streaming endpoints. Every frame carries the event
+// name both in the `event:` field and in the JSON payload so clients reading
+// the raw `data:` lines see the same schema.
+const (
+	SSEEventToken       = character.ReplyEventToken
+	SSEEventImage       = "image"
+	SSEEventSetting     = "setting"
+	SSEEventNeedConfirm = "need_confirm"
+	SSEEventVoice       = character.ReplyEventVoice
+	SSEEventDone        = character.ReplyEventDone
+	SSEEventError       = character.ReplyEventError
+)
+
+type SSEEvent struct {
+	Version int         `json:"version"`
+	ID      string      `json:"id"`
+	Event   string      `json:"event"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+type SSEImageData struct {
+	Images []string `json:"images"`
+	Is3D   bool     `json:"is_3d"`
+	ObjURL string   `json:"obj_url,omitempty"`
+}
+
+type SSENeedConfirmData struct {
+	NeedConfirm bool   `json:"need_confirm"`
+	ConfirmType string `json:"confirm_type,omitempty"`
+}
+
+// sseWriter numbers the events of one stream so a client can tell which
+// event it saw last, unless the events already carry their own ids.
+type sseWriter struct {
+	w  *bufio.Writer
+	id int
+}
+
+func newSSEWriter(w *bufio.Writer) *sseWriter {
+	return &sseWriter{w: w}
+}
+
+func (s *sseWriter) Write(event string, data interface{}) error {
+	s.id++
+	return s.WriteEvent(strconv.Itoa(s.id), event, data)
+}
+
+func (s *sseWriter) WriteEvent(id, event string, data interface{}) error {
+	e := &SSEEvent{
+		Version: SSEVersion,
+		ID:      id,
+		Event:   event,
+		Data:    data,
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("marshal %s event err: %w", event, err)
+	}
+	if _, err = fmt.Fprintf(s.w, "id: %s\nevent: %s\ndata: %s\n\n", e.ID, event, b); err != nil {
+		return err
+	}
+	return s.w.Flush()
+}
+
+func (s *sseWriter) WriteError(err error) error {
+	return s.Write(SSEEventError, util.MakeErrResponse(err))
+}
+
+// settingData keeps the setting chunk as a JSON object when the agent sent
+// one and falls back to the raw string otherwise.
+func settingData(setting string) interface{} {
+	if json.Valid([]byte(setting)) {
+		return json.RawMessage(setting)
+	}
+	return setting
+}
+
+func setSSEHeaders(ctx *fiber.Ctx) {
+	ctx.Context().SetContentType("text/event-stream")
+	ctx.Set("Content-Type", "text/event-stream")
+	ctx.Set("Cache-Control", "no-cache")
+	ctx.Set("Connection", "keep-alive")
+	ctx.Set("Transfer-Encoding", "chunked")
+	ctx.Set("X-Accel-Buffering", "no")
+}
+
+// writeReplyStream forwards the buffered reply events to the client. The
+// reader behind resCh is cancelled once the client is gone, the reply itself
+// keeps being generated and can be resumed with Last-Event-ID.
+func writeReplyStream(ctx *fiber.Ctx, resCh <-chan *character.ReplyEvent, cancel context.CancelFunc) {
+	setSSEHeaders(ctx)
+	ctx.Context().SetBodyStreamWriter(fasthttp.StreamWriter(func(w *bufio.Writer) {
+		defer cancel()
+		sse := newSSEWriter(w)
+		for e := range resCh {
+			if err := sse.WriteEvent(e.ID, e.Event, e.Data); err != nil {
+				zap.S().Errorf("writeReplyStream: write %s err: %v", e.Event, err)
+				return
+			}
+		}
+	}))
+}
@@ -32,7 +32,31 @@ func initApp(cfg *configs.Config) (*service.Service, error) {
 	conversationUsecase := biz.NewConversationUsecase(cfg, conversationRepo)
 	characterVoiceRepo := data.NewCharacterVoiceRepo(cfg, dataData)
 	characterVoiceUsecase := biz.NewCharacterVoiceUsecase(cfg, characterVoiceRepo)
-	characterService := character.NewCharacterService(cfg, imageModelUsecase, characterUsecase, accountAndActivitySerClientUsecase, conversationUsecase, characterVoiceUsecase)
+	messageRepo := data.NewMessageRepo(cfg, dataData)
+	messageUsecase := biz.NewMessageUsecase(cfg, messageRepo)
+	replyRepo := data.NewReplyRepo(cfg, dataData)
+	replyUsecase := biz.NewReplyUsecase(cfg, replyRepo)
+	memoryRepo := data.NewMemoryRepo(cfg, dataData)
+	memoryUsecase := biz.NewMemoryUsecase(cfg, memoryRepo)
+	creationSessionRepo := data.NewCreationSessionRepo(cfg, dataData)
+	creationSessionUsecase := biz.NewCreationSessionUsecase(cfg, creationSessionRepo)
+	characterRevisionRepo := data.NewCharacterRevisionRepo(cfg, dataData)
+	characterRevisionUsecase := biz.NewCharacterRevisionUsecase(cfg, characterRevisionRepo)
+	characterSearcher := data.NewCharacterSearcher(cfg, dataData)
+	characterSearchUsecase := biz.NewCharacterSearchUsecase(cfg, characterSearcher, characterRepo)
+	tagRepo := data.NewTagRepo(cfg, dataData)
+	migrationRepo := data.NewMigrationRepo(cfg, dataData)
+	tagUsecase := biz.NewTagUsecase(cfg, tagRepo, migrationRepo)
+	characterTrendRepo := data.NewCharacterTrendRepo(cfg, dataData)
+	leaseRepo := data.NewLeaseRepo(cfg, dataData)
+	characterTrendUsecase := biz.NewCharacterTrendUsecase(cfg, characterTrendRepo, leaseRepo)
+	characterRecommendationRepo := data.NewCharacterRecommendationRepo(cfg, dataData)
+	characterRecommendationUsecase := biz.NewCharacterRecommendationUsecase(cfg, characterRecommendationRepo, characterRepo, leaseRepo)
+	collectionRepo := data.NewCollectionRepo(cfg, dataData)
+	collectionUsecase := biz.NewCollectionUsecase(cfg, collectionRepo)
+	followRepo := data.NewFollowRepo(cfg, dataData)
+	followUsecase := biz.NewFollowUsecase(cfg, followRepo)
+	characterService := character.NewCharacterService(cfg, imageModelUsecase, characterUsecase, accountAndActivitySerClientUsecase, conversationUsecase, characterVoiceUsecase, messageUsecase, replyUsecase, memoryUsecase, creationSessionUsecase, characterRevisionUsecase, characterSearchUsecase, tagUsecase, characterTrendUsecase, characterRecommendationUsecase, collectionUsecase, followUsecase)
 	serviceService := service.NewService(accountService, characterService)
 	return serviceService, nil
 }
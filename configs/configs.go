@@ -71,9 +71,15 @@ type Config struct {
 	ChatCompletions *AgentEndpointConfig  `mapstructure:"chatCompletions"`
 	Voice           *AgentEndpointConfig  `mapstructure:"voice"`
 	Chat            *AgentEndpointConfig  `mapstructure:"chat"`
+	Agent           *AgentConfig          `mapstructure:"agent"`
 	FeiShuAlertURL  string                `mapstructure:"feiShuAlertUrl"`
 	File            FileConfig            `mapstructure:"file"`
 	Login           *LoginConfig          `mapstructure:"login"`
+	Draft           *DraftConfig          `mapstructure:"draft"`
+	Search          *SearchConfig         `mapstructure:"search"`
+	Trending        *TrendingConfig       `mapstructure:"trending"`
+	Recommendation  *RecommendationConfig `mapstructure:"recommendation"`
+	Taxonomy        *TaxonomyConfig       `mapstructure:"taxonomy"`
 }
 
 type HTTPConfig struct {
@@ -105,15 +111,26 @@ type DBConfig struct {
 	Source string `mapstructure:"source"`
 }
 
+// RedisConfig is the redis of the service. ReaderPoolSize sizes the pool of
+// the client kept for the blocking reads of the reply streams, one
+// connection per client following a reply.
 type RedisConfig struct {
-	Host       string        `mapstructure:"host"`
-	Password   string        `mapstructure:"password"`
-	Expiration time.Duration `mapstructure:"expiration"`
+	Host           string        `mapstructure:"host"`
+	Password       string        `mapstructure:"password"`
+	Expiration     time.Duration `mapstructure:"expiration"`
+	ReaderPoolSize int           `mapstructure:"readerPoolSize"`
 }
 
+// AgentConfig holds the generation defaults used for characters that do not
+// set their own, and how conversations are summarized into memories.
 type AgentConfig struct {
-	MaxChatHistoryContextLength int32   `mapstructure:"maxChatHistoryContextLength"`
-	Temperature                 float32 `mapstructure:"temperature"`
+	MaxChatHistoryContextLength int32         `mapstructure:"maxChatHistoryContextLength"`
+	Temperature                 float32       `mapstructure:"temperature"`
+	MaxReplyLength              int32         `mapstructure:"maxReplyLength"`
+	StopSequences               []string      `mapstructure:"stopSequences"`
+	MemoryInterval              time.Duration `mapstructure:"memoryInterval"`
+	MemoryBatch                 int           `mapstructure:"memoryBatch"`
+	MaxMemories                 int           `mapstructure:"maxMemories"`
 }
 
 type AccountServiceConfig struct {
@@ -134,6 +151,63 @@ type FileConfig struct {
 	VoicePath      string `mapstructure:"voicePath"`
 }
 
+// DraftConfig controls the purge of characters whose creation was abandoned.
+type DraftConfig struct {
+	MaxAge        time.Duration `mapstructure:"maxAge"`
+	PurgeInterval time.Duration `mapstructure:"purgeInterval"`
+}
+
+// SearchConfig picks the engine of the character search, "mysql" for the
+// FULLTEXT index of the characters table or "index" for an index held in
+// memory, rebuilt from the table every RebuildInterval. With several
+// instances the index of each lags behind the edits served by the others by
+// up to RebuildInterval.
+type SearchConfig struct {
+	Engine          string        `mapstructure:"engine"`
+	RebuildInterval time.Duration `mapstructure:"rebuildInterval"`
+}
+
+// TrendingConfig controls the ranking of the trending feed, recomputed
+// every Interval from the activity of the last Window, counted per Bucket
+// and weighted down by half every HalfLife.
+type TrendingConfig struct {
+	Interval time.Duration `mapstructure:"interval"`
+	Window   time.Duration `mapstructure:"window"`
+	Bucket   time.Duration `mapstructure:"bucket"`
+	HalfLife time.Duration `mapstructure:"halfLife"`
+}
+
+// RecommendationConfig controls the co-occurrence model of the character
+// recommendations, recomputed every Interval keeping the Neighbors most
+// similar characters of each. An account counts with at most
+// MaxAccountCharacters characters.
+type RecommendationConfig struct {
+	Interval             time.Duration `mapstructure:"interval"`
+	Neighbors            int           `mapstructure:"neighbors"`
+	MaxAccountCharacters int           `mapstructure:"maxAccountCharacters"`
+}
+
+// TaxonomyConfig is the curated tag taxonomy, written to the db on start.
+// The aliases of a tag are the other spellings folded onto it.
+type TaxonomyConfig struct {
+	Categories []*TagCategoryConfig `mapstructure:"categories"`
+	Tags       []*TagConfig         `mapstructure:"tags"`
+}
+
+type TagCategoryConfig struct {
+	Slug  string            `mapstructure:"slug"`
+	Names map[string]string `mapstructure:"names"`
+	Sort  int               `mapstructure:"sort"`
+}
+
+type TagConfig struct {
+	Slug     string            `mapstructure:"slug"`
+	Category string            `mapstructure:"category"`
+	Names    map[string]string `mapstructure:"names"`
+	Aliases  []string          `mapstructure:"aliases"`
+	Sort     int               `mapstructure:"sort"`
+}
+
 type LoginConfig struct {
 	RedirectURL string      `mapstructure:"redirect_url"`
 	Mail        *MailConfig `mapstructure:"mail"`
@@ -6,4 +6,15 @@ var ProviderSet = wire.NewSet(NewAccountUsecase,
 	NewCharacterUsecase,
 	NewImageModelUsecase,
 	NewConversationUsecase,
-	NewCharacterVoiceUsecase)
+	NewCharacterVoiceUsecase,
+	NewMessageUsecase,
+	NewReplyUsecase,
+	NewMemoryUsecase,
+	NewCreationSessionUsecase,
+	NewCharacterRevisionUsecase,
+	NewCharacterSearchUsecase,
+	NewTagUsecase,
+	NewCharacterTrendUsecase,
+	NewCharacterRecommendationUsecase,
+	NewCollectionUsecase,
+	NewFollowUsecase)
@@ -27,20 +27,45 @@ const (
 	SettingChunk     = 4
 )
 
+// The visibilities of a character. Unlisted characters are left out of the
+// listings but open to anyone with their link, private ones only to the owner.
+const (
+	VisibilityPublic = iota + 1
+	VisibilityUnlisted
+	VisibilityPrivate
+)
+
+// StateUnconfirmed marks a character whose creation is not finished yet.
+const StateUnconfirmed = -1
+
 type CharacterRepo interface {
 	SaveCharacter(context.Context, *CharacterRequest) (string, error)
 	QueryCharacterByID(context.Context, string) (*CharacterResponse, error)
 	QueryCharactersByAccountID(context.Context, string, string, int, int) ([]*CharacterResponse, int64, error)
-	QueryCharactersByNameOrPrompt(context.Context, string, int, int) ([]*CharacterResponse, int64, error)
+	QueryCharactersByNameOrPrompt(context.Context, string, string, string, int, int) ([]*CharacterResponse, int64, error)
 	CharacterMintSave(context.Context, string, string) error
 	UpdateCharacter(context.Context, *UpdateCharacterRequest) error
+	RestoreCharacter(context.Context, *CharacterRevision) error
+	IncreaseForkCount(context.Context, string) error
 	DeleteCharacterByID(context.Context, string) error
+	QueryDraftsByAccountID(context.Context, string, int, int) ([]*CharacterResponse, int64, error)
+	QueryDraftsUpdatedBefore(context.Context, time.Time, int) ([]*CharacterResponse, error)
+	QueryCharactersByIDs(context.Context, []string) ([]*CharacterResponse, error)
+	QueryListedCharacters(context.Context, int, int) ([]*CharacterResponse, error)
+	// QueryPublicCharactersByAccountID pages through the confirmed public
+	// characters of the account, the newest first.
+	QueryPublicCharactersByAccountID(context.Context, string, int, int) ([]*CharacterResponse, int64, error)
+	// QueryFollowedCharacters pages through the confirmed public characters
+	// of the creators the account follows, the newest first.
+	QueryFollowedCharacters(context.Context, string, int, int) ([]*CharacterResponse, int64, error)
+	QueryCreatorStats(context.Context, string) (*CreatorStats, error)
 }
 
 type CharacterAccountLikesRepo interface {
 	QueryCharacterAccountLike(context.Context, string, string) (bool, error)
 	SaveCharacterAccountLike(context.Context, string, string, bool) error
 	QueryCharacterLikeCount(context.Context, string) (int64, error)
+	QueryLikedCharacterIDs(context.Context, string, int, int) ([]string, int64, error)
 }
 
 type CharacterUsecase struct {
@@ -81,6 +106,7 @@ type CharacterRequest struct {
 	Gender       int
 	Prompt       string
 	ImageURL     string
+	ImageURLs    []string
 	LikeCount    int
 	ChatCount    int
 	State        int
@@ -88,6 +114,11 @@ type CharacterRequest struct {
 	Voice        string
 	Introduction string
 	Is3D         bool
+
+	Greeting         string
+	ExampleDialogues []string
+	ForkedFrom       string
+	Visibility       int
 }
 
 type CharacterResponse struct {
@@ -109,7 +140,35 @@ type CharacterResponse struct {
 	Voice        string
 	Is3D         bool
 	Introduction string
+	State        int
+
+	Greeting         string
+	ExampleDialogues []string
+	ForkedFrom       string
+	ForkCount        int
+	Visibility       int
+	Settings         *GenerationSettings
+}
+
+// VisibleTo reports whether the account may see and chat with the character.
+func (c *CharacterResponse) VisibleTo(accountID string) bool {
+	return c.Visibility != VisibilityPrivate || c.AccountID == accountID
+}
+
+// Searchable reports whether the character is finished and listed publicly.
+func (c *CharacterResponse) Searchable() bool {
+	return c.State != StateUnconfirmed && c.Visibility == VisibilityPublic
+}
+
+// GenerationSettings are the generation parameters a creator set on a
+// character, nil fields falling back to the agent defaults of the config.
+type GenerationSettings struct {
+	Temperature    *float32
+	MaxHistory     *int32
+	MaxReplyLength *int32
+	StopSequences  []string
 }
+
 type Tag struct {
 	Key   string
 	Value string
@@ -131,6 +190,11 @@ type ChatRequest struct {
 	CharacterId    string
 	ResCh          chan interface{}
 	CharacterName  string
+	History        []*ChatMessage
+	Settings       *GenerationSettings
+	Memories       []string
+	// ExampleDialogues show the agent how the character talks.
+	ExampleDialogues []string
 }
 
 type ChatResponse struct {
@@ -185,6 +249,11 @@ type UpdateCharacterRequest struct {
 	Name        string
 	Description string
 	Voice       string
+	Visibility  int
+	Settings    *GenerationSettings
+	// Greeting and ExampleDialogues are left as they are when nil.
+	Greeting         *string
+	ExampleDialogues []string
 }
 
 func (uc *CharacterUsecase) ChatCompletions(ctx context.Context, req *ChatCompletionsRequest) (*ChatCompletionResponse, error) {
@@ -378,7 +447,11 @@ func (uc *CharacterUsecase) ChatCompletionsStream(ctx context.Context, req *Chat
 		default:
 			return bizerr.ErrChunkNotExist.Wrap(fmt.Errorf("ChatCompletionsStream: chunk not exists"))
 		}
-		req.ResCh <- data
+		select {
+		case req.ResCh <- data:
+		case <-ctx.Done():
+			return bizerr.ErrInternalError.Wrap(fmt.Errorf("ChatCompletionsStream: %w", ctx.Err()))
+		}
 	}
 	return nil
 }
@@ -394,6 +467,43 @@ func makeChatMessages(req []*character_agent.ChatMessage) []*ChatMessage {
 	return res
 }
 
+// generationSettings fills the settings left unset by the character with the
+// agent defaults of the config.
+func (uc *CharacterUsecase) generationSettings(req *GenerationSettings) *GenerationSettings {
+	res := &GenerationSettings{}
+	if req != nil {
+		*res = *req
+	}
+	var def configs.AgentConfig
+	if uc.conf.Agent != nil {
+		def = *uc.conf.Agent
+	}
+	if res.Temperature == nil {
+		res.Temperature = &def.Temperature
+	}
+	if res.MaxHistory == nil {
+		res.MaxHistory = &def.MaxChatHistoryContextLength
+	}
+	if res.MaxReplyLength == nil {
+		res.MaxReplyLength = &def.MaxReplyLength
+	}
+	if res.StopSequences == nil {
+		res.StopSequences = def.StopSequences
+	}
+	return res
+}
+
+func makeAgentChatMessages(req []*ChatMessage) []*chat_agent.ChatMessage {
+	res := make([]*chat_agent.ChatMessage, len(req))
+	for i := range req {
+		res[i] = &chat_agent.ChatMessage{
+			Role:    req[i].Role,
+			Content: req[i].Content,
+		}
+	}
+	return res
+}
+
 func makeImageMetas(req []*character_agent.ImageMeta) []string {
 	res := make([]string, len(req))
 	for i := range req {
@@ -431,9 +541,65 @@ func (uc *CharacterUsecase) QueryCharactersByAccount(ctx context.Context, id, qu
 	return res, count, nil
 }
 
-func (uc *CharacterUsecase) QueryCharactersByNameOrPrompt(ctx context.Context, query string,
+// QueryCreatorCharacters lists the public characters of the creator, the
+// newest first.
+func (uc *CharacterUsecase) QueryCreatorCharacters(ctx context.Context, accountID string,
 	page, limit int) ([]*CharacterResponse, int64, error) {
-	res, count, err := uc.characterRepo.QueryCharactersByNameOrPrompt(ctx, query, page, limit)
+	res, count, err := uc.characterRepo.QueryPublicCharactersByAccountID(ctx, accountID, page, limit)
+	if err != nil {
+		return nil, count, bizerr.ErrInternalError.Wrap(fmt.Errorf("QueryCreatorCharacters: query characters err: %w", err))
+	}
+	return res, count, nil
+}
+
+// QueryFollowedCharacters lists the public characters of the creators the
+// account follows, the newest first.
+func (uc *CharacterUsecase) QueryFollowedCharacters(ctx context.Context, accountID string,
+	page, limit int) ([]*CharacterResponse, int64, error) {
+	res, count, err := uc.characterRepo.QueryFollowedCharacters(ctx, accountID, page, limit)
+	if err != nil {
+		return nil, count, bizerr.ErrInternalError.Wrap(fmt.Errorf("QueryFollowedCharacters: query characters err: %w", err))
+	}
+	return res, count, nil
+}
+
+// QueryCreatorStats sums up the likes and the chats of the public characters
+// of the creator.
+func (uc *CharacterUsecase) QueryCreatorStats(ctx context.Context, accountID string) (*CreatorStats, error) {
+	res, err := uc.characterRepo.QueryCreatorStats(ctx, accountID)
+	if err != nil {
+		return nil, bizerr.ErrInternalError.Wrap(fmt.Errorf("QueryCreatorStats: [AccountId: %s] query err: %w", accountID, err))
+	}
+	return res, nil
+}
+
+// QueryDrafts returns the characters of the account whose creation was never
+// finished, the most recently touched first.
+func (uc *CharacterUsecase) QueryDrafts(ctx context.Context, accountID string, page, limit int) ([]*CharacterResponse, int64, error) {
+	res, count, err := uc.characterRepo.QueryDraftsByAccountID(ctx, accountID, page, limit)
+	if err != nil {
+		return nil, count, bizerr.ErrInternalError.Wrap(fmt.Errorf("QueryDrafts: query drafts err: %w", err))
+	}
+	return res, count, nil
+}
+
+// QueryExpiredDrafts returns up to limit drafts left untouched for longer than maxAge.
+func (uc *CharacterUsecase) QueryExpiredDrafts(ctx context.Context, maxAge time.Duration, limit int) ([]*CharacterResponse, error) {
+	res, err := uc.characterRepo.QueryDraftsUpdatedBefore(ctx, time.Now().Add(-maxAge), limit)
+	if err != nil {
+		return nil, bizerr.ErrInternalError.Wrap(fmt.Errorf("QueryExpiredDrafts: query drafts err: %w", err))
+	}
+	return res, nil
+}
+
+// QueryCharactersByNameOrPrompt lists the public characters in the order of
+// the feed sort, narrowed to those carrying the tag slug when one is given.
+func (uc *CharacterUsecase) QueryCharactersByNameOrPrompt(ctx context.Context, query, tag, sort string,
+	page, limit int) ([]*CharacterResponse, int64, error) {
+	if err := CheckFeedSort(sort); err != nil {
+		return nil, 0, err
+	}
+	res, count, err := uc.characterRepo.QueryCharactersByNameOrPrompt(ctx, query, tag, sort, page, limit)
 	if err != nil {
 		return nil, count, bizerr.ErrInternalError.Wrap(fmt.Errorf("QueryCharactersByNameOrPrompt: query character to db err: %w", err))
 	}
@@ -456,6 +622,47 @@ func (uc *CharacterUsecase) QueryCharacterLikeByAccount(ctx context.Context, cha
 	return count, nil
 }
 
+// QueryLikedCharacters pages through the characters the account likes, the
+// last liked first.
+func (uc *CharacterUsecase) QueryLikedCharacters(ctx context.Context, accountID string,
+	page, limit int) ([]*CharacterResponse, int64, error) {
+	ids, count, err := uc.characterLikesRepo.QueryLikedCharacterIDs(ctx, accountID, page, limit)
+	if err != nil {
+		return nil, count, bizerr.ErrInternalError.Wrap(fmt.Errorf("QueryLikedCharacters: query likes err: %w", err))
+	}
+	res, err := uc.QueryCharactersByIDs(ctx, ids)
+	if err != nil {
+		return nil, count, fmt.Errorf("QueryLikedCharacters: %w", err)
+	}
+	return res, count, nil
+}
+
+// QueryCharactersByIDs returns the characters in the order of the ids,
+// leaving out the ones that do not exist.
+func (uc *CharacterUsecase) QueryCharactersByIDs(ctx context.Context, ids []string) ([]*CharacterResponse, error) {
+	characters, err := uc.characterRepo.QueryCharactersByIDs(ctx, ids)
+	if err != nil {
+		return nil, bizerr.ErrInternalError.Wrap(fmt.Errorf("QueryCharactersByIDs: query characters err: %w", err))
+	}
+	return orderCharacters(ids, characters), nil
+}
+
+// orderCharacters puts the characters in the order of the ids, dropping the
+// ids of the characters missing.
+func orderCharacters(ids []string, characters []*CharacterResponse) []*CharacterResponse {
+	byID := make(map[string]*CharacterResponse, len(characters))
+	for i := range characters {
+		byID[characters[i].ID] = characters[i]
+	}
+	res := make([]*CharacterResponse, 0, len(ids))
+	for _, id := range ids {
+		if ch, ok := byID[id]; ok {
+			res = append(res, ch)
+		}
+	}
+	return res
+}
+
 func (uc *CharacterUsecase) UpdateCharacterLikeAccountLike(ctx context.Context, characterID, accountID string, flag bool) error {
 	err := uc.characterLikesRepo.SaveCharacterAccountLike(ctx, characterID, accountID, flag)
 	if err != nil {
@@ -496,8 +703,41 @@ func (uc *CharacterUsecase) Chat(ctx context.Context, req *ChatRequest) (*ChatRe
 	return res, nil
 }
 
-func (uc *CharacterUsecase) ChatStream(ctx context.Context, req *ChatRequest) error {
+// Summarize asks the chat agent for the facts worth remembering from the
+// messages, leaving out the ones in memories.
+func (uc *CharacterUsecase) Summarize(ctx context.Context, characterID string, messages []*ChatMessage,
+	memories []string) ([]string, error) {
+	conn, err := uc.chatPoll.Get(ctx)
+	if err != nil {
+		return nil, bizerr.ErrInternalError.Wrap(fmt.Errorf("Summarize: get grpc conn err: %w", err))
+	}
+	defer conn.Close()
+
+	cli := chat_agent.NewAgentClient(conn)
+	resp, err := cli.Summarize(ctx, &chat_agent.SummarizeRequest{
+		CharacterId: characterID,
+		Messages:    makeAgentChatMessages(messages),
+		Memories:    memories,
+	})
+	if err != nil {
+		if status.Code(err) == codes.DeadlineExceeded {
+			err = fmt.Errorf("Summarize: invoke chat agent timeout ")
+		}
+		return nil, bizerr.ErrInternalError.Wrap(fmt.Errorf("Summarize: grpc exec failed err: %w ", err))
+	}
+	if resp.Code != uint32(codes.OK) {
+		return nil, bizerr.ErrInternalError.Wrap(fmt.Errorf("Summarize: grpc res failed err: %s ", resp.ErrMsg))
+	}
+	return resp.Facts, nil
+}
+
+// ChatStream sends the reply chunks on req.ResCh and, when the stream
+// fails, the error as its last value before closing the channel.
+func (uc *CharacterUsecase) ChatStream(ctx context.Context, req *ChatRequest) (err error) {
 	defer func() {
+		if err != nil {
+			req.ResCh <- err
+		}
 		close(req.ResCh)
 		zap.S().Info("ChatStream end")
 	}()
@@ -508,12 +748,28 @@ func (uc *CharacterUsecase) ChatStream(ctx context.Context, req *ChatRequest) er
 	defer conn.Close()
 
 	cli := chat_agent.NewAgentClient(conn)
+	settings := uc.generationSettings(req.Settings)
+	history := req.History
+	if n := int(*settings.MaxHistory); n > 0 && len(history) > n {
+		history = history[len(history)-n:]
+	}
 	grpcReq := &chat_agent.ChatRequest{
 		CharacterId:    req.CharacterId,
 		ConversationId: req.ConversationID,
 		Message:        []byte(req.Message),
-	}
-	zap.S().Infof("ChatStream: req: %+v", grpcReq)
+		Temperature:    *settings.Temperature,
+		History:        makeAgentChatMessages(history),
+		MaxHistory:     *settings.MaxHistory,
+		MaxReplyLength: *settings.MaxReplyLength,
+		StopSequences:  settings.StopSequences,
+		Memories:       req.Memories,
+
+		ExampleDialogues: req.ExampleDialogues,
+	}
+	// the request carries what is remembered of the user, only its shape is
+	// logged.
+	zap.S().Infof("ChatStream: [CharacterId: %s] [ConversationId: %s] message: %d bytes, history: %d, memories: %d",
+		req.CharacterId, req.ConversationID, len(grpcReq.Message), len(grpcReq.History), len(grpcReq.Memories))
 	stream, err := cli.ChatStream(ctx, grpcReq)
 	if err != nil {
 		if status.Code(err) == codes.DeadlineExceeded {
@@ -551,6 +807,22 @@ func (s *CharacterUsecase) UpdateCharacter(ctx context.Context, req *UpdateChara
 	return nil
 }
 
+// RestoreCharacter sets every editable field of the character back to the
+// revision, including the ones the revision left empty.
+func (s *CharacterUsecase) RestoreCharacter(ctx context.Context, rev *CharacterRevision) error {
+	if err := s.characterRepo.RestoreCharacter(ctx, rev); err != nil {
+		return bizerr.ErrInternalError.Wrap(fmt.Errorf("RestoreCharacter: [CharacterId: %s] restore err: %w", rev.CharacterID, err))
+	}
+	return nil
+}
+
+func (s *CharacterUsecase) IncreaseForkCount(ctx context.Context, id string) error {
+	if err := s.characterRepo.IncreaseForkCount(ctx, id); err != nil {
+		return bizerr.ErrInternalError.Wrap(fmt.Errorf("IncreaseForkCount: [CharacterId: %s] update err: %w", id, err))
+	}
+	return nil
+}
+
 func (s *CharacterUsecase) DeleteCharacter(ctx context.Context, id string) error {
 	if err := s.characterRepo.DeleteCharacterByID(ctx, id); err != nil {
 		return bizerr.ErrInternalError.Wrap(err)
@@ -0,0 +1,225 @@
+package biz
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"starland-backend/configs"
+	"starland-backend/internal/pkg/bizerr"
+	"time"
+)
+
+// The defaults of the co-occurrence model when the config leaves them unset.
+const (
+	defaultRecommendNeighbors = 50
+	// defaultMaxAccountCharacters bounds the characters an account adds pairs
+	// for, which grow with the square of them.
+	defaultMaxAccountCharacters = 200
+)
+
+// recommendLease names the lease of the similarity job.
+const recommendLease = "recommendation"
+
+// recommendFallbackPages bounds the pages of the trending feed read to fill
+// the recommendations of an account that talked to most of it.
+const recommendFallbackPages = 5
+
+// CharacterInteraction is an account having liked or talked to a character.
+type CharacterInteraction struct {
+	AccountID   string
+	CharacterID string
+}
+
+// CharacterSimilarity scores how often the accounts that took to a character
+// also took to another one, from 0 to 1.
+type CharacterSimilarity struct {
+	CharacterID string
+	SimilarID   string
+	Score       float64
+}
+
+type CharacterRecommendationRepo interface {
+	// QueryInteractions returns the likes and the conversations of all the
+	// accounts, once per account and character.
+	QueryInteractions(context.Context) ([]*CharacterInteraction, error)
+	// SaveSimilarities replaces the whole similarity table, which stays
+	// readable while it is rewritten.
+	SaveSimilarities(context.Context, []*CharacterSimilarity) error
+	QuerySimilarities(context.Context, []string) ([]*CharacterSimilarity, error)
+	// QueryAccountCharacters returns the characters the account liked and
+	// the ones it talked to.
+	QueryAccountCharacters(context.Context, string) ([]string, []string, error)
+}
+
+type CharacterRecommendationUsecase struct {
+	conf          *configs.Config
+	recommendRepo CharacterRecommendationRepo
+	characterRepo CharacterRepo
+	leaseRepo     LeaseRepo
+}
+
+func NewCharacterRecommendationUsecase(conf *configs.Config, recommendRepo CharacterRecommendationRepo,
+	characterRepo CharacterRepo, leaseRepo LeaseRepo) *CharacterRecommendationUsecase {
+	return &CharacterRecommendationUsecase{conf: conf, recommendRepo: recommendRepo, characterRepo: characterRepo,
+		leaseRepo: leaseRepo}
+}
+
+// ComputeSimilarities rebuilds the item-to-item model: two characters are
+// the more similar the more accounts liked or talked to both, relative to
+// how many took to each (the cosine of their account sets). Only the most
+// similar neighbors of each character are kept. Only the instance holding
+// the lease of the job computes them, for lease long.
+func (uc *CharacterRecommendationUsecase) ComputeSimilarities(ctx context.Context, lease time.Duration) error {
+	ok, err := uc.leaseRepo.AcquireLease(ctx, recommendLease, lease)
+	if err != nil {
+		return bizerr.ErrInternalError.Wrap(fmt.Errorf("ComputeSimilarities: acquire lease err: %w", err))
+	}
+	if !ok {
+		return nil
+	}
+
+	neighbors, maxCharacters := defaultRecommendNeighbors, defaultMaxAccountCharacters
+	if uc.conf.Recommendation != nil {
+		if uc.conf.Recommendation.Neighbors > 0 {
+			neighbors = uc.conf.Recommendation.Neighbors
+		}
+		if uc.conf.Recommendation.MaxAccountCharacters > 0 {
+			maxCharacters = uc.conf.Recommendation.MaxAccountCharacters
+		}
+	}
+
+	interactions, err := uc.recommendRepo.QueryInteractions(ctx)
+	if err != nil {
+		return bizerr.ErrInternalError.Wrap(fmt.Errorf("ComputeSimilarities: query interactions err: %w", err))
+	}
+	byAccount := make(map[string][]string)
+	for _, in := range interactions {
+		byAccount[in.AccountID] = append(byAccount[in.AccountID], in.CharacterID)
+	}
+
+	counts := make(map[string]float64)
+	pairs := make(map[string]map[string]float64)
+	for _, characters := range byAccount {
+		if len(characters) > maxCharacters {
+			characters = characters[:maxCharacters]
+		}
+		for i, a := range characters {
+			counts[a]++
+			for _, b := range characters[i+1:] {
+				if pairs[a] == nil {
+					pairs[a] = make(map[string]float64)
+				}
+				if pairs[b] == nil {
+					pairs[b] = make(map[string]float64)
+				}
+				pairs[a][b]++
+				pairs[b][a]++
+			}
+		}
+	}
+
+	var res []*CharacterSimilarity
+	for a, co := range pairs {
+		similar := make([]*CharacterSimilarity, 0, len(co))
+		for b, n := range co {
+			similar = append(similar, &CharacterSimilarity{
+				CharacterID: a,
+				SimilarID:   b,
+				Score:       n / math.Sqrt(counts[a]*counts[b]),
+			})
+		}
+		sort.Slice(similar, func(i, j int) bool {
+			if similar[i].Score != similar[j].Score {
+				return similar[i].Score > similar[j].Score
+			}
+			return similar[i].SimilarID < similar[j].SimilarID
+		})
+		if len(similar) > neighbors {
+			similar = similar[:neighbors]
+		}
+		res = append(res, similar...)
+	}
+	if err = uc.recommendRepo.SaveSimilarities(ctx, res); err != nil {
+		return bizerr.ErrInternalError.Wrap(fmt.Errorf("ComputeSimilarities: save similarities err: %w", err))
+	}
+	return nil
+}
+
+// RecommendCharacters suggests up to limit listed characters the account has
+// not talked to yet and did not create, those most similar to the ones it
+// liked or talked to first. The trending characters fill in the rest, which
+// is all of it for an account without any history.
+func (uc *CharacterRecommendationUsecase) RecommendCharacters(ctx context.Context, accountID string,
+	limit int) ([]*CharacterResponse, error) {
+	liked, talked, err := uc.recommendRepo.QueryAccountCharacters(ctx, accountID)
+	if err != nil {
+		return nil, bizerr.ErrInternalError.Wrap(fmt.Errorf("RecommendCharacters: [AccountId: %s] query history err: %w", accountID, err))
+	}
+	seen := make(map[string]bool, len(liked)+len(talked))
+	for _, id := range talked {
+		seen[id] = true
+	}
+	seeds := talked
+	for _, id := range liked {
+		if !seen[id] {
+			seeds = append(seeds, id)
+		}
+	}
+
+	similarities, err := uc.recommendRepo.QuerySimilarities(ctx, seeds)
+	if err != nil {
+		return nil, bizerr.ErrInternalError.Wrap(fmt.Errorf("RecommendCharacters: [AccountId: %s] query similarities err: %w", accountID, err))
+	}
+	scores := make(map[string]float64)
+	for _, s := range similarities {
+		if !seen[s.SimilarID] {
+			scores[s.SimilarID] += s.Score
+		}
+	}
+	ids := make([]string, 0, len(scores))
+	for id := range scores {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if scores[ids[i]] != scores[ids[j]] {
+			return scores[ids[i]] > scores[ids[j]]
+		}
+		return ids[i] < ids[j]
+	})
+
+	characters, err := uc.characterRepo.QueryCharactersByIDs(ctx, ids)
+	if err != nil {
+		return nil, bizerr.ErrInternalError.Wrap(fmt.Errorf("RecommendCharacters: query characters err: %w", err))
+	}
+	byID := make(map[string]*CharacterResponse, len(characters))
+	for i := range characters {
+		byID[characters[i].ID] = characters[i]
+	}
+	res := make([]*CharacterResponse, 0, limit)
+	add := func(ch *CharacterResponse) {
+		if len(res) < limit && !seen[ch.ID] && ch.Searchable() && ch.AccountID != accountID {
+			seen[ch.ID] = true
+			res = append(res, ch)
+		}
+	}
+	for _, id := range ids {
+		if ch, ok := byID[id]; ok {
+			add(ch)
+		}
+	}
+
+	for page := 1; len(res) < limit && page <= recommendFallbackPages; page++ {
+		popular, _, err := uc.characterRepo.QueryCharactersByNameOrPrompt(ctx, "", "", FeedSortTrending, page, limit)
+		if err != nil {
+			return nil, bizerr.ErrInternalError.Wrap(fmt.Errorf("RecommendCharacters: query trending err: %w", err))
+		}
+		for i := range popular {
+			add(popular[i])
+		}
+		if len(popular) < limit {
+			break
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,119 @@
+package biz
+
+import (
+	"context"
+	"fmt"
+	"starland-backend/configs"
+	"starland-backend/internal/pkg/bizerr"
+	"time"
+)
+
+// The reasons a character revision was recorded for.
+const (
+	RevisionCreate   = "create"
+	RevisionUpdate   = "update"
+	RevisionRollback = "rollback"
+	// RevisionBaseline is the state of a character from before revisions
+	// were recorded, saved ahead of its first edit.
+	RevisionBaseline = "baseline"
+)
+
+type CharacterRevisionRepo interface {
+	SaveCharacterRevision(context.Context, *CharacterRevision) error
+	QueryCharacterRevisions(context.Context, string, int, int) ([]*CharacterRevision, int64, error)
+	QueryCharacterRevision(context.Context, string, int) (*CharacterRevision, error)
+	QueryLatestCharacterRevision(context.Context, string) (*CharacterRevision, error)
+}
+
+// CharacterRevision is a snapshot of the editable fields of a character.
+// Revisions are append-only, Version counting up from 1 per character.
+type CharacterRevision struct {
+	CharacterID      string
+	Version          int
+	AccountID        string
+	Reason           string
+	RollbackFrom     int
+	Name             string
+	Gender           int
+	Prompt           string
+	Introduction     string
+	ImageURL         string
+	ImageURLs        []string
+	Voice            string
+	Tag              []Tag
+	Is3D             bool
+	Greeting         string
+	ExampleDialogues []string
+	Settings         *GenerationSettings
+	CreateTime       time.Time
+}
+
+type CharacterRevisionUsecase struct {
+	repo CharacterRevisionRepo
+	conf *configs.Config
+}
+
+func NewCharacterRevisionUsecase(conf *configs.Config, repo CharacterRevisionRepo) *CharacterRevisionUsecase {
+	return &CharacterRevisionUsecase{repo: repo, conf: conf}
+}
+
+// RecordRevision appends the current state of the character as its next
+// revision and returns it.
+func (uc *CharacterRevisionUsecase) RecordRevision(ctx context.Context, ch *CharacterResponse, reason string,
+	rollbackFrom int) (*CharacterRevision, error) {
+	rev := &CharacterRevision{
+		CharacterID:      ch.ID,
+		AccountID:        ch.AccountID,
+		Reason:           reason,
+		RollbackFrom:     rollbackFrom,
+		Name:             ch.Name,
+		Gender:           ch.Gender,
+		Prompt:           ch.Prompt,
+		Introduction:     ch.Introduction,
+		ImageURL:         ch.ImageURL,
+		ImageURLs:        ch.ImageURLs,
+		Voice:            ch.Voice,
+		Tag:              ch.Tag,
+		Is3D:             ch.Is3D,
+		Greeting:         ch.Greeting,
+		ExampleDialogues: ch.ExampleDialogues,
+		Settings:         ch.Settings,
+	}
+	if err := uc.repo.SaveCharacterRevision(ctx, rev); err != nil {
+		return nil, bizerr.ErrInternalError.Wrap(fmt.Errorf("RecordRevision: save revision err: %w", err))
+	}
+	return rev, nil
+}
+
+// QueryRevisions returns the revisions of the character, newest first.
+func (uc *CharacterRevisionUsecase) QueryRevisions(ctx context.Context, characterID string, page, limit int) ([]*CharacterRevision, int64, error) {
+	res, count, err := uc.repo.QueryCharacterRevisions(ctx, characterID, page, limit)
+	if err != nil {
+		return nil, count, bizerr.ErrInternalError.Wrap(fmt.Errorf("QueryRevisions: query revisions err: %w", err))
+	}
+	return res, count, nil
+}
+
+func (uc *CharacterRevisionUsecase) QueryRevision(ctx context.Context, characterID string, version int) (*CharacterRevision, error) {
+	res, err := uc.repo.QueryCharacterRevision(ctx, characterID, version)
+	if err != nil {
+		return nil, bizerr.ErrInternalError.Wrap(fmt.Errorf("QueryRevision: query revision err: %w", err))
+	}
+	if res == nil {
+		return nil, bizerr.ErrRevisionNotExist
+	}
+	return res, nil
+}
+
+// QueryLatestVersion returns the version of the newest revision of the
+// character, 0 when none was recorded yet.
+func (uc *CharacterRevisionUsecase) QueryLatestVersion(ctx context.Context, characterID string) (int, error) {
+	res, err := uc.repo.QueryLatestCharacterRevision(ctx, characterID)
+	if err != nil {
+		return 0, bizerr.ErrInternalError.Wrap(fmt.Errorf("QueryLatestVersion: query revision err: %w", err))
+	}
+	if res == nil {
+		return 0, nil
+	}
+	return res.Version, nil
+}
@@ -0,0 +1,130 @@
+package biz
+
+import (
+	"context"
+	"fmt"
+	"starland-backend/configs"
+	"starland-backend/internal/pkg/bizerr"
+)
+
+// The engines a CharacterSearcher can be backed by.
+const (
+	SearchEngineMySQL = "mysql"
+	SearchEngineIndex = "index"
+)
+
+// The orders of the search results. Relevance falls back to popularity when
+// there is no query to rank against.
+const (
+	SearchSortRelevance = "relevance"
+	SearchSortPopular   = "popular"
+)
+
+// searchIndexBatch is the page size the index is rebuilt with.
+const searchIndexBatch = 500
+
+// CharacterSearcher finds the listed characters by their name, introduction,
+// tags and creator name. Only confirmed public characters are searchable.
+type CharacterSearcher interface {
+	// IndexCharacters adds or replaces the characters in the index.
+	IndexCharacters(context.Context, []*CharacterResponse) error
+	RemoveCharacters(context.Context, ...string) error
+	// RebuildIndex replaces the whole index with the characters.
+	RebuildIndex(context.Context, []*CharacterResponse) error
+	// SearchCharacters returns the ids of a page of matches, in order, and
+	// the number of all matches.
+	SearchCharacters(context.Context, *CharacterSearchRequest) ([]string, int64, error)
+}
+
+// CharacterSearchRequest filters on the fields set, Is3D and Minted being
+// ignored when nil and Gender when 0. Tag is the slug of a canonical tag.
+type CharacterSearchRequest struct {
+	Query  string
+	Gender int
+	Is3D   *bool
+	Tag    string
+	Minted *bool
+	Sort   string
+	Page   int
+	Limit  int
+}
+
+type CharacterSearchUsecase struct {
+	conf          *configs.Config
+	searcher      CharacterSearcher
+	characterRepo CharacterRepo
+}
+
+func NewCharacterSearchUsecase(conf *configs.Config, searcher CharacterSearcher,
+	characterRepo CharacterRepo) *CharacterSearchUsecase {
+	return &CharacterSearchUsecase{conf: conf, searcher: searcher, characterRepo: characterRepo}
+}
+
+func (uc *CharacterSearchUsecase) SearchCharacters(ctx context.Context, req *CharacterSearchRequest) ([]*CharacterResponse, int64, error) {
+	switch req.Sort {
+	case "":
+		req.Sort = SearchSortRelevance
+	case SearchSortRelevance, SearchSortPopular:
+	default:
+		return nil, 0, bizerr.ErrBadRequest.Wrap(fmt.Errorf("unknown sort %q", req.Sort))
+	}
+	ids, count, err := uc.searcher.SearchCharacters(ctx, req)
+	if err != nil {
+		return nil, count, bizerr.ErrInternalError.Wrap(fmt.Errorf("SearchCharacters: search err: %w", err))
+	}
+	characters, err := uc.characterRepo.QueryCharactersByIDs(ctx, ids)
+	if err != nil {
+		return nil, count, bizerr.ErrInternalError.Wrap(fmt.Errorf("SearchCharacters: query characters err: %w", err))
+	}
+
+	// keep the order of the search, dropping the characters deleted since
+	// they were indexed.
+	return orderCharacters(ids, characters), count, nil
+}
+
+// Indexed reports whether the search runs on an index of its own, which
+// has to be kept up to date with the characters.
+func (uc *CharacterSearchUsecase) Indexed() bool {
+	return uc.conf.Search != nil && uc.conf.Search.Engine == SearchEngineIndex
+}
+
+// IndexCharacter brings the character up to date in the index, removing it
+// when it is gone or no longer listed.
+func (uc *CharacterSearchUsecase) IndexCharacter(ctx context.Context, id string) error {
+	if !uc.Indexed() {
+		return nil
+	}
+	ch, err := uc.characterRepo.QueryCharacterByID(ctx, id)
+	if err != nil {
+		return bizerr.ErrInternalError.Wrap(fmt.Errorf("IndexCharacter: query character err: %w", err))
+	}
+	if ch == nil || !ch.Searchable() {
+		err = uc.searcher.RemoveCharacters(ctx, id)
+	} else {
+		err = uc.searcher.IndexCharacters(ctx, []*CharacterResponse{ch})
+	}
+	if err != nil {
+		return bizerr.ErrInternalError.Wrap(fmt.Errorf("IndexCharacter: [CharacterId: %s] index err: %w", id, err))
+	}
+	return nil
+}
+
+// RebuildIndex indexes all the listed characters anew, refreshing the
+// like and chat counts the popularity sort relies on.
+func (uc *CharacterSearchUsecase) RebuildIndex(ctx context.Context) error {
+	var characters []*CharacterResponse
+	for page := 1; ; page++ {
+		res, err := uc.characterRepo.QueryListedCharacters(ctx, page, searchIndexBatch)
+		if err != nil {
+			return bizerr.ErrInternalError.Wrap(fmt.Errorf("RebuildIndex: query characters err: %w", err))
+		}
+		characters = append(characters, res...)
+		if len(res) < searchIndexBatch {
+			break
+		}
+	}
+	if err := uc.searcher.RebuildIndex(ctx, characters); err != nil {
+		return bizerr.ErrInternalError.Wrap(fmt.Errorf("RebuildIndex: rebuild err: %w", err))
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package biz
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"starland-backend/configs"
+	"starland-backend/internal/pkg/bizerr"
+	"time"
+)
+
+// The orders of the character feed. The feed keeps its historical order,
+// customized characters first, when no sort is asked for.
+const (
+	FeedSortTrending = "trending"
+	FeedSortNew      = "new"
+	FeedSortTop      = "top"
+)
+
+// The weights of the activity a trending score is made of, starting a
+// conversation counting more than a message in it.
+const (
+	trendLikeWeight         = 3
+	trendConversationWeight = 2
+	trendMessageWeight      = 0.2
+)
+
+// The defaults of the ranking when the config leaves them unset.
+const (
+	defaultTrendWindow   = 7 * 24 * time.Hour
+	defaultTrendBucket   = 24 * time.Hour
+	defaultTrendHalfLife = 48 * time.Hour
+)
+
+// trendLease names the lease of the ranking job.
+const trendLease = "trending"
+
+// CharacterActivity counts what happened to a character over the bucket
+// starting at Time.
+type CharacterActivity struct {
+	CharacterID   string
+	Time          time.Time
+	Likes         int64
+	Conversations int64
+	Messages      int64
+}
+
+type CharacterTrendRepo interface {
+	// QueryCharacterActivity returns the activity of the characters with any
+	// in [from, to), cut into buckets of the duration given from from on.
+	QueryCharacterActivity(context.Context, time.Time, time.Time, time.Duration) ([]*CharacterActivity, error)
+	// SaveTrendingScores replaces the scores of all the characters, the ones
+	// left out scoring 0.
+	SaveTrendingScores(context.Context, map[string]float64) error
+}
+
+type CharacterTrendUsecase struct {
+	conf      *configs.Config
+	trendRepo CharacterTrendRepo
+	leaseRepo LeaseRepo
+}
+
+func NewCharacterTrendUsecase(conf *configs.Config, trendRepo CharacterTrendRepo, leaseRepo LeaseRepo) *CharacterTrendUsecase {
+	return &CharacterTrendUsecase{conf: conf, trendRepo: trendRepo, leaseRepo: leaseRepo}
+}
+
+// CheckFeedSort rejects the sorts the feed does not know.
+func CheckFeedSort(sort string) error {
+	switch sort {
+	case "", FeedSortTrending, FeedSortNew, FeedSortTop:
+		return nil
+	}
+	return bizerr.ErrBadRequest.Wrap(fmt.Errorf("unknown sort %q", sort))
+}
+
+// RankCharacters scores the characters by their activity over the window of
+// the config, cut into buckets whose weight halves every half-life, so that
+// the characters busy lately outrank the ones that were popular long ago.
+// Only the instance holding the lease of the job ranks, for lease long.
+func (uc *CharacterTrendUsecase) RankCharacters(ctx context.Context, lease time.Duration) error {
+	ok, err := uc.leaseRepo.AcquireLease(ctx, trendLease, lease)
+	if err != nil {
+		return bizerr.ErrInternalError.Wrap(fmt.Errorf("RankCharacters: acquire lease err: %w", err))
+	}
+	if !ok {
+		return nil
+	}
+
+	window, bucket, halfLife := defaultTrendWindow, defaultTrendBucket, defaultTrendHalfLife
+	if uc.conf.Trending != nil {
+		if uc.conf.Trending.Window > 0 {
+			window = uc.conf.Trending.Window
+		}
+		if uc.conf.Trending.Bucket > 0 {
+			bucket = uc.conf.Trending.Bucket
+		}
+		if uc.conf.Trending.HalfLife > 0 {
+			halfLife = uc.conf.Trending.HalfLife
+		}
+	}
+
+	now := time.Now()
+	activity, err := uc.trendRepo.QueryCharacterActivity(ctx, now.Add(-window), now, bucket)
+	if err != nil {
+		return bizerr.ErrInternalError.Wrap(fmt.Errorf("RankCharacters: query activity err: %w", err))
+	}
+	scores := make(map[string]float64)
+	for _, a := range activity {
+		// the bucket is weighted by the age of its middle, the newest one
+		// being cut short by now.
+		end := a.Time.Add(bucket)
+		if end.After(now) {
+			end = now
+		}
+		age := now.Sub(a.Time.Add(end.Sub(a.Time) / 2))
+		decay := math.Pow(0.5, float64(age)/float64(halfLife))
+		scores[a.CharacterID] += decay * (trendLikeWeight*float64(a.Likes) +
+			trendConversationWeight*float64(a.Conversations) +
+			trendMessageWeight*float64(a.Messages))
+	}
+	if err = uc.trendRepo.SaveTrendingScores(ctx, scores); err != nil {
+		return bizerr.ErrInternalError.Wrap(fmt.Errorf("RankCharacters: save scores err: %w", err))
+	}
+	return nil
+}
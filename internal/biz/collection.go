@@ -0,0 +1,187 @@
+package biz
+
+import (
+	"context"
+	"fmt"
+	"starland-backend/configs"
+	"starland-backend/internal/pkg/bizerr"
+	"time"
+)
+
+// MaxCollectionCharacters bounds the characters a collection holds.
+const MaxCollectionCharacters = 500
+
+type CollectionRepo interface {
+	CreateCollection(context.Context, *CollectionRequest) (string, error)
+	QueryCollectionByID(context.Context, string) (*CollectionResponse, error)
+	// QueryCollectionsByAccountID pages through the collections of the
+	// account, only the public ones when the bool is set.
+	QueryCollectionsByAccountID(context.Context, string, bool, int, int) ([]*CollectionResponse, int64, error)
+	UpdateCollection(context.Context, *UpdateCollectionRequest) error
+	DeleteCollection(context.Context, string) error
+	// QueryCollectionCharacterIDs returns the characters of the collection
+	// in their order.
+	QueryCollectionCharacterIDs(context.Context, string) ([]string, error)
+	// AddCollectionCharacter puts the character last in the collection, if
+	// it is not in it yet.
+	AddCollectionCharacter(context.Context, string, string) error
+	RemoveCollectionCharacter(context.Context, string, string) error
+	// SortCollectionCharacters orders the characters of the collection as
+	// the ids are.
+	SortCollectionCharacters(context.Context, string, []string) error
+	// RemoveCharacterFromCollections takes the character out of every
+	// collection, but the ones of the account given.
+	RemoveCharacterFromCollections(context.Context, string, string) error
+}
+
+type CollectionRequest struct {
+	AccountID   string
+	Name        string
+	Description string
+	Visibility  int
+}
+
+type CollectionResponse struct {
+	CollectionID   string
+	AccountID      string
+	Name           string
+	Description    string
+	Visibility     int
+	CharacterCount int
+	CreateTime     time.Time
+	UpdateTime     time.Time
+}
+
+// VisibleTo reports whether the account may see the collection, which is
+// only shared when public.
+func (c *CollectionResponse) VisibleTo(accountID string) bool {
+	return c.Visibility == VisibilityPublic || c.AccountID == accountID
+}
+
+// UpdateCollectionRequest changes the fields that are not nil.
+type UpdateCollectionRequest struct {
+	CollectionID string
+	Name         *string
+	Description  *string
+	Visibility   *int
+}
+
+type CollectionUsecase struct {
+	conf *configs.Config
+	repo CollectionRepo
+}
+
+func NewCollectionUsecase(conf *configs.Config, repo CollectionRepo) *CollectionUsecase {
+	return &CollectionUsecase{conf: conf, repo: repo}
+}
+
+func (uc *CollectionUsecase) CreateCollection(ctx context.Context, req *CollectionRequest) (string, error) {
+	id, err := uc.repo.CreateCollection(ctx, req)
+	if err != nil {
+		return "", bizerr.ErrInternalError.Wrap(fmt.Errorf("CreateCollection: create collection err: %w", err))
+	}
+	return id, nil
+}
+
+func (uc *CollectionUsecase) QueryCollection(ctx context.Context, id string) (*CollectionResponse, error) {
+	res, err := uc.repo.QueryCollectionByID(ctx, id)
+	if err != nil {
+		return nil, bizerr.ErrInternalError.Wrap(fmt.Errorf("QueryCollection: query collection err: %w", err))
+	}
+	if res == nil {
+		return nil, bizerr.ErrCollectionNotExist
+	}
+	return res, nil
+}
+
+func (uc *CollectionUsecase) QueryCollections(ctx context.Context, accountID string, publicOnly bool,
+	page, limit int) ([]*CollectionResponse, int64, error) {
+	res, count, err := uc.repo.QueryCollectionsByAccountID(ctx, accountID, publicOnly, page, limit)
+	if err != nil {
+		return nil, count, bizerr.ErrInternalError.Wrap(fmt.Errorf("QueryCollections: query collections err: %w", err))
+	}
+	return res, count, nil
+}
+
+func (uc *CollectionUsecase) UpdateCollection(ctx context.Context, req *UpdateCollectionRequest) error {
+	if err := uc.repo.UpdateCollection(ctx, req); err != nil {
+		return bizerr.ErrInternalError.Wrap(fmt.Errorf("UpdateCollection: update collection err: %w", err))
+	}
+	return nil
+}
+
+func (uc *CollectionUsecase) DeleteCollection(ctx context.Context, id string) error {
+	if err := uc.repo.DeleteCollection(ctx, id); err != nil {
+		return bizerr.ErrInternalError.Wrap(fmt.Errorf("DeleteCollection: delete collection err: %w", err))
+	}
+	return nil
+}
+
+func (uc *CollectionUsecase) QueryCollectionCharacterIDs(ctx context.Context, id string) ([]string, error) {
+	res, err := uc.repo.QueryCollectionCharacterIDs(ctx, id)
+	if err != nil {
+		return nil, bizerr.ErrInternalError.Wrap(fmt.Errorf("QueryCollectionCharacterIDs: query characters err: %w", err))
+	}
+	return res, nil
+}
+
+func (uc *CollectionUsecase) AddCollectionCharacter(ctx context.Context, id, characterID string) error {
+	ids, err := uc.QueryCollectionCharacterIDs(ctx, id)
+	if err != nil {
+		return err
+	}
+	if len(ids) >= MaxCollectionCharacters {
+		return bizerr.ErrLimit.Wrap(fmt.Errorf("a collection holds at most %d characters", MaxCollectionCharacters))
+	}
+	if err = uc.repo.AddCollectionCharacter(ctx, id, characterID); err != nil {
+		return bizerr.ErrInternalError.Wrap(fmt.Errorf("AddCollectionCharacter: [CharacterId: %s] add err: %w", characterID, err))
+	}
+	return nil
+}
+
+func (uc *CollectionUsecase) RemoveCollectionCharacter(ctx context.Context, id, characterID string) error {
+	if err := uc.repo.RemoveCollectionCharacter(ctx, id, characterID); err != nil {
+		return bizerr.ErrInternalError.Wrap(fmt.Errorf("RemoveCollectionCharacter: [CharacterId: %s] remove err: %w", characterID, err))
+	}
+	return nil
+}
+
+// SortCollectionCharacters moves the characters listed first, in the order
+// given, the others following in their former order. The ids that are not in
+// the collection are ignored, since the listing may not show all of it.
+func (uc *CollectionUsecase) SortCollectionCharacters(ctx context.Context, id string, characterIDs []string) error {
+	ids, err := uc.QueryCollectionCharacterIDs(ctx, id)
+	if err != nil {
+		return err
+	}
+	in := make(map[string]bool, len(ids))
+	for _, characterID := range ids {
+		in[characterID] = true
+	}
+	order := make([]string, 0, len(ids))
+	for _, characterID := range characterIDs {
+		if in[characterID] {
+			order = append(order, characterID)
+			delete(in, characterID)
+		}
+	}
+	for _, characterID := range ids {
+		if in[characterID] {
+			order = append(order, characterID)
+		}
+	}
+	if err = uc.repo.SortCollectionCharacters(ctx, id, order); err != nil {
+		return bizerr.ErrInternalError.Wrap(fmt.Errorf("SortCollectionCharacters: sort err: %w", err))
+	}
+	return nil
+}
+
+// RemoveCharacter takes a character out of the collections that may no
+// longer show it, all of them when ownerID is empty, else the ones of the
+// other accounts.
+func (uc *CollectionUsecase) RemoveCharacter(ctx context.Context, characterID, ownerID string) error {
+	if err := uc.repo.RemoveCharacterFromCollections(ctx, characterID, ownerID); err != nil {
+		return bizerr.ErrInternalError.Wrap(fmt.Errorf("RemoveCharacter: [CharacterId: %s] remove err: %w", characterID, err))
+	}
+	return nil
+}
@@ -9,10 +9,24 @@ import (
 )
 
 type ConversationRepo interface {
-	SaveConversation(context.Context, *ConversationRequest) error
+	SaveConversation(context.Context, *ConversationRequest) (string, error)
 	QueryConversationByID(context.Context, string, string) (*ConversationResponse, error)
 	QueryConversationsByAccountID(context.Context, string, int, int) ([]*ConversationResponse, int64, error)
 	QueryConversationsCountByAccountID(context.Context, string) (int64, error)
+	QueryConversationByConversationID(context.Context, string) (*ConversationResponse, error)
+	QueryConversationsByCharacterID(context.Context, string, string, bool, int, int) ([]*ConversationResponse, int64, error)
+	CreateConversation(context.Context, *ConversationRequest) (string, error)
+	// ImportConversation creates the conversation with its messages at once,
+	// each message answering the one before it.
+	ImportConversation(context.Context, *ConversationRequest, []*MessageRequest) (string, error)
+	UpdateConversation(context.Context, *UpdateConversationRequest) error
+	DeleteConversation(context.Context, string) error
+	// QueryConversationsToMemorize returns the conversations updated since
+	// the time given and after they were last summarized.
+	QueryConversationsToMemorize(context.Context, time.Time) ([]*ConversationResponse, error)
+	// UpdateMemorizedAt moves memorized_at from the first time to the second
+	// one, telling whether it still was at the first one.
+	UpdateMemorizedAt(context.Context, string, *time.Time, *time.Time) (bool, error)
 }
 
 type ConversationUsecase struct {
@@ -24,13 +38,30 @@ type ConversationRequest struct {
 	ConversationID string
 	AccountID      string
 	CharacterID    string
+	Title          string
+
+	CharacterVersion int
 }
 
 type ConversationResponse struct {
-	ConversationID string
-	AccountID      string
-	CharacterID    string
-	UpdateTime     time.Time
+	ConversationID  string
+	AccountID       string
+	CharacterID     string
+	Title           string
+	Archived        bool
+	ActiveMessageID string
+	MemorizedAt     *time.Time
+	CreateTime      time.Time
+	UpdateTime      time.Time
+
+	CharacterVersion int
+}
+
+type UpdateConversationRequest struct {
+	ConversationID  string
+	Title           *string
+	Archived        *bool
+	ActiveMessageID *string
 }
 
 func NewConversationUsecase(conf *configs.Config, repo ConversationRepo) *ConversationUsecase {
@@ -46,7 +77,7 @@ func (uc *ConversationUsecase) QueryConversation(ctx context.Context, account, c
 }
 
 func (uc *ConversationUsecase) SaveConversation(ctx context.Context, account, characterID, conversationID string) (string, error) {
-	err := uc.repo.SaveConversation(ctx, &ConversationRequest{
+	id, err := uc.repo.SaveConversation(ctx, &ConversationRequest{
 		ConversationID: conversationID,
 		AccountID:      account,
 		CharacterID:    characterID,
@@ -55,7 +86,7 @@ func (uc *ConversationUsecase) SaveConversation(ctx context.Context, account, ch
 	if err != nil {
 		return "", bizerr.ErrInternalError.Wrap(fmt.Errorf("SaveConversation: save conversation to db err: %w", err))
 	}
-	return conversationID, nil
+	return id, nil
 }
 
 func (uc *ConversationUsecase) QueryConversations(ctx context.Context, accountID string, page, limit int) ([]*ConversationResponse, int64, error) {
@@ -73,3 +104,100 @@ func (uc *ConversationUsecase) QueryConversationsCount(ctx context.Context, acco
 	}
 	return count, nil
 }
+
+func (uc *ConversationUsecase) QueryConversationByID(ctx context.Context, id string) (*ConversationResponse, error) {
+	cr, err := uc.repo.QueryConversationByConversationID(ctx, id)
+	if err != nil {
+		return nil, bizerr.ErrInternalError.Wrap(fmt.Errorf("QueryConversationByID: query conversation err: %w", err))
+	}
+	if cr == nil {
+		return nil, bizerr.ErrConversationNotExist
+	}
+	return cr, nil
+}
+
+func (uc *ConversationUsecase) QueryConversationsByCharacter(ctx context.Context, accountID, characterID string, archived bool,
+	page, limit int) ([]*ConversationResponse, int64, error) {
+	res, count, err := uc.repo.QueryConversationsByCharacterID(ctx, accountID, characterID, archived, page, limit)
+	if err != nil {
+		return nil, count, bizerr.ErrInternalError.Wrap(fmt.Errorf("QueryConversationsByCharacter: query conversations err: %w ", err))
+	}
+	return res, count, nil
+}
+
+func (uc *ConversationUsecase) CreateConversation(ctx context.Context, account, characterID, title string,
+	characterVersion int) (string, error) {
+	id, err := uc.repo.CreateConversation(ctx, &ConversationRequest{
+		AccountID:        account,
+		CharacterID:      characterID,
+		Title:            title,
+		CharacterVersion: characterVersion,
+	})
+	if err != nil {
+		return "", bizerr.ErrInternalError.Wrap(fmt.Errorf("CreateConversation: create conversation err: %w", err))
+	}
+	return id, nil
+}
+
+// ImportConversation restores a transcript into a new conversation, which is
+// left out altogether when any message cannot be saved.
+func (uc *ConversationUsecase) ImportConversation(ctx context.Context, account, characterID, title string,
+	characterVersion int, messages []*MessageRequest) (string, error) {
+	id, err := uc.repo.ImportConversation(ctx, &ConversationRequest{
+		AccountID:        account,
+		CharacterID:      characterID,
+		Title:            title,
+		CharacterVersion: characterVersion,
+	}, messages)
+	if err != nil {
+		return "", bizerr.ErrInternalError.Wrap(fmt.Errorf("ImportConversation: import conversation err: %w", err))
+	}
+	return id, nil
+}
+
+func (uc *ConversationUsecase) RenameConversation(ctx context.Context, id, title string) error {
+	if err := uc.repo.UpdateConversation(ctx, &UpdateConversationRequest{ConversationID: id, Title: &title}); err != nil {
+		return bizerr.ErrInternalError.Wrap(fmt.Errorf("RenameConversation: update conversation err: %w", err))
+	}
+	return nil
+}
+
+func (uc *ConversationUsecase) ArchiveConversation(ctx context.Context, id string, archived bool) error {
+	if err := uc.repo.UpdateConversation(ctx, &UpdateConversationRequest{ConversationID: id, Archived: &archived}); err != nil {
+		return bizerr.ErrInternalError.Wrap(fmt.Errorf("ArchiveConversation: update conversation err: %w", err))
+	}
+	return nil
+}
+
+func (uc *ConversationUsecase) SetActiveMessage(ctx context.Context, id, messageID string) error {
+	if err := uc.repo.UpdateConversation(ctx, &UpdateConversationRequest{ConversationID: id, ActiveMessageID: &messageID}); err != nil {
+		return bizerr.ErrInternalError.Wrap(fmt.Errorf("SetActiveMessage: update conversation err: %w", err))
+	}
+	return nil
+}
+
+func (uc *ConversationUsecase) DeleteConversation(ctx context.Context, id string) error {
+	if err := uc.repo.DeleteConversation(ctx, id); err != nil {
+		return bizerr.ErrInternalError.Wrap(fmt.Errorf("DeleteConversation: delete conversation err: %w", err))
+	}
+	return nil
+}
+
+func (uc *ConversationUsecase) QueryConversationsToMemorize(ctx context.Context, since time.Time) ([]*ConversationResponse, error) {
+	res, err := uc.repo.QueryConversationsToMemorize(ctx, since)
+	if err != nil {
+		return nil, bizerr.ErrInternalError.Wrap(fmt.Errorf("QueryConversationsToMemorize: query conversations err: %w", err))
+	}
+	return res, nil
+}
+
+// SetMemorizedAt records up to when the conversation has been summarized,
+// provided nobody moved it from the time it was read at. Since every
+// instance summarizes, this is how one of them claims a conversation.
+func (uc *ConversationUsecase) SetMemorizedAt(ctx context.Context, id string, from, to *time.Time) (bool, error) {
+	ok, err := uc.repo.UpdateMemorizedAt(ctx, id, from, to)
+	if err != nil {
+		return false, bizerr.ErrInternalError.Wrap(fmt.Errorf("SetMemorizedAt: update conversation err: %w", err))
+	}
+	return ok, nil
+}
@@ -0,0 +1,180 @@
+package biz
+
+import (
+	"context"
+	"fmt"
+	"starland-backend/configs"
+	"starland-backend/internal/pkg/bizerr"
+	"time"
+)
+
+// CreationSessionExpiration is how long a creation session lives after its
+// last change. Abandoned sessions are purged with their candidate images.
+const CreationSessionExpiration = time.Hour
+
+// The stages of the character creation wizard, in the order they are taken.
+const (
+	CreationStageNone = -1
+	CreationStage1    = iota - 1 // chat about the character setting
+	CreationStage2               // confirm the setting, saving the draft character
+	CreationStage3               // choose a voice
+	CreationStage4               // chat about and generate the images
+	CreationStage5               // pick an image, finishing the character
+)
+
+// creationTransitions lists the stages a session may take after each stage.
+// The setting can be discussed again until it is confirmed, the voice can be
+// chosen again until images are generated, and a finished session is closed.
+var creationTransitions = map[int][]int{
+	CreationStageNone: {CreationStage1},
+	CreationStage1:    {CreationStage1, CreationStage2},
+	CreationStage2:    {CreationStage1, CreationStage3},
+	CreationStage3:    {CreationStage3, CreationStage4},
+	CreationStage4:    {CreationStage4, CreationStage5},
+	CreationStage5:    {},
+}
+
+type CreationSessionRepo interface {
+	CreateCreationSession(context.Context, *CreationSession) error
+	QueryCreationSessionByID(context.Context, string) (*CreationSession, error)
+	UpdateCreationSession(context.Context, *CreationSession) error
+	QueryCreationSessionsUpdatedBefore(context.Context, time.Time, int) ([]*CreationSession, error)
+	DeleteCreationSession(context.Context, string) error
+}
+
+type CreationSessionUsecase struct {
+	repo CreationSessionRepo
+	conf *configs.Config
+}
+
+func NewCreationSessionUsecase(conf *configs.Config, repo CreationSessionRepo) *CreationSessionUsecase {
+	return &CreationSessionUsecase{repo: repo, conf: conf}
+}
+
+// CreationSession is the server side state of a creation wizard. Stage is
+// the last stage the session completed.
+type CreationSession struct {
+	SessionID  string
+	AccountID  string
+	Stage      int
+	Images     []string
+	Voice      string
+	Is3D       bool
+	CreateTime time.Time
+	UpdateTime time.Time
+}
+
+func NewCreationSession(sessionID, accountID string) *CreationSession {
+	now := time.Now()
+	return &CreationSession{
+		SessionID:  sessionID,
+		AccountID:  accountID,
+		Stage:      CreationStageNone,
+		CreateTime: now,
+		UpdateTime: now,
+	}
+}
+
+// NextStages returns the stages the session may take next.
+func (s *CreationSession) NextStages() []int {
+	next := make([]int, 0, len(creationTransitions[s.Stage]))
+	for _, stage := range creationTransitions[s.Stage] {
+		if s.CheckStage(stage) == nil {
+			next = append(next, stage)
+		}
+	}
+	return next
+}
+
+// CheckStage reports whether the session may take the stage now.
+func (s *CreationSession) CheckStage(stage int) error {
+	allowed := false
+	for _, next := range creationTransitions[s.Stage] {
+		if next == stage {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return bizerr.ErrBadRequest.Wrap(fmt.Errorf("creation session at stage %d cannot move to stage %d", s.Stage, stage))
+	}
+	if stage == CreationStage5 && len(s.Images) == 0 {
+		return bizerr.ErrBadRequest.Wrap(fmt.Errorf("creation session has no image to pick"))
+	}
+	return nil
+}
+
+// Complete records that the session went through the stage.
+func (s *CreationSession) Complete(stage int) {
+	s.Stage = stage
+	s.UpdateTime = time.Now()
+}
+
+func (uc *CreationSessionUsecase) CreateSession(ctx context.Context, sess *CreationSession) error {
+	if err := uc.repo.CreateCreationSession(ctx, sess); err != nil {
+		return bizerr.ErrInternalError.Wrap(fmt.Errorf("CreateSession: create session err: %w", err))
+	}
+	return nil
+}
+
+// QuerySession returns the session, expired ones are reported as missing
+// even before the purge removed them.
+func (uc *CreationSessionUsecase) QuerySession(ctx context.Context, id string) (*CreationSession, error) {
+	res, err := uc.repo.QueryCreationSessionByID(ctx, id)
+	if err != nil {
+		return nil, bizerr.ErrInternalError.Wrap(fmt.Errorf("QuerySession: query session err: %w", err))
+	}
+	if res == nil || time.Since(res.UpdateTime) > CreationSessionExpiration {
+		return nil, bizerr.ErrSessionNotExist
+	}
+	return res, nil
+}
+
+// RestoreSession brings back the session of a draft. A session that expired
+// but was not purged yet keeps its candidate images and its later stage.
+func (uc *CreationSessionUsecase) RestoreSession(ctx context.Context, sess *CreationSession) error {
+	old, err := uc.repo.QueryCreationSessionByID(ctx, sess.SessionID)
+	if err != nil {
+		return bizerr.ErrInternalError.Wrap(fmt.Errorf("RestoreSession: query session err: %w", err))
+	}
+	if old == nil {
+		if err = uc.repo.CreateCreationSession(ctx, sess); err != nil {
+			return bizerr.ErrInternalError.Wrap(fmt.Errorf("RestoreSession: create session err: %w", err))
+		}
+		return nil
+	}
+
+	sess.Images = old.Images
+	sess.CreateTime = old.CreateTime
+	if old.Stage > sess.Stage && old.Stage < CreationStage5 {
+		sess.Stage = old.Stage
+	}
+	if err = uc.repo.UpdateCreationSession(ctx, sess); err != nil {
+		return bizerr.ErrInternalError.Wrap(fmt.Errorf("RestoreSession: update session err: %w", err))
+	}
+	return nil
+}
+
+func (uc *CreationSessionUsecase) SaveSession(ctx context.Context, sess *CreationSession) error {
+	if err := uc.repo.UpdateCreationSession(ctx, sess); err != nil {
+		return bizerr.ErrInternalError.Wrap(fmt.Errorf("SaveSession: update session err: %w", err))
+	}
+	return nil
+}
+
+// QueryExpiredSessions returns up to limit sessions left untouched for longer
+// than CreationSessionExpiration.
+func (uc *CreationSessionUsecase) QueryExpiredSessions(ctx context.Context, limit int) ([]*CreationSession, error) {
+	res, err := uc.repo.QueryCreationSessionsUpdatedBefore(ctx, time.Now().Add(-CreationSessionExpiration), limit)
+	if err != nil {
+		return nil, bizerr.ErrInternalError.Wrap(fmt.Errorf("QueryExpiredSessions: query sessions err: %w", err))
+	}
+	return res, nil
+}
+
+func (uc *CreationSessionUsecase) DeleteSession(ctx context.Context, id string) error {
+	if err := uc.repo.DeleteCreationSession(ctx, id); err != nil {
+		return bizerr.ErrInternalError.Wrap(fmt.Errorf("DeleteSession: delete session err: %w", err))
+	}
+	return nil
+}
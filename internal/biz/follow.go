@@ -0,0 +1,73 @@
+package biz
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"starland-backend/configs"
+	"starland-backend/internal/pkg/bizerr"
+)
+
+type FollowRepo interface {
+	SaveFollow(context.Context, string, string) error
+	DeleteFollow(context.Context, string, string) error
+	QueryFollow(context.Context, string, string) (bool, error)
+	QueryFollowerCount(context.Context, string) (int64, error)
+	QueryFollowingCount(context.Context, string) (int64, error)
+}
+
+// CreatorStats sums up the public characters of a creator.
+type CreatorStats struct {
+	CharacterCount int64
+	LikeCount      int64
+	ChatCount      int64
+}
+
+type FollowUsecase struct {
+	conf *configs.Config
+	repo FollowRepo
+}
+
+func NewFollowUsecase(conf *configs.Config, repo FollowRepo) *FollowUsecase {
+	return &FollowUsecase{conf: conf, repo: repo}
+}
+
+// Follow makes the follower follow the creator, which it may do only once.
+func (uc *FollowUsecase) Follow(ctx context.Context, followerID, creatorID string) error {
+	if followerID == creatorID {
+		return bizerr.ErrBadRequest.Wrap(errors.New("an account cannot follow itself"))
+	}
+	if err := uc.repo.SaveFollow(ctx, followerID, creatorID); err != nil {
+		return bizerr.ErrInternalError.Wrap(fmt.Errorf("Follow: [CreatorId: %s] save follow err: %w", creatorID, err))
+	}
+	return nil
+}
+
+func (uc *FollowUsecase) Unfollow(ctx context.Context, followerID, creatorID string) error {
+	if err := uc.repo.DeleteFollow(ctx, followerID, creatorID); err != nil {
+		return bizerr.ErrInternalError.Wrap(fmt.Errorf("Unfollow: [CreatorId: %s] delete follow err: %w", creatorID, err))
+	}
+	return nil
+}
+
+func (uc *FollowUsecase) IsFollowing(ctx context.Context, followerID, creatorID string) (bool, error) {
+	ok, err := uc.repo.QueryFollow(ctx, followerID, creatorID)
+	if err != nil {
+		return false, bizerr.ErrInternalError.Wrap(fmt.Errorf("IsFollowing: [CreatorId: %s] query follow err: %w", creatorID, err))
+	}
+	return ok, nil
+}
+
+// QueryFollowCounts returns how many accounts follow the account and how many
+// it follows.
+func (uc *FollowUsecase) QueryFollowCounts(ctx context.Context, accountID string) (int64, int64, error) {
+	followers, err := uc.repo.QueryFollowerCount(ctx, accountID)
+	if err != nil {
+		return 0, 0, bizerr.ErrInternalError.Wrap(fmt.Errorf("QueryFollowCounts: query followers err: %w", err))
+	}
+	following, err := uc.repo.QueryFollowingCount(ctx, accountID)
+	if err != nil {
+		return 0, 0, bizerr.ErrInternalError.Wrap(fmt.Errorf("QueryFollowCounts: query following err: %w", err))
+	}
+	return followers, following, nil
+}
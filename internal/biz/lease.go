@@ -0,0 +1,14 @@
+package biz
+
+import (
+	"context"
+	"time"
+)
+
+// LeaseRepo hands out named leases so that a job every instance schedules is
+// run by one of them at a time.
+type LeaseRepo interface {
+	// AcquireLease takes the lease for ttl, or extends it when this instance
+	// already holds it. It tells whether this instance holds it.
+	AcquireLease(context.Context, string, time.Duration) (bool, error)
+}
@@ -0,0 +1,91 @@
+package biz
+
+import (
+	"context"
+	"fmt"
+	"starland-backend/configs"
+	"starland-backend/internal/pkg/bizerr"
+	"time"
+)
+
+type MemoryRepo interface {
+	SaveMemories(context.Context, []*MemoryRequest) error
+	QueryMemories(context.Context, string, string, int) ([]*MemoryResponse, error)
+	QueryMemoryByID(context.Context, string) (*MemoryResponse, error)
+	DeleteMemory(context.Context, string) error
+	DeleteMemories(context.Context, string, string) error
+}
+
+// MemoryRequest is a fact the character keeps about an account, summarized
+// from the turns of one of their conversations up to SourceTime.
+type MemoryRequest struct {
+	AccountID      string
+	CharacterID    string
+	ConversationID string
+	Content        string
+	SourceTime     time.Time
+}
+
+type MemoryResponse struct {
+	MemoryID       string
+	AccountID      string
+	CharacterID    string
+	ConversationID string
+	Content        string
+	SourceTime     time.Time
+	CreateTime     time.Time
+}
+
+type MemoryUsecase struct {
+	repo MemoryRepo
+	conf *configs.Config
+}
+
+func NewMemoryUsecase(conf *configs.Config, repo MemoryRepo) *MemoryUsecase {
+	return &MemoryUsecase{repo: repo, conf: conf}
+}
+
+func (uc *MemoryUsecase) SaveMemories(ctx context.Context, req []*MemoryRequest) error {
+	if len(req) == 0 {
+		return nil
+	}
+	if err := uc.repo.SaveMemories(ctx, req); err != nil {
+		return bizerr.ErrInternalError.Wrap(fmt.Errorf("SaveMemories: save memories err: %w", err))
+	}
+	return nil
+}
+
+// QueryMemories returns the newest memories of the account about the
+// character, at most limit of them when limit is positive.
+func (uc *MemoryUsecase) QueryMemories(ctx context.Context, accountID, characterID string, limit int) ([]*MemoryResponse, error) {
+	res, err := uc.repo.QueryMemories(ctx, accountID, characterID, limit)
+	if err != nil {
+		return nil, bizerr.ErrInternalError.Wrap(fmt.Errorf("QueryMemories: query memories err: %w", err))
+	}
+	return res, nil
+}
+
+func (uc *MemoryUsecase) QueryMemory(ctx context.Context, id string) (*MemoryResponse, error) {
+	res, err := uc.repo.QueryMemoryByID(ctx, id)
+	if err != nil {
+		return nil, bizerr.ErrInternalError.Wrap(fmt.Errorf("QueryMemory: query memory err: %w", err))
+	}
+	if res == nil {
+		return nil, bizerr.ErrMemoryNotExist
+	}
+	return res, nil
+}
+
+func (uc *MemoryUsecase) DeleteMemory(ctx context.Context, id string) error {
+	if err := uc.repo.DeleteMemory(ctx, id); err != nil {
+		return bizerr.ErrInternalError.Wrap(fmt.Errorf("DeleteMemory: delete memory err: %w", err))
+	}
+	return nil
+}
+
+func (uc *MemoryUsecase) DeleteMemories(ctx context.Context, accountID, characterID string) error {
+	if err := uc.repo.DeleteMemories(ctx, accountID, characterID); err != nil {
+		return bizerr.ErrInternalError.Wrap(fmt.Errorf("DeleteMemories: delete memories err: %w", err))
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+package biz
+
+import (
+	"context"
+	"fmt"
+	"starland-backend/configs"
+	"starland-backend/internal/pkg/bizerr"
+	"time"
+)
+
+const (
+	MessageRoleUser      = "user"
+	MessageRoleAssistant = "assistant"
+)
+
+type MessageRepo interface {
+	SaveMessage(context.Context, *MessageRequest) (string, error)
+	QueryMessageByID(context.Context, string) (*MessageResponse, error)
+	QueryMessagesByConversationID(context.Context, string) ([]*MessageResponse, error)
+	QueryLatestMessageID(context.Context, string) (string, error)
+	// QueryBranchMessages returns a page of the branch ending at a message,
+	// counted from that message, and how long the branch is.
+	QueryBranchMessages(context.Context, string, string, int, int) ([]*MessageResponse, int64, error)
+	DeleteMessagesByConversationID(context.Context, string) error
+}
+
+type MessageUsecase struct {
+	repo MessageRepo
+	conf *configs.Config
+}
+
+type MessageRequest struct {
+	ConversationID string
+	ParentID       string
+	AccountID      string
+	CharacterID    string
+	Role           string
+	Content        string
+	VoiceURL       string
+	TokenCount     int
+	Truncated      bool
+	// CreateTime dates a message restored from an export, the message being
+	// dated when it is saved otherwise.
+	CreateTime time.Time
+}
+
+type MessageResponse struct {
+	MessageID      string
+	ConversationID string
+	ParentID       string
+	AccountID      string
+	CharacterID    string
+	Role           string
+	Content        string
+	VoiceURL       string
+	TokenCount     int
+	Truncated      bool
+	SiblingIDs     []string
+	CreateTime     time.Time
+	UpdateTime     time.Time
+}
+
+// MessageTree holds every message of a conversation. Each message points at
+// the message it answers, so regenerated replies and edited turns end up as
+// siblings under the same parent.
+type MessageTree struct {
+	messages map[string]*MessageResponse
+	children map[string][]*MessageResponse
+	latest   *MessageResponse
+}
+
+func NewMessageUsecase(conf *configs.Config, repo MessageRepo) *MessageUsecase {
+	return &MessageUsecase{repo: repo, conf: conf}
+}
+
+func (uc *MessageUsecase) SaveMessage(ctx context.Context, req *MessageRequest) (string, error) {
+	id, err := uc.repo.SaveMessage(ctx, req)
+	if err != nil {
+		return "", bizerr.ErrInternalError.Wrap(fmt.Errorf("SaveMessage: save message to db err: %w", err))
+	}
+	return id, nil
+}
+
+func (uc *MessageUsecase) QueryMessage(ctx context.Context, id string) (*MessageResponse, error) {
+	res, err := uc.repo.QueryMessageByID(ctx, id)
+	if err != nil {
+		return nil, bizerr.ErrInternalError.Wrap(fmt.Errorf("QueryMessage: query message err: %w", err))
+	}
+	if res == nil {
+		return nil, bizerr.ErrMessageNotExist
+	}
+	return res, nil
+}
+
+func (uc *MessageUsecase) QueryMessageTree(ctx context.Context, conversationID string) (*MessageTree, error) {
+	res, err := uc.repo.QueryMessagesByConversationID(ctx, conversationID)
+	if err != nil {
+		return nil, bizerr.ErrInternalError.Wrap(fmt.Errorf("QueryMessageTree: query messages by conversation err: %w", err))
+	}
+	return NewMessageTree(res), nil
+}
+
+// QueryBranch returns the messages of the branch ending at the leaf, page
+// after page from the leaf up, each page being ordered from the root down.
+// The branch of the latest message is read when the leaf is not found.
+func (uc *MessageUsecase) QueryBranch(ctx context.Context, conversationID, leafID string,
+	page, limit int) ([]*MessageResponse, int64, error) {
+	if page < 1 {
+		page = 1
+	}
+	res, count, err := uc.repo.QueryBranchMessages(ctx, conversationID, leafID, (page-1)*limit, limit)
+	if err != nil {
+		return nil, 0, bizerr.ErrInternalError.Wrap(fmt.Errorf("QueryBranch: query branch err: %w", err))
+	}
+	if count > 0 {
+		return res, count, nil
+	}
+
+	latest, err := uc.repo.QueryLatestMessageID(ctx, conversationID)
+	if err != nil {
+		return nil, 0, bizerr.ErrInternalError.Wrap(fmt.Errorf("QueryBranch: query latest message err: %w", err))
+	}
+	if latest == "" || latest == leafID {
+		return res, count, nil
+	}
+	res, count, err = uc.repo.QueryBranchMessages(ctx, conversationID, latest, (page-1)*limit, limit)
+	if err != nil {
+		return nil, 0, bizerr.ErrInternalError.Wrap(fmt.Errorf("QueryBranch: query branch err: %w", err))
+	}
+	return res, count, nil
+}
+
+func (uc *MessageUsecase) DeleteMessages(ctx context.Context, conversationID string) error {
+	if err := uc.repo.DeleteMessagesByConversationID(ctx, conversationID); err != nil {
+		return bizerr.ErrInternalError.Wrap(fmt.Errorf("DeleteMessages: delete messages by conversation err: %w", err))
+	}
+	return nil
+}
+
+// NewMessageTree builds the tree from messages sorted by creation time.
+func NewMessageTree(messages []*MessageResponse) *MessageTree {
+	t := &MessageTree{
+		messages: make(map[string]*MessageResponse, len(messages)),
+		children: make(map[string][]*MessageResponse),
+	}
+	for i := range messages {
+		t.messages[messages[i].MessageID] = messages[i]
+		t.children[messages[i].ParentID] = append(t.children[messages[i].ParentID], messages[i])
+		t.latest = messages[i]
+	}
+	return t
+}
+
+func (t *MessageTree) Message(id string) (*MessageResponse, bool) {
+	m, ok := t.messages[id]
+	return m, ok
+}
+
+// Leaf follows the newest reply below the message until it reaches the end
+// of that branch. An empty id returns the most recent message.
+func (t *MessageTree) Leaf(id string) string {
+	if id == "" {
+		if t.latest == nil {
+			return ""
+		}
+		return t.latest.MessageID
+	}
+	for {
+		children := t.children[id]
+		if len(children) == 0 {
+			return id
+		}
+		id = children[len(children)-1].MessageID
+	}
+}
+
+// Branch returns the messages from the root down to the leaf, each carrying
+// the ids of its siblings so the client can switch between them.
+func (t *MessageTree) Branch(leafID string) []*MessageResponse {
+	res := make([]*MessageResponse, 0)
+	for id := leafID; id != ""; {
+		m, ok := t.messages[id]
+		if !ok {
+			break
+		}
+		siblings := t.children[m.ParentID]
+		m.SiblingIDs = make([]string, len(siblings))
+		for i := range siblings {
+			m.SiblingIDs[i] = siblings[i].MessageID
+		}
+		res = append(res, m)
+		id = m.ParentID
+	}
+
+	for i, j := 0, len(res)-1; i < j; i, j = i+1, j-1 {
+		res[i], res[j] = res[j], res[i]
+	}
+	return res
+}
@@ -0,0 +1,13 @@
+package biz
+
+import "context"
+
+// MigrationRepo records the one-off data migrations, so that a single
+// instance runs each of them once.
+type MigrationRepo interface {
+	// ClaimMigration tells whether the migration was not claimed yet, in
+	// which case it now is.
+	ClaimMigration(context.Context, string) (bool, error)
+	// ReleaseMigration gives a failed migration back to the next start.
+	ReleaseMigration(context.Context, string) error
+}
@@ -0,0 +1,170 @@
+package biz
+
+import (
+	"context"
+	"fmt"
+	"starland-backend/configs"
+	"starland-backend/internal/pkg/bizerr"
+	"strings"
+	"time"
+)
+
+const (
+	// ReplyExpiration is how long a reply stays buffered after its last event.
+	ReplyExpiration = 10 * time.Minute
+	// ReplyReadBlock bounds one blocking read so readers can notice they
+	// were cancelled.
+	ReplyReadBlock = 5 * time.Second
+	// InflightCheckInterval is how often a running stream looks for a cancel
+	// or a reader, whichever instance they came through.
+	InflightCheckInterval = time.Second
+	// InflightExpiration is how long a stream stays registered once its
+	// instance stopped refreshing it, e.g. because it crashed.
+	InflightExpiration = 10 * time.Second
+)
+
+type ReplyRepo interface {
+	// AppendReplyEvent buffers the event. With a positive expiration the
+	// buffer is also extended and made the latest reply of the conversation.
+	AppendReplyEvent(context.Context, string, string, *ReplyEvent, time.Duration) (string, error)
+	ReadReplyEvents(context.Context, string, string, string, time.Duration) ([]*ReplyEvent, error)
+	QueryLatestReply(context.Context, string) (string, error)
+	// SaveInflight registers a running stream of the account, resets its
+	// cancel and, with a positive reader timeout, gives a first reader that
+	// long to show up.
+	SaveInflight(context.Context, string, string, time.Duration, time.Duration) error
+	// RefreshInflight keeps a stream registered and tells whether it was
+	// cancelled and whether it still has a reader.
+	RefreshInflight(context.Context, string, time.Duration) (bool, bool, error)
+	DeleteInflight(context.Context, string) error
+	// QueryInflight returns the owner of a running stream, empty when none.
+	QueryInflight(context.Context, string) (string, error)
+	CancelInflight(context.Context, string, time.Duration) error
+	TouchInflightReader(context.Context, string, time.Duration) error
+}
+
+// ReplyEvent is one buffered event of an assistant reply. ID is the position
+// of the event in the buffer of its reply.
+type ReplyEvent struct {
+	ID    string
+	Event string
+	Data  string
+}
+
+type ReplyUsecase struct {
+	repo ReplyRepo
+	conf *configs.Config
+}
+
+func NewReplyUsecase(conf *configs.Config, repo ReplyRepo) *ReplyUsecase {
+	return &ReplyUsecase{repo: repo, conf: conf}
+}
+
+// AppendReplyEvent buffers an event of the reply. Every generated answer has
+// its own reply id, so a regenerated turn does not replay the former answer.
+// Only the events asking to refresh extend the buffer by ReplyExpiration and
+// make it the latest reply of the conversation, which the first and the last
+// events of a reply have to do.
+func (uc *ReplyUsecase) AppendReplyEvent(ctx context.Context, conversationID, replyID string, event *ReplyEvent,
+	refresh bool) (string, error) {
+	var expiration time.Duration
+	if refresh {
+		expiration = ReplyExpiration
+	}
+	id, err := uc.repo.AppendReplyEvent(ctx, conversationID, replyID, event, expiration)
+	if err != nil {
+		return "", bizerr.ErrInternalError.Wrap(fmt.Errorf("AppendReplyEvent: append reply event err: %w", err))
+	}
+	return id, nil
+}
+
+// ReadReplyEvents returns the events buffered after afterID, waiting up to
+// ReplyReadBlock for new ones. An empty afterID reads from the beginning.
+func (uc *ReplyUsecase) ReadReplyEvents(ctx context.Context, conversationID, replyID, afterID string) ([]*ReplyEvent, error) {
+	if afterID == "" {
+		afterID = "0"
+	}
+	res, err := uc.repo.ReadReplyEvents(ctx, conversationID, replyID, afterID, ReplyReadBlock)
+	if err != nil {
+		return nil, bizerr.ErrInternalError.Wrap(fmt.Errorf("ReadReplyEvents: read reply events err: %w", err))
+	}
+	return res, nil
+}
+
+func (uc *ReplyUsecase) QueryLatestReply(ctx context.Context, conversationID string) (string, error) {
+	replyID, err := uc.repo.QueryLatestReply(ctx, conversationID)
+	if err != nil {
+		return "", bizerr.ErrInternalError.Wrap(fmt.Errorf("QueryLatestReply: query latest reply err: %w", err))
+	}
+	if replyID == "" {
+		return "", bizerr.ErrReplyNotExist
+	}
+	return replyID, nil
+}
+
+// StartInflight registers a stream produced by this instance so that it can
+// be cancelled, or kept alive by its readers, through any instance.
+func (uc *ReplyUsecase) StartInflight(ctx context.Context, key, accountID string, readerTimeout time.Duration) error {
+	if err := uc.repo.SaveInflight(ctx, key, accountID, InflightExpiration, readerTimeout); err != nil {
+		return bizerr.ErrInternalError.Wrap(fmt.Errorf("StartInflight: [Key: %s] save inflight err: %w", key, err))
+	}
+	return nil
+}
+
+// CheckInflight tells whether the stream was cancelled and whether anybody
+// still reads it.
+func (uc *ReplyUsecase) CheckInflight(ctx context.Context, key string) (bool, bool, error) {
+	cancelled, read, err := uc.repo.RefreshInflight(ctx, key, InflightExpiration)
+	if err != nil {
+		return false, false, bizerr.ErrInternalError.Wrap(fmt.Errorf("CheckInflight: [Key: %s] refresh inflight err: %w", key, err))
+	}
+	return cancelled, read, nil
+}
+
+func (uc *ReplyUsecase) StopInflight(ctx context.Context, key string) error {
+	if err := uc.repo.DeleteInflight(ctx, key); err != nil {
+		return bizerr.ErrInternalError.Wrap(fmt.Errorf("StopInflight: [Key: %s] delete inflight err: %w", key, err))
+	}
+	return nil
+}
+
+// CancelInflight asks the instance producing the stream to stop it, which it
+// notices within InflightCheckInterval.
+func (uc *ReplyUsecase) CancelInflight(ctx context.Context, key, accountID string) error {
+	owner, err := uc.repo.QueryInflight(ctx, key)
+	if err != nil {
+		return bizerr.ErrInternalError.Wrap(fmt.Errorf("CancelInflight: [Key: %s] query inflight err: %w", key, err))
+	}
+	if owner == "" {
+		return bizerr.ErrReplyNotExist
+	}
+	if owner != accountID {
+		return bizerr.ErrNoPermissionToModify
+	}
+	if err = uc.repo.CancelInflight(ctx, key, InflightExpiration); err != nil {
+		return bizerr.ErrInternalError.Wrap(fmt.Errorf("CancelInflight: [Key: %s] cancel inflight err: %w", key, err))
+	}
+	return nil
+}
+
+// TouchInflightReader records that the stream is being read, for timeout.
+func (uc *ReplyUsecase) TouchInflightReader(ctx context.Context, key string, timeout time.Duration) error {
+	if err := uc.repo.TouchInflightReader(ctx, key, timeout); err != nil {
+		return bizerr.ErrInternalError.Wrap(fmt.Errorf("TouchInflightReader: [Key: %s] touch reader err: %w", key, err))
+	}
+	return nil
+}
+
+// MakeReplyEventID joins the reply and the buffer position so a single
+// Last-Event-ID is enough to resume a reply.
+func MakeReplyEventID(replyID, id string) string {
+	return fmt.Sprintf("%s:%s", replyID, id)
+}
+
+func ParseReplyEventID(eventID string) (string, string, error) {
+	replyID, id, ok := strings.Cut(eventID, ":")
+	if !ok || replyID == "" || id == "" {
+		return "", "", bizerr.ErrBadRequest.Wrap(fmt.Errorf("invalid event id %q", eventID))
+	}
+	return replyID, id, nil
+}
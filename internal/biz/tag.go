@@ -0,0 +1,227 @@
+package biz
+
+import (
+	"context"
+	"fmt"
+	"starland-backend/configs"
+	"starland-backend/internal/pkg/bizerr"
+	"strings"
+	"unicode"
+)
+
+// DefaultTagLocale names the tags and categories that have no name in the
+// locale asked for.
+const DefaultTagLocale = "en"
+
+// tagBackfill names the migration mapping the tags of the characters saved
+// before the taxonomy onto it.
+const tagBackfill = "normalize-character-tags"
+
+// tagBackfillBatch is the number of characters the backfill reads at once.
+const tagBackfillBatch = 200
+
+type TagRepo interface {
+	QueryTagCategories(context.Context) ([]*TagCategory, error)
+	QueryCategorizedTags(context.Context) ([]*TaxonomyTag, error)
+	QueryTagByAlias(context.Context, string) (*TaxonomyTag, error)
+	// SaveTag creates the tag with its slug as its first alias, leaving an
+	// existing tag of the same slug as it is.
+	SaveTag(context.Context, *TaxonomyTag) error
+	// SaveTagCategory creates or updates the category.
+	SaveTagCategory(context.Context, *TagCategory) error
+	// SaveCuratedTag creates or updates the tag and points its slug and the
+	// aliases given at it, even those that meant another tag so far.
+	SaveCuratedTag(context.Context, *TaxonomyTag, []string) error
+	// QueryCharacterTags returns the tags of the characters after the id
+	// given, by id.
+	QueryCharacterTags(context.Context, string, int) ([]*CharacterTags, error)
+	UpdateCharacterTags(context.Context, string, map[string]string) error
+}
+
+// CharacterTags are the tags of a character, keyed as they are stored.
+type CharacterTags struct {
+	CharacterID string
+	Tags        map[string]string
+}
+
+// TagCategory groups the tags browsed together, such as genres or moods.
+type TagCategory struct {
+	Slug  string
+	Names map[string]string
+	Sort  int
+}
+
+// TaxonomyTag is the canonical form of a tag. Every spelling of it met so
+// far is one of its aliases, all of them normalized by NormalizeTag.
+type TaxonomyTag struct {
+	Slug     string
+	Category string
+	Names    map[string]string
+	Sort     int
+}
+
+// Name returns the name of the tag in the locale, falling back to the
+// default locale and then to the slug.
+func (t *TaxonomyTag) Name(locale string) string {
+	return localizedName(t.Names, locale, t.Slug)
+}
+
+func (c *TagCategory) Name(locale string) string {
+	return localizedName(c.Names, locale, c.Slug)
+}
+
+func localizedName(names map[string]string, locale, fallback string) string {
+	if name := names[locale]; name != "" {
+		return name
+	}
+	if name := names[DefaultTagLocale]; name != "" {
+		return name
+	}
+	return fallback
+}
+
+// NormalizeTag folds the spellings of a tag onto one key: lower-cased, its
+// words joined by single dashes.
+func NormalizeTag(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(c rune) bool {
+		return !unicode.IsLetter(c) && !unicode.IsDigit(c)
+	})
+	return strings.Join(words, "-")
+}
+
+type TagUsecase struct {
+	conf          *configs.Config
+	repo          TagRepo
+	migrationRepo MigrationRepo
+}
+
+func NewTagUsecase(conf *configs.Config, repo TagRepo, migrationRepo MigrationRepo) *TagUsecase {
+	return &TagUsecase{conf: conf, repo: repo, migrationRepo: migrationRepo}
+}
+
+// NormalizeTags maps free-form tags onto the taxonomy, keyed by the slug of
+// their canonical tag and named in the default locale. Tags never met before
+// join the taxonomy uncategorized, to be curated later.
+func (uc *TagUsecase) NormalizeTags(ctx context.Context, tags map[string]string) (map[string]string, error) {
+	res := make(map[string]string, len(tags))
+	for _, text := range tags {
+		alias := NormalizeTag(text)
+		if alias == "" {
+			continue
+		}
+		tag, err := uc.repo.QueryTagByAlias(ctx, alias)
+		if err != nil {
+			return nil, bizerr.ErrInternalError.Wrap(fmt.Errorf("NormalizeTags: [Tag: %s] query tag err: %w", text, err))
+		}
+		if tag == nil {
+			tag = &TaxonomyTag{
+				Slug:  alias,
+				Names: map[string]string{DefaultTagLocale: strings.TrimSpace(text)},
+			}
+			if err = uc.repo.SaveTag(ctx, tag); err != nil {
+				return nil, bizerr.ErrInternalError.Wrap(fmt.Errorf("NormalizeTags: [Tag: %s] save tag err: %w", text, err))
+			}
+		}
+		res[tag.Slug] = tag.Name(DefaultTagLocale)
+	}
+	return res, nil
+}
+
+// ResolveTag returns the slug of the canonical tag spelled as text, or the
+// normalized text when the taxonomy does not know it.
+func (uc *TagUsecase) ResolveTag(ctx context.Context, text string) (string, error) {
+	alias := NormalizeTag(text)
+	if alias == "" {
+		return "", nil
+	}
+	tag, err := uc.repo.QueryTagByAlias(ctx, alias)
+	if err != nil {
+		return "", bizerr.ErrInternalError.Wrap(fmt.Errorf("ResolveTag: [Tag: %s] query tag err: %w", text, err))
+	}
+	if tag == nil {
+		return alias, nil
+	}
+	return tag.Slug, nil
+}
+
+// QueryTaxonomy returns the categories and the tags filed under them, both
+// in their sort order.
+func (uc *TagUsecase) QueryTaxonomy(ctx context.Context) ([]*TagCategory, []*TaxonomyTag, error) {
+	categories, err := uc.repo.QueryTagCategories(ctx)
+	if err != nil {
+		return nil, nil, bizerr.ErrInternalError.Wrap(fmt.Errorf("QueryTaxonomy: query categories err: %w", err))
+	}
+	tags, err := uc.repo.QueryCategorizedTags(ctx)
+	if err != nil {
+		return nil, nil, bizerr.ErrInternalError.Wrap(fmt.Errorf("QueryTaxonomy: query tags err: %w", err))
+	}
+	return categories, tags, nil
+}
+
+// SeedTaxonomy writes the categories and the tags curated in the config, so
+// that a tag is filed and named as the config says whatever was met before.
+func (uc *TagUsecase) SeedTaxonomy(ctx context.Context) error {
+	if uc.conf.Taxonomy == nil {
+		return nil
+	}
+	for _, c := range uc.conf.Taxonomy.Categories {
+		if err := uc.repo.SaveTagCategory(ctx, &TagCategory{Slug: c.Slug, Names: c.Names, Sort: c.Sort}); err != nil {
+			return bizerr.ErrInternalError.Wrap(fmt.Errorf("SeedTaxonomy: [Category: %s] save category err: %w", c.Slug, err))
+		}
+	}
+	for _, t := range uc.conf.Taxonomy.Tags {
+		aliases := make([]string, 0, len(t.Aliases))
+		for _, text := range t.Aliases {
+			if alias := NormalizeTag(text); alias != "" {
+				aliases = append(aliases, alias)
+			}
+		}
+		tag := &TaxonomyTag{Slug: t.Slug, Category: t.Category, Names: t.Names, Sort: t.Sort}
+		if err := uc.repo.SaveCuratedTag(ctx, tag, aliases); err != nil {
+			return bizerr.ErrInternalError.Wrap(fmt.Errorf("SeedTaxonomy: [Tag: %s] save tag err: %w", t.Slug, err))
+		}
+	}
+	return nil
+}
+
+// BackfillCharacterTags maps the tags of every character onto the taxonomy.
+// It runs once, on the instance claiming it first, and is given back when it
+// fails so that the next start carries it out again.
+func (uc *TagUsecase) BackfillCharacterTags(ctx context.Context) error {
+	ok, err := uc.migrationRepo.ClaimMigration(ctx, tagBackfill)
+	if err != nil {
+		return bizerr.ErrInternalError.Wrap(fmt.Errorf("BackfillCharacterTags: claim migration err: %w", err))
+	}
+	if !ok {
+		return nil
+	}
+	if err = uc.backfillCharacterTags(ctx); err != nil {
+		if rerr := uc.migrationRepo.ReleaseMigration(ctx, tagBackfill); rerr != nil {
+			return bizerr.ErrInternalError.Wrap(fmt.Errorf("BackfillCharacterTags: release migration err: %v, backfill err: %w", rerr, err))
+		}
+		return err
+	}
+	return nil
+}
+
+func (uc *TagUsecase) backfillCharacterTags(ctx context.Context) error {
+	for after := ""; ; {
+		characters, err := uc.repo.QueryCharacterTags(ctx, after, tagBackfillBatch)
+		if err != nil {
+			return bizerr.ErrInternalError.Wrap(fmt.Errorf("BackfillCharacterTags: query tags err: %w", err))
+		}
+		for _, ch := range characters {
+			tags, err := uc.NormalizeTags(ctx, ch.Tags)
+			if err != nil {
+				return err
+			}
+			if err = uc.repo.UpdateCharacterTags(ctx, ch.CharacterID, tags); err != nil {
+				return bizerr.ErrInternalError.Wrap(fmt.Errorf("BackfillCharacterTags: [CharacterId: %s] update tags err: %w", ch.CharacterID, err))
+			}
+		}
+		if len(characters) < tagBackfillBatch {
+			return nil
+		}
+		after = characters[len(characters)-1].CharacterID
+	}
+}
@@ -5,25 +5,22 @@ import (
 	"errors"
 	"starland-backend/configs"
 	"starland-backend/internal/biz"
+	"time"
 
 	"go.uber.org/zap"
 	"gorm.io/datatypes"
 	"gorm.io/gorm"
 )
 
-const (
-	Unconfirmed int = -1
-)
-
 type Character struct {
 	gorm.Model
 	ID           string `json:"id" gorm:"primary_key;size:255"`
-	Name         string
-	Gender       int // 0:all 1:man 2:wowem
+	Name         string `gorm:"index:idx_character_search,class:FULLTEXT,option:WITH PARSER ngram"`
+	Gender       int    // 0:all 1:man 2:wowem
 	Prompt       string
-	Introduction string
-	AccountID    string
-	AccountName  string
+	Introduction string `gorm:"index:idx_character_search"`
+	AccountID    string `gorm:"index;size:255"`
+	AccountName  string `gorm:"index:idx_character_search"`
 	AvatarURL    string
 	ImageURL     string
 	ImageURLs    datatypes.JSONSlice[string] `gorm:"type:text"`
@@ -31,11 +28,26 @@ type Character struct {
 	ChatCount    int
 	IsMint       bool
 	Mint         string
-	Tag          datatypes.JSONSlice[Tag] `gorm:"type:text"`
+	Tag          datatypes.JSONSlice[Tag] `gorm:"type:text;index:idx_character_search"`
 	State        int
 	VoiceID      string
 	IsCustomized bool
 	Is3D         bool `json:"is_3d" gorm:"column:is_3d"`
+
+	Greeting         string                      `gorm:"type:text"`
+	ExampleDialogues datatypes.JSONSlice[string] `gorm:"type:text"`
+
+	ForkedFrom string `gorm:"index;size:255"`
+	ForkCount  int
+	Visibility int `gorm:"default:1"`
+
+	// TrendingScore is recomputed by the ranking job from the recent activity.
+	TrendingScore float64 `gorm:"index"`
+
+	Temperature    *float32
+	MaxHistory     *int32
+	MaxReplyLength *int32
+	StopSequences  datatypes.JSONSlice[string] `gorm:"type:text"`
 }
 type Tag struct {
 	Key   string
@@ -71,6 +83,7 @@ func (r *characterRepo) SaveCharacter(ctx context.Context, req *biz.CharacterReq
 				Gender:       req.Gender,
 				Prompt:       req.Prompt,
 				ImageURL:     req.ImageURL,
+				ImageURLs:    req.ImageURLs,
 				AccountName:  req.AccountName,
 				AvatarURL:    req.AvatarURL,
 				State:        req.State,
@@ -79,6 +92,11 @@ func (r *characterRepo) SaveCharacter(ctx context.Context, req *biz.CharacterReq
 				Introduction: req.Introduction,
 				VoiceID:      req.Voice,
 				ChatCount:    req.ChatCount,
+
+				Greeting:         req.Greeting,
+				ExampleDialogues: req.ExampleDialogues,
+				ForkedFrom:       req.ForkedFrom,
+				Visibility:       req.Visibility,
 			}
 			if qErr := r.data.db.WithContext(ctx).Model(&Character{}).Create(&c).Error; qErr != nil {
 				return "", qErr
@@ -103,6 +121,11 @@ func (r *characterRepo) SaveCharacter(ctx context.Context, req *biz.CharacterReq
 		Introduction: req.Introduction,
 		VoiceID:      req.Voice,
 		ChatCount:    req.ChatCount,
+		Visibility:   req.Visibility,
+		Greeting:     req.Greeting,
+	}
+	if req.ExampleDialogues != nil {
+		c.ExampleDialogues = req.ExampleDialogues
 	}
 
 	zap.S().Infof("save to db req: %+v", *c)
@@ -130,7 +153,7 @@ func (r *characterRepo) QueryCharactersByAccountID(ctx context.Context, accountI
 		count int64
 	)
 	if accountID == "" {
-		if err := r.data.db.Model(&Character{}).Where("state != ?", Unconfirmed).Offset((page - 1) * limit).Limit(limit).
+		if err := r.data.db.Model(&Character{}).Where("state != ?", biz.StateUnconfirmed).Offset((page - 1) * limit).Limit(limit).
 			Order("is_customized desc,like_count+chat_count desc,Created_at desc").Find(&res).Error; err != nil {
 			return nil, count, err
 		}
@@ -139,45 +162,47 @@ func (r *characterRepo) QueryCharactersByAccountID(ctx context.Context, accountI
 		}
 	} else {
 		queryWhere := "%" + query + "%"
-		if err := r.data.db.Model(&Character{}).Where("account_id = ? and (prompt like ? or account_name like ? or  name like ? )",
-			accountID, queryWhere, queryWhere, queryWhere).Offset((page - 1) * limit).
+		if err := r.data.db.Model(&Character{}).Where("account_id = ? and state != ? and (prompt like ? or account_name like ? or  name like ? )",
+			accountID, biz.StateUnconfirmed, queryWhere, queryWhere, queryWhere).Offset((page - 1) * limit).
 			Limit(limit).Order("is_customized desc,like_count+chat_count desc,Created_at desc").Find(&res).Error; err != nil {
 			return nil, count, err
 		}
 
-		if err := r.data.db.Model(&Character{}).Where("account_id = ? and (prompt like ? or account_name like ? or  name like ? )",
-			accountID, queryWhere, queryWhere, queryWhere).Count(&count).Error; err != nil {
+		if err := r.data.db.Model(&Character{}).Where("account_id = ? and state != ? and (prompt like ? or account_name like ? or  name like ? )",
+			accountID, biz.StateUnconfirmed, queryWhere, queryWhere, queryWhere).Count(&count).Error; err != nil {
 			return nil, count, err
 		}
 	}
 	return makeBizCharacterResponses(res), count, nil
 }
 
-func (r *characterRepo) QueryCharactersByNameOrPrompt(ctx context.Context, query string,
+func (r *characterRepo) QueryCharactersByNameOrPrompt(ctx context.Context, query, tag, sort string,
 	page, limit int) ([]*biz.CharacterResponse, int64, error) {
 	var (
 		res   []*Character
 		count int64
 	)
 	if query == "" {
-		if err := r.data.db.Model(&Character{}).Where("state != ?", Unconfirmed).Offset((page - 1) * limit).Limit(limit).
-			Order("is_customized desc,like_count+chat_count desc,Created_at desc").Find(&res).Error; err != nil {
+		if err := r.data.db.Model(&Character{}).Scopes(withTag(tag)).Where("state != ? and visibility = ?", biz.StateUnconfirmed, biz.VisibilityPublic).
+			Offset((page - 1) * limit).Limit(limit).
+			Order(feedOrder(sort)).Find(&res).Error; err != nil {
 			return nil, count, err
 		}
 
-		if err := r.data.db.Model(&Character{}).Where("state != ?", Unconfirmed).Count(&count).Error; err != nil {
+		if err := r.data.db.Model(&Character{}).Scopes(withTag(tag)).Where("state != ? and visibility = ?", biz.StateUnconfirmed, biz.VisibilityPublic).
+			Count(&count).Error; err != nil {
 			return nil, count, err
 		}
 	} else {
 		queryWhere := "%" + query + "%"
-		if err := r.data.db.Model(&Character{}).Where("state != ? and (prompt like ? or account_name like ? or  name like ? )",
-			Unconfirmed, queryWhere, queryWhere, queryWhere).Offset((page - 1) * limit).
-			Limit(limit).Order("is_customized desc,like_count+chat_count desc,Created_at desc").Find(&res).Error; err != nil {
+		if err := r.data.db.Model(&Character{}).Scopes(withTag(tag)).Where("state != ? and visibility = ? and (prompt like ? or account_name like ? or  name like ? )",
+			biz.StateUnconfirmed, biz.VisibilityPublic, queryWhere, queryWhere, queryWhere).Offset((page - 1) * limit).
+			Limit(limit).Order(feedOrder(sort)).Find(&res).Error; err != nil {
 			return nil, count, err
 		}
 
-		if err := r.data.db.Model(&Character{}).Where("state != ? and (prompt like ? or account_name like ? or  name like ? )",
-			Unconfirmed, queryWhere, queryWhere, queryWhere).Count(&count).Error; err != nil {
+		if err := r.data.db.Model(&Character{}).Scopes(withTag(tag)).Where("state != ? and visibility = ? and (prompt like ? or account_name like ? or  name like ? )",
+			biz.StateUnconfirmed, biz.VisibilityPublic, queryWhere, queryWhere, queryWhere).Count(&count).Error; err != nil {
 			return nil, count, err
 		}
 	}
@@ -185,6 +210,120 @@ func (r *characterRepo) QueryCharactersByNameOrPrompt(ctx context.Context, query
 	return makeBizCharacterResponses(res), count, nil
 }
 
+// feedOrder is the order by clause of the sort of the feed.
+func feedOrder(sort string) string {
+	switch sort {
+	case biz.FeedSortTrending:
+		return "trending_score desc,like_count+chat_count desc,created_at desc"
+	case biz.FeedSortNew:
+		return "created_at desc"
+	case biz.FeedSortTop:
+		return "like_count+chat_count desc,created_at desc"
+	}
+	return "is_customized desc,like_count+chat_count desc,Created_at desc"
+}
+
+// withTag narrows a query of characters to those carrying the tag slug.
+func withTag(tag string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if tag == "" {
+			return db
+		}
+		return db.Where("json_search(tag, 'one', ?, null, '$[*].Key') is not null", tag)
+	}
+}
+
+func (r *characterRepo) QueryDraftsByAccountID(ctx context.Context, accountID string,
+	page, limit int) ([]*biz.CharacterResponse, int64, error) {
+	var (
+		res   []*Character
+		count int64
+	)
+	db := r.data.db.WithContext(ctx).Model(&Character{}).Where("account_id = ? and state = ?", accountID, biz.StateUnconfirmed)
+	if err := db.Count(&count).Error; err != nil {
+		return nil, count, err
+	}
+	if err := db.Offset((page - 1) * limit).Limit(limit).Order("updated_at desc").Find(&res).Error; err != nil {
+		return nil, count, err
+	}
+	return makeBizCharacterResponses(res), count, nil
+}
+
+func (r *characterRepo) QueryDraftsUpdatedBefore(ctx context.Context, before time.Time, limit int) ([]*biz.CharacterResponse, error) {
+	var res []*Character
+	if err := r.data.db.WithContext(ctx).Model(&Character{}).Where("state = ? and updated_at < ?", biz.StateUnconfirmed, before).
+		Order("updated_at").Limit(limit).Find(&res).Error; err != nil {
+		return nil, err
+	}
+	return makeBizCharacterResponses(res), nil
+}
+
+func (r *characterRepo) QueryCharactersByIDs(ctx context.Context, ids []string) ([]*biz.CharacterResponse, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	var res []*Character
+	if err := r.data.db.WithContext(ctx).Model(&Character{}).Where("id in ?", ids).Find(&res).Error; err != nil {
+		return nil, err
+	}
+	return makeBizCharacterResponses(res), nil
+}
+
+// QueryListedCharacters pages through the confirmed public characters.
+func (r *characterRepo) QueryListedCharacters(ctx context.Context, page, limit int) ([]*biz.CharacterResponse, error) {
+	var res []*Character
+	if err := r.data.db.WithContext(ctx).Model(&Character{}).Where("state != ? and visibility = ?", biz.StateUnconfirmed, biz.VisibilityPublic).
+		Order("id").Offset((page - 1) * limit).Limit(limit).Find(&res).Error; err != nil {
+		return nil, err
+	}
+	return makeBizCharacterResponses(res), nil
+}
+
+func (r *characterRepo) QueryPublicCharactersByAccountID(ctx context.Context, accountID string,
+	page, limit int) ([]*biz.CharacterResponse, int64, error) {
+	db := r.data.db.WithContext(ctx).Model(&Character{}).Where("characters.account_id = ?", accountID)
+	return r.pagePublicCharacters(db, page, limit)
+}
+
+// QueryFollowedCharacters joins the follows of the account rather than
+// listing the creators it follows, which may be many.
+func (r *characterRepo) QueryFollowedCharacters(ctx context.Context, followerID string,
+	page, limit int) ([]*biz.CharacterResponse, int64, error) {
+	db := r.data.db.WithContext(ctx).Model(&Character{}).
+		Joins("join account_follows on account_follows.followee_id = characters.account_id").
+		Where("account_follows.follower_id = ?", followerID)
+	return r.pagePublicCharacters(db, page, limit)
+}
+
+// pagePublicCharacters pages through the confirmed public characters db
+// selects, the newest first.
+func (r *characterRepo) pagePublicCharacters(db *gorm.DB, page, limit int) ([]*biz.CharacterResponse, int64, error) {
+	var (
+		res   []*Character
+		count int64
+	)
+	db = db.Where("characters.state != ? and characters.visibility = ?", biz.StateUnconfirmed, biz.VisibilityPublic)
+	if err := db.Count(&count).Error; err != nil {
+		return nil, count, err
+	}
+	if err := db.Offset((page - 1) * limit).Limit(limit).Order("characters.created_at desc").
+		Find(&res).Error; err != nil {
+		return nil, count, err
+	}
+	return makeBizCharacterResponses(res), count, nil
+}
+
+func (r *characterRepo) QueryCreatorStats(ctx context.Context, accountID string) (*biz.CreatorStats, error) {
+	var res biz.CreatorStats
+	if err := r.data.db.WithContext(ctx).Model(&Character{}).
+		Select("count(*) as character_count, coalesce(sum(like_count), 0) as like_count, coalesce(sum(chat_count), 0) as chat_count").
+		Where("account_id = ? and state != ? and visibility = ?", accountID, biz.StateUnconfirmed, biz.VisibilityPublic).
+		Scan(&res).Error; err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
 func (r *characterRepo) CharacterMintSave(ctx context.Context, id, mint string) error {
 	return r.data.db.Model(Character{}).WithContext(ctx).Where("id = ?", id).
 		Updates(Character{IsMint: true, Mint: mint}).Error
@@ -198,14 +337,71 @@ func (r *characterRepo) UpdateCharacter(ctx context.Context, req *biz.UpdateChar
 		ImageURL:     req.Image,
 		ImageURLs:    req.Images,
 		VoiceID:      req.Voice,
+		Visibility:   req.Visibility,
 	}
 	if err := r.data.db.WithContext(ctx).Model(&Character{}).Where("id = ?", req.ID).
 		Updates(&c).Error; err != nil {
 		return err
 	}
+
+	// the greeting, the examples and the settings may be cleared, which
+	// Updates skips for a struct. A setting left nil falls back to the
+	// default of the config.
+	updates := map[string]interface{}{}
+	if req.Greeting != nil {
+		updates["greeting"] = *req.Greeting
+	}
+	if req.ExampleDialogues != nil {
+		updates["example_dialogues"] = datatypes.JSONSlice[string](req.ExampleDialogues)
+	}
+	if req.Settings != nil {
+		updates["temperature"] = req.Settings.Temperature
+		updates["max_history"] = req.Settings.MaxHistory
+		updates["max_reply_length"] = req.Settings.MaxReplyLength
+		updates["stop_sequences"] = datatypes.JSONSlice[string](req.Settings.StopSequences)
+	}
+	if len(updates) > 0 {
+		return r.data.db.WithContext(ctx).Model(&Character{}).Where("id = ?", req.ID).Updates(updates).Error
+	}
 	return nil
 }
 
+func (r *characterRepo) RestoreCharacter(ctx context.Context, rev *biz.CharacterRevision) error {
+	tag := make([]Tag, len(rev.Tag))
+	for i := range rev.Tag {
+		tag[i] = Tag{Key: rev.Tag[i].Key, Value: rev.Tag[i].Value}
+	}
+	updates := map[string]interface{}{
+		"name":              rev.Name,
+		"gender":            rev.Gender,
+		"prompt":            rev.Prompt,
+		"introduction":      rev.Introduction,
+		"image_url":         rev.ImageURL,
+		"image_urls":        datatypes.JSONSlice[string](rev.ImageURLs),
+		"voice_id":          rev.Voice,
+		"tag":               datatypes.JSONSlice[Tag](tag),
+		"is_3d":             rev.Is3D,
+		"greeting":          rev.Greeting,
+		"example_dialogues": datatypes.JSONSlice[string](rev.ExampleDialogues),
+		"temperature":       nil,
+		"max_history":       nil,
+		"max_reply_length":  nil,
+		"stop_sequences":    datatypes.JSONSlice[string](nil),
+	}
+	if rev.Settings != nil {
+		updates["temperature"] = rev.Settings.Temperature
+		updates["max_history"] = rev.Settings.MaxHistory
+		updates["max_reply_length"] = rev.Settings.MaxReplyLength
+		updates["stop_sequences"] = datatypes.JSONSlice[string](rev.Settings.StopSequences)
+	}
+	return r.data.db.WithContext(ctx).Model(&Character{}).Where("id = ?", rev.CharacterID).Updates(updates).Error
+}
+
+func (r *characterRepo) IncreaseForkCount(ctx context.Context, id string) error {
+	return r.data.db.WithContext(ctx).Model(&Character{}).Where("id = ?", id).
+		UpdateColumn("fork_count", gorm.Expr("fork_count + ?", 1)).Error
+}
+
 func (r *characterRepo) DeleteCharacterByID(ctx context.Context, id string) error {
 	if err := r.data.db.WithContext(ctx).Model(&Character{}).Where("id = ?", id).Delete(&Character{}).Error; err != nil {
 		return err
@@ -241,6 +437,19 @@ func makeBizCharacterResponse(c *Character) *biz.CharacterResponse {
 		Voice:        c.VoiceID,
 		ImageURLs:    c.ImageURLs,
 		Is3D:         c.Is3D,
+		State:        c.State,
+
+		Greeting:         c.Greeting,
+		ExampleDialogues: c.ExampleDialogues,
+		ForkedFrom:       c.ForkedFrom,
+		ForkCount:        c.ForkCount,
+		Visibility:       c.Visibility,
+		Settings: &biz.GenerationSettings{
+			Temperature:    c.Temperature,
+			MaxHistory:     c.MaxHistory,
+			MaxReplyLength: c.MaxReplyLength,
+			StopSequences:  c.StopSequences,
+		},
 	}
 }
 
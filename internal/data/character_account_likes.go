@@ -5,15 +5,19 @@ import (
 	"errors"
 	"starland-backend/configs"
 	"starland-backend/internal/biz"
+	"time"
 
 	"gorm.io/gorm"
 )
 
 type CharacterAccountLike struct {
 	gorm.Model
-	CharacterID string `gorm:"primary_key"`
+	CharacterID string `gorm:"primary_key;index:idx_like_updated_character,priority:2"`
 	AccountID   string `gorm:"primary_key"`
 	Flag        bool
+	// UpdatedAt overrides the one of gorm.Model to index the likes by when
+	// they were last set, which is how the trending job dates them.
+	UpdatedAt time.Time `gorm:"index:idx_like_updated_character,priority:1"`
 }
 
 type characterAccountLikesRepo struct {
@@ -67,3 +71,27 @@ func (r *characterAccountLikesRepo) QueryCharacterLikeCount(ctx context.Context,
 	}
 	return count, nil
 }
+
+// QueryLikedCharacterIDs pages through the characters the account likes, the
+// last liked first, leaving out the deleted, unfinished and private ones of
+// other accounts.
+func (r *characterAccountLikesRepo) QueryLikedCharacterIDs(ctx context.Context, accountID string,
+	page, limit int) ([]string, int64, error) {
+	var (
+		ids   []string
+		count int64
+	)
+	db := r.data.db.WithContext(ctx).Model(&CharacterAccountLike{}).
+		Joins("join characters on characters.id = character_account_likes.character_id and characters.deleted_at is null").
+		Where("character_account_likes.account_id = ? and character_account_likes.flag = true", accountID).
+		Where("characters.state != ? and (characters.visibility != ? or characters.account_id = ?)",
+			biz.StateUnconfirmed, biz.VisibilityPrivate, accountID)
+	if err := db.Count(&count).Error; err != nil {
+		return nil, count, err
+	}
+	if err := db.Offset((page-1)*limit).Limit(limit).Order("character_account_likes.updated_at desc").
+		Pluck("character_account_likes.character_id", &ids).Error; err != nil {
+		return nil, count, err
+	}
+	return ids, count, nil
+}
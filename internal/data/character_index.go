@@ -0,0 +1,274 @@
+package data
+
+import (
+	"context"
+	"math"
+	"sort"
+	"starland-backend/internal/biz"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// The weights of the indexed fields, a match on the name counting the most.
+const (
+	nameWeight         = 3
+	tagWeight          = 2
+	accountNameWeight  = 1.5
+	introductionWeight = 1
+)
+
+// The BM25 parameters of the ranking.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// characterIndex is an inverted index of the listed characters held in
+// memory, ranking the matches with BM25. Like the FULLTEXT index a query
+// matches the characters holding any of its terms.
+// Every instance holds its own index and only indexes the edits it serves
+// itself, so an edit made through another instance shows up here after the
+// next rebuild, up to the RebuildInterval of the config later.
+type characterIndex struct {
+	mu       sync.RWMutex
+	docs     map[string]*indexedCharacter
+	postings map[string]map[string]float64 // term -> character id -> weighted frequency
+	totalLen float64
+}
+
+type indexedCharacter struct {
+	id         string
+	gender     int
+	is3D       bool
+	minted     bool
+	tags       []string
+	popularity int
+	updateTime time.Time
+	terms      map[string]float64
+	length     float64
+}
+
+func newCharacterIndex() *characterIndex {
+	return &characterIndex{
+		docs:     make(map[string]*indexedCharacter),
+		postings: make(map[string]map[string]float64),
+	}
+}
+
+func (r *characterIndex) IndexCharacters(_ context.Context, characters []*biz.CharacterResponse) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range characters {
+		r.remove(characters[i].ID)
+		r.add(characters[i])
+	}
+	return nil
+}
+
+func (r *characterIndex) RemoveCharacters(_ context.Context, ids ...string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, id := range ids {
+		r.remove(id)
+	}
+	return nil
+}
+
+func (r *characterIndex) RebuildIndex(_ context.Context, characters []*biz.CharacterResponse) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.docs = make(map[string]*indexedCharacter, len(characters))
+	r.postings = make(map[string]map[string]float64)
+	r.totalLen = 0
+	for i := range characters {
+		r.add(characters[i])
+	}
+	return nil
+}
+
+func (r *characterIndex) SearchCharacters(_ context.Context, req *biz.CharacterSearchRequest) ([]string, int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	type hit struct {
+		doc   *indexedCharacter
+		score float64
+	}
+	var hits []hit
+	terms := tokenize(req.Query)
+	if len(terms) == 0 {
+		for _, doc := range r.docs {
+			if doc.matches(req) {
+				hits = append(hits, hit{doc: doc})
+			}
+		}
+	} else {
+		scores := make(map[string]float64)
+		avgLen := r.totalLen / math.Max(float64(len(r.docs)), 1)
+		for term := range terms {
+			posting := r.postings[term]
+			idf := math.Log(1 + (float64(len(r.docs))-float64(len(posting))+0.5)/(float64(len(posting))+0.5))
+			for id, tf := range posting {
+				doc := r.docs[id]
+				norm := bm25K1 * (1 - bm25B + bm25B*doc.length/math.Max(avgLen, 1))
+				scores[id] += idf * tf * (bm25K1 + 1) / (tf + norm)
+			}
+		}
+		for id, score := range scores {
+			if doc := r.docs[id]; doc.matches(req) {
+				hits = append(hits, hit{doc: doc, score: score})
+			}
+		}
+	}
+
+	byScore := req.Sort == biz.SearchSortRelevance && len(terms) > 0
+	sort.Slice(hits, func(i, j int) bool {
+		a, b := hits[i], hits[j]
+		if byScore && a.score != b.score {
+			return a.score > b.score
+		}
+		if a.doc.popularity != b.doc.popularity {
+			return a.doc.popularity > b.doc.popularity
+		}
+		if !a.doc.updateTime.Equal(b.doc.updateTime) {
+			return a.doc.updateTime.After(b.doc.updateTime)
+		}
+		return a.doc.id < b.doc.id
+	})
+
+	count := int64(len(hits))
+	start := (req.Page - 1) * req.Limit
+	if start < 0 || start >= len(hits) {
+		return []string{}, count, nil
+	}
+	end := start + req.Limit
+	if end > len(hits) {
+		end = len(hits)
+	}
+	ids := make([]string, 0, end-start)
+	for _, h := range hits[start:end] {
+		ids = append(ids, h.doc.id)
+	}
+	return ids, count, nil
+}
+
+// add indexes the character, which must not be in the index yet. The
+// caller holds the write lock.
+func (r *characterIndex) add(ch *biz.CharacterResponse) {
+	doc := &indexedCharacter{
+		id:         ch.ID,
+		gender:     ch.Gender,
+		is3D:       ch.Is3D,
+		minted:     ch.IsMint,
+		popularity: ch.LikeCount + ch.ChatCount,
+		updateTime: ch.UpdateTime,
+		terms:      make(map[string]float64),
+	}
+	addTerms := func(text string, weight float64) {
+		for term, n := range tokenize(text) {
+			doc.terms[term] += float64(n) * weight
+			doc.length += float64(n)
+		}
+	}
+	addTerms(ch.Name, nameWeight)
+	addTerms(ch.Introduction, introductionWeight)
+	addTerms(ch.AccountName, accountNameWeight)
+	for i := range ch.Tag {
+		doc.tags = append(doc.tags, ch.Tag[i].Key)
+		addTerms(ch.Tag[i].Value, tagWeight)
+	}
+
+	for term, tf := range doc.terms {
+		posting, ok := r.postings[term]
+		if !ok {
+			posting = make(map[string]float64)
+			r.postings[term] = posting
+		}
+		posting[doc.id] = tf
+	}
+	r.docs[doc.id] = doc
+	r.totalLen += doc.length
+}
+
+// remove drops the character from the index. The caller holds the write lock.
+func (r *characterIndex) remove(id string) {
+	doc, ok := r.docs[id]
+	if !ok {
+		return
+	}
+	for term := range doc.terms {
+		delete(r.postings[term], id)
+		if len(r.postings[term]) == 0 {
+			delete(r.postings, term)
+		}
+	}
+	delete(r.docs, id)
+	r.totalLen -= doc.length
+}
+
+func (doc *indexedCharacter) matches(req *biz.CharacterSearchRequest) bool {
+	if req.Gender != 0 && doc.gender != req.Gender {
+		return false
+	}
+	if req.Is3D != nil && doc.is3D != *req.Is3D {
+		return false
+	}
+	if req.Minted != nil && doc.minted != *req.Minted {
+		return false
+	}
+	if req.Tag != "" {
+		for i := range doc.tags {
+			if doc.tags[i] == req.Tag {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// tokenize counts the lower-cased words of the text. Runs of CJK characters,
+// written without spaces, are cut into bigrams as the ngram parser of MySQL
+// does.
+func tokenize(text string) map[string]int {
+	terms := make(map[string]int)
+	var word, cjk []rune
+	flush := func() {
+		if len(word) > 0 {
+			terms[string(word)]++
+			word = word[:0]
+		}
+		if len(cjk) == 1 {
+			terms[string(cjk)]++
+		}
+		for i := 0; i+1 < len(cjk); i++ {
+			terms[string(cjk[i:i+2])]++
+		}
+		cjk = cjk[:0]
+	}
+	for _, c := range strings.ToLower(text) {
+		switch {
+		case isCJK(c):
+			if len(word) > 0 {
+				terms[string(word)]++
+				word = word[:0]
+			}
+			cjk = append(cjk, c)
+		case unicode.IsLetter(c) || unicode.IsDigit(c):
+			if len(cjk) > 0 {
+				flush()
+			}
+			word = append(word, c)
+		default:
+			flush()
+		}
+	}
+	flush()
+	return terms
+}
+
+func isCJK(c rune) bool {
+	return unicode.In(c, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
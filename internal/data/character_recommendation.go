@@ -0,0 +1,103 @@
+package data
+
+import (
+	"context"
+	"starland-backend/configs"
+	"starland-backend/internal/biz"
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+// similarityBatch is the number of rows the similarities are inserted by.
+const similarityBatch = 500
+
+// CharacterSimilarity is a neighbor of a character in the recommendation
+// model, recomputed as a whole by the recommendation job. ComputedAt is when
+// the job last found it, the older rows being left over from former runs.
+type CharacterSimilarity struct {
+	CharacterID string `gorm:"primaryKey;size:255"`
+	SimilarID   string `gorm:"primaryKey;size:255"`
+	Score       float64
+	ComputedAt  time.Time `gorm:"index"`
+}
+
+type characterRecommendationRepo struct {
+	cfg  *configs.Config
+	data *Data
+}
+
+func NewCharacterRecommendationRepo(c *configs.Config, data *Data) biz.CharacterRecommendationRepo {
+	return &characterRecommendationRepo{
+		cfg:  c,
+		data: data,
+	}
+}
+
+func (r *characterRecommendationRepo) QueryInteractions(ctx context.Context) ([]*biz.CharacterInteraction, error) {
+	var res []*biz.CharacterInteraction
+	likes := r.data.db.Model(&CharacterAccountLike{}).Select("account_id, character_id").Where("flag = true")
+	conversations := r.data.db.Model(&Conversation{}).Select("account_id, character_id")
+	if err := r.data.db.WithContext(ctx).Raw("? union ?", likes, conversations).
+		Scan(&res).Error; err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// SaveSimilarities upserts the similarities by batches, then drops the ones
+// the run did not find again, so readers never see the table empty.
+func (r *characterRecommendationRepo) SaveSimilarities(ctx context.Context, similarities []*biz.CharacterSimilarity) error {
+	// truncated as the column is, lest the rows just saved look older.
+	now := time.Now().Truncate(time.Second)
+	rows := make([]*CharacterSimilarity, len(similarities))
+	for i := range similarities {
+		rows[i] = &CharacterSimilarity{
+			CharacterID: similarities[i].CharacterID,
+			SimilarID:   similarities[i].SimilarID,
+			Score:       similarities[i].Score,
+			ComputedAt:  now,
+		}
+	}
+	if len(rows) > 0 {
+		if err := r.data.db.WithContext(ctx).Clauses(clause.OnConflict{
+			DoUpdates: clause.AssignmentColumns([]string{"score", "computed_at"}),
+		}).CreateInBatches(rows, similarityBatch).Error; err != nil {
+			return err
+		}
+	}
+	return r.data.db.WithContext(ctx).Where("computed_at < ?", now).Delete(&CharacterSimilarity{}).Error
+}
+
+func (r *characterRecommendationRepo) QuerySimilarities(ctx context.Context, ids []string) ([]*biz.CharacterSimilarity, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	var res []*CharacterSimilarity
+	if err := r.data.db.WithContext(ctx).Model(&CharacterSimilarity{}).Where("character_id in ?", ids).
+		Find(&res).Error; err != nil {
+		return nil, err
+	}
+	similarities := make([]*biz.CharacterSimilarity, len(res))
+	for i := range res {
+		similarities[i] = &biz.CharacterSimilarity{
+			CharacterID: res[i].CharacterID,
+			SimilarID:   res[i].SimilarID,
+			Score:       res[i].Score,
+		}
+	}
+	return similarities, nil
+}
+
+func (r *characterRecommendationRepo) QueryAccountCharacters(ctx context.Context, accountID string) ([]string, []string, error) {
+	var liked, talked []string
+	if err := r.data.db.WithContext(ctx).Model(&CharacterAccountLike{}).
+		Where("account_id = ? and flag = true", accountID).Distinct().Pluck("character_id", &liked).Error; err != nil {
+		return nil, nil, err
+	}
+	if err := r.data.db.WithContext(ctx).Model(&Conversation{}).
+		Where("account_id = ?", accountID).Distinct().Pluck("character_id", &talked).Error; err != nil {
+		return nil, nil, err
+	}
+	return liked, talked, nil
+}
@@ -0,0 +1,180 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"starland-backend/configs"
+	"starland-backend/internal/biz"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type CharacterRevision struct {
+	gorm.Model
+	CharacterID      string `gorm:"uniqueIndex:idx_revision_character_version;size:255"`
+	Version          int    `gorm:"uniqueIndex:idx_revision_character_version"`
+	AccountID        string `gorm:"size:255"`
+	Reason           string `gorm:"size:32"`
+	RollbackFrom     int
+	Name             string
+	Gender           int
+	Prompt           string `gorm:"type:text"`
+	Introduction     string `gorm:"type:text"`
+	ImageURL         string
+	ImageURLs        datatypes.JSONSlice[string] `gorm:"type:text"`
+	VoiceID          string
+	Tag              datatypes.JSONSlice[Tag]    `gorm:"type:text"`
+	Is3D             bool                        `json:"is_3d" gorm:"column:is_3d"`
+	Greeting         string                      `gorm:"type:text"`
+	ExampleDialogues datatypes.JSONSlice[string] `gorm:"type:text"`
+
+	Temperature    *float32
+	MaxHistory     *int32
+	MaxReplyLength *int32
+	StopSequences  datatypes.JSONSlice[string] `gorm:"type:text"`
+}
+
+type characterRevisionRepo struct {
+	cfg  *configs.Config
+	data *Data
+}
+
+func NewCharacterRevisionRepo(c *configs.Config, data *Data) biz.CharacterRevisionRepo {
+	return &characterRevisionRepo{
+		cfg:  c,
+		data: data,
+	}
+}
+
+// SaveCharacterRevision stores the revision under the next version of the
+// character, setting req.Version and req.CreateTime.
+func (r *characterRevisionRepo) SaveCharacterRevision(ctx context.Context, req *biz.CharacterRevision) error {
+	tag := make([]Tag, len(req.Tag))
+	for i := range req.Tag {
+		tag[i] = Tag{Key: req.Tag[i].Key, Value: req.Tag[i].Value}
+	}
+	rev := &CharacterRevision{
+		CharacterID:      req.CharacterID,
+		AccountID:        req.AccountID,
+		Reason:           req.Reason,
+		RollbackFrom:     req.RollbackFrom,
+		Name:             req.Name,
+		Gender:           req.Gender,
+		Prompt:           req.Prompt,
+		Introduction:     req.Introduction,
+		ImageURL:         req.ImageURL,
+		ImageURLs:        req.ImageURLs,
+		VoiceID:          req.Voice,
+		Tag:              tag,
+		Is3D:             req.Is3D,
+		Greeting:         req.Greeting,
+		ExampleDialogues: req.ExampleDialogues,
+	}
+	if req.Settings != nil {
+		rev.Temperature = req.Settings.Temperature
+		rev.MaxHistory = req.Settings.MaxHistory
+		rev.MaxReplyLength = req.Settings.MaxReplyLength
+		rev.StopSequences = req.Settings.StopSequences
+	}
+
+	return r.data.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// the character row serializes the revisions of concurrent edits,
+		// which would otherwise read the same latest version.
+		var locked []string
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Model(&Character{}).
+			Where("id = ?", req.CharacterID).Pluck("id", &locked).Error; err != nil {
+			return err
+		}
+		var latest int
+		if err := tx.Model(&CharacterRevision{}).Where("character_id = ?", req.CharacterID).
+			Select("coalesce(max(version), 0)").Scan(&latest).Error; err != nil {
+			return err
+		}
+		rev.Version = latest + 1
+		if err := tx.Model(&CharacterRevision{}).Create(&rev).Error; err != nil {
+			return err
+		}
+		req.Version = rev.Version
+		req.CreateTime = rev.CreatedAt
+		return nil
+	})
+}
+
+func (r *characterRevisionRepo) QueryCharacterRevisions(ctx context.Context, characterID string,
+	page, limit int) ([]*biz.CharacterRevision, int64, error) {
+	var (
+		res   []*CharacterRevision
+		count int64
+	)
+	if err := r.data.db.WithContext(ctx).Model(&CharacterRevision{}).Where("character_id = ?", characterID).
+		Order("version desc").Offset((page - 1) * limit).Limit(limit).Find(&res).Error; err != nil {
+		return nil, count, err
+	}
+	if err := r.data.db.WithContext(ctx).Model(&CharacterRevision{}).Where("character_id = ?", characterID).
+		Count(&count).Error; err != nil {
+		return nil, count, err
+	}
+	revisions := make([]*biz.CharacterRevision, len(res))
+	for i := range res {
+		revisions[i] = makeBizCharacterRevision(res[i])
+	}
+	return revisions, count, nil
+}
+
+func (r *characterRevisionRepo) QueryCharacterRevision(ctx context.Context, characterID string, version int) (*biz.CharacterRevision, error) {
+	var rev *CharacterRevision
+	if err := r.data.db.WithContext(ctx).Model(&CharacterRevision{}).
+		Where("character_id = ? and version = ?", characterID, version).First(&rev).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return makeBizCharacterRevision(rev), nil
+}
+
+func (r *characterRevisionRepo) QueryLatestCharacterRevision(ctx context.Context, characterID string) (*biz.CharacterRevision, error) {
+	var rev *CharacterRevision
+	if err := r.data.db.WithContext(ctx).Model(&CharacterRevision{}).Where("character_id = ?", characterID).
+		Order("version desc").First(&rev).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return makeBizCharacterRevision(rev), nil
+}
+
+func makeBizCharacterRevision(rev *CharacterRevision) *biz.CharacterRevision {
+	tags := make([]biz.Tag, len(rev.Tag))
+	for i := range rev.Tag {
+		tags[i] = biz.Tag{Key: rev.Tag[i].Key, Value: rev.Tag[i].Value}
+	}
+	return &biz.CharacterRevision{
+		CharacterID:      rev.CharacterID,
+		Version:          rev.Version,
+		AccountID:        rev.AccountID,
+		Reason:           rev.Reason,
+		RollbackFrom:     rev.RollbackFrom,
+		Name:             rev.Name,
+		Gender:           rev.Gender,
+		Prompt:           rev.Prompt,
+		Introduction:     rev.Introduction,
+		ImageURL:         rev.ImageURL,
+		ImageURLs:        rev.ImageURLs,
+		Voice:            rev.VoiceID,
+		Tag:              tags,
+		Is3D:             rev.Is3D,
+		Greeting:         rev.Greeting,
+		ExampleDialogues: rev.ExampleDialogues,
+		Settings: &biz.GenerationSettings{
+			Temperature:    rev.Temperature,
+			MaxHistory:     rev.MaxHistory,
+			MaxReplyLength: rev.MaxReplyLength,
+			StopSequences:  rev.StopSequences,
+		},
+		CreateTime: rev.CreatedAt,
+	}
+}
@@ -0,0 +1,111 @@
+package data
+
+import (
+	"context"
+	"starland-backend/configs"
+	"starland-backend/internal/biz"
+	"strings"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// NewCharacterSearcher backs the character search with the engine of the
+// config, the FULLTEXT index of the characters table by default.
+func NewCharacterSearcher(c *configs.Config, data *Data) biz.CharacterSearcher {
+	engine := biz.SearchEngineMySQL
+	if c.Search != nil && c.Search.Engine != "" {
+		engine = c.Search.Engine
+	}
+	switch engine {
+	case biz.SearchEngineIndex:
+		return newCharacterIndex()
+	case biz.SearchEngineMySQL:
+	default:
+		zap.S().Errorf("NewCharacterSearcher: unknown engine %q, using %s", engine, biz.SearchEngineMySQL)
+	}
+	return &mysqlCharacterSearcher{cfg: c, data: data}
+}
+
+// mysqlCharacterSearcher searches the idx_character_search FULLTEXT index.
+// The table is the index, so there is nothing to maintain.
+type mysqlCharacterSearcher struct {
+	cfg  *configs.Config
+	data *Data
+}
+
+const (
+	characterMatch      = "match(name, introduction, account_name, tag) against (? in boolean mode)"
+	characterPopularity = "like_count+chat_count desc,created_at desc"
+)
+
+// booleanQuery quotes every term of the query as a phrase. The ngram parser
+// cuts a term into 2-grams, which natural language mode matches one by one,
+// where a phrase only matches the 2-grams in a row. The operators of boolean
+// mode are left out of the terms.
+func booleanQuery(query string) string {
+	terms := strings.Fields(query)
+	phrases := make([]string, 0, len(terms))
+	for _, term := range terms {
+		term = strings.Trim(strings.ReplaceAll(term, `"`, ""), "+-<>()~*@")
+		if term != "" {
+			phrases = append(phrases, `"`+term+`"`)
+		}
+	}
+	return strings.Join(phrases, " ")
+}
+
+func (r *mysqlCharacterSearcher) IndexCharacters(context.Context, []*biz.CharacterResponse) error {
+	return nil
+}
+
+func (r *mysqlCharacterSearcher) RemoveCharacters(context.Context, ...string) error {
+	return nil
+}
+
+func (r *mysqlCharacterSearcher) RebuildIndex(context.Context, []*biz.CharacterResponse) error {
+	return nil
+}
+
+func (r *mysqlCharacterSearcher) SearchCharacters(ctx context.Context, req *biz.CharacterSearchRequest) ([]string, int64, error) {
+	var (
+		ids   []string
+		count int64
+	)
+	if err := r.where(ctx, req).Count(&count).Error; err != nil {
+		return nil, count, err
+	}
+
+	db := r.where(ctx, req)
+	if query := booleanQuery(req.Query); query != "" && req.Sort == biz.SearchSortRelevance {
+		db = db.Clauses(clause.OrderBy{Expression: clause.Expr{
+			SQL:  characterMatch + " desc," + characterPopularity,
+			Vars: []interface{}{query},
+		}})
+	} else {
+		db = db.Order(characterPopularity)
+	}
+	if err := db.Offset((req.Page-1)*req.Limit).Limit(req.Limit).Pluck("id", &ids).Error; err != nil {
+		return nil, count, err
+	}
+	return ids, count, nil
+}
+
+func (r *mysqlCharacterSearcher) where(ctx context.Context, req *biz.CharacterSearchRequest) *gorm.DB {
+	db := r.data.db.WithContext(ctx).Model(&Character{}).
+		Where("state != ? and visibility = ?", biz.StateUnconfirmed, biz.VisibilityPublic)
+	if query := booleanQuery(req.Query); query != "" {
+		db = db.Where(characterMatch, query)
+	}
+	if req.Gender != 0 {
+		db = db.Where("gender = ?", req.Gender)
+	}
+	if req.Is3D != nil {
+		db = db.Where("is_3d = ?", *req.Is3D)
+	}
+	if req.Minted != nil {
+		db = db.Where("is_mint = ?", *req.Minted)
+	}
+	return db.Scopes(withTag(req.Tag))
+}
@@ -0,0 +1,136 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"starland-backend/configs"
+	"starland-backend/internal/biz"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type characterTrendRepo struct {
+	cfg  *configs.Config
+	data *Data
+}
+
+func NewCharacterTrendRepo(c *configs.Config, data *Data) biz.CharacterTrendRepo {
+	return &characterTrendRepo{
+		cfg:  c,
+		data: data,
+	}
+}
+
+// trendingBatch is the number of characters whose scores are saved together.
+const trendingBatch = 500
+
+type characterCount struct {
+	CharacterID string
+	Bucket      int64
+	Count       int64
+}
+
+// QueryCharacterActivity reads the window once per kind of activity, the
+// rows being counted per character and per bucket.
+func (r *characterTrendRepo) QueryCharacterActivity(ctx context.Context, from, to time.Time,
+	bucket time.Duration) ([]*biz.CharacterActivity, error) {
+	sel := "character_id, timestampdiff(second, ?, %s) div ? as bucket, count(*) as count"
+	seconds := int64(bucket / time.Second)
+	var likes, conversations, messages []*characterCount
+	// a like is dated by its last change, which is when it was set again
+	// after being taken back.
+	if err := r.data.db.WithContext(ctx).Model(&CharacterAccountLike{}).
+		Select(fmt.Sprintf(sel, "updated_at"), from, seconds).
+		Where("flag = true and updated_at >= ? and updated_at < ?", from, to).
+		Group("character_id, bucket").Scan(&likes).Error; err != nil {
+		return nil, err
+	}
+	if err := r.data.db.WithContext(ctx).Model(&Conversation{}).
+		Select(fmt.Sprintf(sel, "created_at"), from, seconds).
+		Where("created_at >= ? and created_at < ?", from, to).
+		Group("character_id, bucket").Scan(&conversations).Error; err != nil {
+		return nil, err
+	}
+	if err := r.data.db.WithContext(ctx).Model(&Message{}).
+		Select(fmt.Sprintf(sel, "created_at"), from, seconds).
+		Where("role = ? and created_at >= ? and created_at < ?", biz.MessageRoleUser, from, to).
+		Group("character_id, bucket").Scan(&messages).Error; err != nil {
+		return nil, err
+	}
+
+	type key struct {
+		id     string
+		bucket int64
+	}
+	byKey := make(map[key]*biz.CharacterActivity)
+	activity := func(c *characterCount) *biz.CharacterActivity {
+		k := key{c.CharacterID, c.Bucket}
+		a, ok := byKey[k]
+		if !ok {
+			a = &biz.CharacterActivity{
+				CharacterID: c.CharacterID,
+				Time:        from.Add(time.Duration(c.Bucket) * bucket),
+			}
+			byKey[k] = a
+		}
+		return a
+	}
+	for _, c := range likes {
+		activity(c).Likes = c.Count
+	}
+	for _, c := range conversations {
+		activity(c).Conversations = c.Count
+	}
+	for _, c := range messages {
+		activity(c).Messages = c.Count
+	}
+	res := make([]*biz.CharacterActivity, 0, len(byKey))
+	for _, a := range byKey {
+		res = append(res, a)
+	}
+	return res, nil
+}
+
+// SaveTrendingScores writes the scores by batches, and resets only the
+// characters that scored before and no longer do. UpdateColumn leaves
+// updated_at alone, which dates the edits of a character.
+func (r *characterTrendRepo) SaveTrendingScores(ctx context.Context, scores map[string]float64) error {
+	var scored []string
+	if err := r.data.db.WithContext(ctx).Model(&Character{}).Where("trending_score != 0").
+		Pluck("id", &scored).Error; err != nil {
+		return err
+	}
+	updates := make(map[string]float64, len(scores))
+	for id, score := range scores {
+		updates[id] = score
+	}
+	for _, id := range scored {
+		if _, ok := scores[id]; !ok {
+			updates[id] = 0
+		}
+	}
+
+	ids := make([]string, 0, len(updates))
+	for id := range updates {
+		ids = append(ids, id)
+	}
+	for start := 0; start < len(ids); start += trendingBatch {
+		end := start + trendingBatch
+		if end > len(ids) {
+			end = len(ids)
+		}
+		if err := r.data.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			for _, id := range ids[start:end] {
+				if err := tx.Model(&Character{}).Where("id = ?", id).
+					UpdateColumn("trending_score", updates[id]).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,225 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"starland-backend/configs"
+	"starland-backend/internal/biz"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type Collection struct {
+	gorm.Model
+	CollectionID string `json:"collection_id" gorm:"primary_key;size:255"`
+	AccountID    string `gorm:"index;size:255"`
+	Name         string
+	Description  string `gorm:"type:text"`
+	Visibility   int
+}
+
+// CollectionCharacter is a character put in a collection, Position ordering
+// the characters of the collection.
+type CollectionCharacter struct {
+	CollectionID string `gorm:"primaryKey;size:255"`
+	CharacterID  string `gorm:"primaryKey;size:255"`
+	Position     int
+	CreatedAt    time.Time
+}
+
+type collectionRepo struct {
+	cfg  *configs.Config
+	data *Data
+}
+
+func NewCollectionRepo(c *configs.Config, data *Data) biz.CollectionRepo {
+	return &collectionRepo{
+		cfg:  c,
+		data: data,
+	}
+}
+
+func (r *collectionRepo) CreateCollection(ctx context.Context, req *biz.CollectionRequest) (string, error) {
+	c := &Collection{
+		CollectionID: uuid.NewString(),
+		AccountID:    req.AccountID,
+		Name:         req.Name,
+		Description:  req.Description,
+		Visibility:   req.Visibility,
+	}
+	if err := r.data.db.WithContext(ctx).Model(&Collection{}).Create(c).Error; err != nil {
+		return "", err
+	}
+	return c.CollectionID, nil
+}
+
+func (r *collectionRepo) QueryCollectionByID(ctx context.Context, id string) (*biz.CollectionResponse, error) {
+	var c *Collection
+	if err := r.data.db.WithContext(ctx).Model(&Collection{}).Where("collection_id = ?", id).First(&c).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	res, err := r.makeBizCollections(ctx, []*Collection{c})
+	if err != nil {
+		return nil, err
+	}
+	return res[0], nil
+}
+
+func (r *collectionRepo) QueryCollectionsByAccountID(ctx context.Context, accountID string, publicOnly bool,
+	page, limit int) ([]*biz.CollectionResponse, int64, error) {
+	var (
+		res   []*Collection
+		count int64
+	)
+	db := r.data.db.WithContext(ctx).Model(&Collection{}).Where("account_id = ?", accountID)
+	if publicOnly {
+		db = db.Where("visibility = ?", biz.VisibilityPublic)
+	}
+	if err := db.Count(&count).Error; err != nil {
+		return nil, count, err
+	}
+	if err := db.Offset((page - 1) * limit).Limit(limit).Order("updated_at desc").Find(&res).Error; err != nil {
+		return nil, count, err
+	}
+	collections, err := r.makeBizCollections(ctx, res)
+	if err != nil {
+		return nil, count, err
+	}
+	return collections, count, nil
+}
+
+func (r *collectionRepo) UpdateCollection(ctx context.Context, req *biz.UpdateCollectionRequest) error {
+	updates := map[string]interface{}{}
+	if req.Name != nil {
+		updates["name"] = *req.Name
+	}
+	if req.Description != nil {
+		updates["description"] = *req.Description
+	}
+	if req.Visibility != nil {
+		updates["visibility"] = *req.Visibility
+	}
+	if len(updates) == 0 {
+		return nil
+	}
+	return r.data.db.WithContext(ctx).Model(&Collection{}).Where("collection_id = ?", req.CollectionID).Updates(updates).Error
+}
+
+func (r *collectionRepo) DeleteCollection(ctx context.Context, id string) error {
+	return r.data.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("collection_id = ?", id).Delete(&CollectionCharacter{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("collection_id = ?", id).Delete(&Collection{}).Error
+	})
+}
+
+func (r *collectionRepo) QueryCollectionCharacterIDs(ctx context.Context, id string) ([]string, error) {
+	var ids []string
+	if err := r.data.db.WithContext(ctx).Model(&CollectionCharacter{}).Where("collection_id = ?", id).
+		Order("position, created_at").Pluck("character_id", &ids).Error; err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+func (r *collectionRepo) AddCollectionCharacter(ctx context.Context, id, characterID string) error {
+	return r.data.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var last *int
+		if err := tx.Model(&CollectionCharacter{}).Where("collection_id = ?", id).
+			Select("max(position)").Scan(&last).Error; err != nil {
+			return err
+		}
+		position := 0
+		if last != nil {
+			position = *last + 1
+		}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&CollectionCharacter{
+			CollectionID: id,
+			CharacterID:  characterID,
+			Position:     position,
+		}).Error; err != nil {
+			return err
+		}
+		return touchCollection(tx, id)
+	})
+}
+
+func (r *collectionRepo) RemoveCollectionCharacter(ctx context.Context, id, characterID string) error {
+	return r.data.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("collection_id = ? and character_id = ?", id, characterID).
+			Delete(&CollectionCharacter{}).Error; err != nil {
+			return err
+		}
+		return touchCollection(tx, id)
+	})
+}
+
+func (r *collectionRepo) SortCollectionCharacters(ctx context.Context, id string, characterIDs []string) error {
+	return r.data.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for i, characterID := range characterIDs {
+			if err := tx.Model(&CollectionCharacter{}).Where("collection_id = ? and character_id = ?", id, characterID).
+				Update("position", i).Error; err != nil {
+				return err
+			}
+		}
+		return touchCollection(tx, id)
+	})
+}
+
+func (r *collectionRepo) RemoveCharacterFromCollections(ctx context.Context, characterID, accountID string) error {
+	db := r.data.db.WithContext(ctx).Where("character_id = ?", characterID)
+	if accountID != "" {
+		db = db.Where("collection_id not in (?)",
+			r.data.db.Model(&Collection{}).Select("collection_id").Where("account_id = ?", accountID))
+	}
+	return db.Delete(&CollectionCharacter{}).Error
+}
+
+// touchCollection dates the last change of the collection to now, which the
+// listing of the collections is ordered by.
+func touchCollection(tx *gorm.DB, id string) error {
+	return tx.Model(&Collection{}).Where("collection_id = ?", id).Update("updated_at", time.Now()).Error
+}
+
+func (r *collectionRepo) makeBizCollections(ctx context.Context, req []*Collection) ([]*biz.CollectionResponse, error) {
+	ids := make([]string, len(req))
+	for i := range req {
+		ids[i] = req[i].CollectionID
+	}
+	var counts []struct {
+		CollectionID string
+		Count        int
+	}
+	if len(ids) > 0 {
+		if err := r.data.db.WithContext(ctx).Model(&CollectionCharacter{}).Select("collection_id, count(*) as count").
+			Where("collection_id in ?", ids).Group("collection_id").Scan(&counts).Error; err != nil {
+			return nil, err
+		}
+	}
+	byID := make(map[string]int, len(counts))
+	for _, c := range counts {
+		byID[c.CollectionID] = c.Count
+	}
+
+	res := make([]*biz.CollectionResponse, len(req))
+	for i := range req {
+		res[i] = &biz.CollectionResponse{
+			CollectionID:   req[i].CollectionID,
+			AccountID:      req[i].AccountID,
+			Name:           req[i].Name,
+			Description:    req[i].Description,
+			Visibility:     req[i].Visibility,
+			CharacterCount: byID[req[i].CollectionID],
+			CreateTime:     req[i].CreatedAt,
+			UpdateTime:     req[i].UpdatedAt,
+		}
+	}
+	return res, nil
+}
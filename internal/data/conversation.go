@@ -5,6 +5,7 @@ import (
 	"errors"
 	"starland-backend/configs"
 	"starland-backend/internal/biz"
+	"time"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
@@ -12,9 +13,18 @@ import (
 
 type Conversation struct {
 	gorm.Model
-	ConversationID string `json:"conversation_id" gorm:"primary_key;size:255"`
-	AccountID      string
-	CharacterID    string
+	ConversationID  string `json:"conversation_id" gorm:"primary_key;size:255"`
+	AccountID       string
+	CharacterID     string `gorm:"index:idx_conversation_created_character,priority:2;size:255"`
+	Title           string
+	Archived        bool
+	ActiveMessageID string
+	MemorizedAt     *time.Time
+	// CharacterVersion is the character revision the conversation started on.
+	CharacterVersion int
+	// CreatedAt overrides the one of gorm.Model to index the activity of the
+	// characters by time.
+	CreatedAt time.Time `gorm:"index:idx_conversation_created_character,priority:1"`
 }
 
 type conversationRepo struct {
@@ -31,41 +41,164 @@ func NewConversationRepo(c *configs.Config, data *Data) biz.ConversationRepo {
 
 func (r *conversationRepo) QueryConversationByID(ctx context.Context, account, characterID string) (*biz.ConversationResponse, error) {
 	var res *Conversation
-	if err := r.data.db.WithContext(ctx).Model(&Conversation{}).Where("account_id = ? and character_id = ?", account, characterID).First(&res).Error; err != nil {
+	if err := r.data.db.WithContext(ctx).Model(&Conversation{}).Where("account_id = ? and character_id = ? and archived = ?",
+		account, characterID, false).Order("updated_at desc").First(&res).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, nil
 		}
 		return nil, err
 	}
 
-	return &biz.ConversationResponse{
-		ConversationID: res.ConversationID,
-		AccountID:      res.AccountID,
-		CharacterID:    res.CharacterID,
-		UpdateTime:     res.UpdatedAt,
-	}, nil
+	return makeBizConversation(res), nil
 }
 
-func (r *conversationRepo) QueryConversationsByAccountID(ctx context.Context, accountID string, page, limit int) ([]*biz.ConversationResponse, int64, error) {
+func (r *conversationRepo) QueryConversationByConversationID(ctx context.Context, id string) (*biz.ConversationResponse, error) {
+	var res *Conversation
+	if err := r.data.db.WithContext(ctx).Model(&Conversation{}).Where("conversation_id = ?", id).First(&res).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return makeBizConversation(res), nil
+}
+
+func (r *conversationRepo) QueryConversationsByCharacterID(ctx context.Context, accountID, characterID string, archived bool,
+	page, limit int) ([]*biz.ConversationResponse, int64, error) {
 	var (
 		res   []*Conversation
 		count int64
 	)
-	if err := r.data.db.WithContext(ctx).Model(&Conversation{}).Where("account_id = ?", accountID).Order("updated_at desc ").Find(&res).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, count, nil
-		}
+	db := r.data.db.WithContext(ctx).Model(&Conversation{}).Where("account_id = ? and archived = ?", accountID, archived)
+	if characterID != "" {
+		db = db.Where("character_id = ?", characterID)
+	}
+	if err := db.Count(&count).Error; err != nil {
 		return nil, count, err
 	}
-
-	if err := r.data.db.WithContext(ctx).Model(&Conversation{}).Where("account_id = ?", accountID).Count(&count).Error; err != nil {
+	if err := db.Offset((page - 1) * limit).Limit(limit).Order("updated_at desc").Find(&res).Error; err != nil {
 		return nil, count, err
 	}
+	return makeBizConversationResponse(res), count, nil
+}
 
+func (r *conversationRepo) CreateConversation(ctx context.Context, req *biz.ConversationRequest) (string, error) {
+	con := &Conversation{
+		ConversationID: uuid.NewString(),
+		AccountID:      req.AccountID,
+		CharacterID:    req.CharacterID,
+		Title:          req.Title,
+
+		CharacterVersion: req.CharacterVersion,
+	}
+	if err := r.data.db.WithContext(ctx).Model(&Conversation{}).Create(&con).Error; err != nil {
+		return "", err
+	}
+	return con.ConversationID, nil
+}
+
+func (r *conversationRepo) ImportConversation(ctx context.Context, req *biz.ConversationRequest,
+	messages []*biz.MessageRequest) (string, error) {
+	con := &Conversation{
+		ConversationID: uuid.NewString(),
+		AccountID:      req.AccountID,
+		CharacterID:    req.CharacterID,
+		Title:          req.Title,
+
+		CharacterVersion: req.CharacterVersion,
+	}
+	err := r.data.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&Conversation{}).Create(&con).Error; err != nil {
+			return err
+		}
+		var parentID string
+		for _, req := range messages {
+			m := &Message{
+				MessageID:      uuid.NewString(),
+				ConversationID: con.ConversationID,
+				ParentID:       parentID,
+				AccountID:      req.AccountID,
+				CharacterID:    req.CharacterID,
+				Role:           req.Role,
+				Content:        req.Content,
+				VoiceURL:       req.VoiceURL,
+				TokenCount:     req.TokenCount,
+				Truncated:      req.Truncated,
+				CreatedAt:      req.CreateTime,
+			}
+			if err := tx.Model(&Message{}).Create(&m).Error; err != nil {
+				return err
+			}
+			parentID = m.MessageID
+		}
+		if parentID == "" {
+			return nil
+		}
+		return tx.Model(&Conversation{}).Where("conversation_id = ?", con.ConversationID).
+			Update("active_message_id", parentID).Error
+	})
+	if err != nil {
+		return "", err
+	}
+	return con.ConversationID, nil
+}
+
+func (r *conversationRepo) UpdateConversation(ctx context.Context, req *biz.UpdateConversationRequest) error {
+	updates := map[string]interface{}{}
+	if req.Title != nil {
+		updates["title"] = *req.Title
+	}
+	if req.Archived != nil {
+		updates["archived"] = *req.Archived
+	}
+	if req.ActiveMessageID != nil {
+		updates["active_message_id"] = *req.ActiveMessageID
+	}
+	return r.data.db.WithContext(ctx).Model(&Conversation{}).Where("conversation_id = ?", req.ConversationID).
+		Updates(updates).Error
+}
+
+func (r *conversationRepo) DeleteConversation(ctx context.Context, id string) error {
+	return r.data.db.WithContext(ctx).Model(&Conversation{}).Where("conversation_id = ?", id).Delete(&Conversation{}).Error
+}
+
+func (r *conversationRepo) QueryConversationsToMemorize(ctx context.Context, since time.Time) ([]*biz.ConversationResponse, error) {
+	var res []*Conversation
+	if err := r.data.db.WithContext(ctx).Model(&Conversation{}).
+		Where("updated_at >= ? and (memorized_at is null or memorized_at < updated_at)", since).
+		Order("updated_at").Find(&res).Error; err != nil {
+		return nil, err
+	}
+	return makeBizConversationResponse(res), nil
+}
+
+// UpdateMemorizedAt leaves updated_at alone, so summarizing a conversation
+// does not move it up the list of recent conversations.
+func (r *conversationRepo) UpdateMemorizedAt(ctx context.Context, id string, from, to *time.Time) (bool, error) {
+	db := r.data.db.WithContext(ctx).Model(&Conversation{}).Where("conversation_id = ? and memorized_at <=> ?", id, from).
+		UpdateColumn("memorized_at", to)
+	if db.Error != nil {
+		return false, db.Error
+	}
+	return db.RowsAffected > 0, nil
+}
+
+func (r *conversationRepo) QueryConversationsByAccountID(ctx context.Context, accountID string, page, limit int) ([]*biz.ConversationResponse, int64, error) {
+	var (
+		res   []*Conversation
+		count int64
+	)
+	db := r.data.db.WithContext(ctx).Model(&Conversation{}).Where("account_id = ?", accountID)
+	if err := db.Count(&count).Error; err != nil {
+		return nil, count, err
+	}
+	if err := db.Offset((page - 1) * limit).Limit(limit).Order("updated_at desc").Find(&res).Error; err != nil {
+		return nil, count, err
+	}
 	return makeBizConversationResponse(res), count, nil
 }
 
-func (r *conversationRepo) SaveConversation(ctx context.Context, req *biz.ConversationRequest) error {
+func (r *conversationRepo) SaveConversation(ctx context.Context, req *biz.ConversationRequest) (string, error) {
 	var con *Conversation
 	if req.ConversationID == "" {
 		con = &Conversation{
@@ -74,34 +207,49 @@ func (r *conversationRepo) SaveConversation(ctx context.Context, req *biz.Conver
 			CharacterID:    req.CharacterID,
 		}
 		if err := r.data.db.WithContext(ctx).Model(&Conversation{}).Where("conversation_id = ?", req.ConversationID).Create(&con).Error; err != nil {
-			return err
+			return "", err
 		}
+		return con.ConversationID, nil
 	} else {
 		if err := r.data.db.WithContext(ctx).Model(&Conversation{}).Where("conversation_id = ?", req.ConversationID).
 			Updates(Conversation{ConversationID: req.ConversationID, CharacterID: req.CharacterID, AccountID: req.AccountID}).Error; err != nil {
-			return err
+			return "", err
 		}
 	}
-	return nil
+	return req.ConversationID, nil
+}
+
+func makeBizConversation(c *Conversation) *biz.ConversationResponse {
+	return &biz.ConversationResponse{
+		ConversationID:  c.ConversationID,
+		AccountID:       c.AccountID,
+		CharacterID:     c.CharacterID,
+		Title:           c.Title,
+		Archived:        c.Archived,
+		ActiveMessageID: c.ActiveMessageID,
+		MemorizedAt:     c.MemorizedAt,
+		CreateTime:      c.CreatedAt,
+		UpdateTime:      c.UpdatedAt,
+
+		CharacterVersion: c.CharacterVersion,
+	}
 }
 
 func makeBizConversationResponse(req []*Conversation) []*biz.ConversationResponse {
 	res := make([]*biz.ConversationResponse, len(req))
 	for i := range res {
-		res[i] = &biz.ConversationResponse{
-			ConversationID: req[i].ConversationID,
-			AccountID:      req[i].AccountID,
-			CharacterID:    req[i].CharacterID,
-			UpdateTime:     req[i].UpdatedAt,
-		}
+		res[i] = makeBizConversation(req[i])
 	}
 	return res
 }
 
+// QueryConversationsCountByAccountID counts the accounts that talked to the
+// character, once however many conversations they opened.
 func (r *conversationRepo) QueryConversationsCountByAccountID(ctx context.Context, id string) (int64, error) {
 	var count int64
 
-	if err := r.data.db.WithContext(ctx).Model(&Conversation{}).Where("character_id = ?", id).Count(&count).Error; err != nil {
+	if err := r.data.db.WithContext(ctx).Model(&Conversation{}).Where("character_id = ?", id).
+		Distinct("account_id").Count(&count).Error; err != nil {
 		return count, err
 	}
 	return count, nil
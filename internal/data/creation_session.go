@@ -0,0 +1,103 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"starland-backend/configs"
+	"starland-backend/internal/biz"
+	"time"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+type CreationSession struct {
+	gorm.Model
+	SessionID string `json:"session_id" gorm:"primary_key;size:255"`
+	AccountID string `gorm:"index;size:255"`
+	Stage     int
+	Images    datatypes.JSONSlice[string] `gorm:"type:text"`
+	Voice     string
+	Is3D      bool `json:"is_3d" gorm:"column:is_3d"`
+}
+
+type creationSessionRepo struct {
+	cfg  *configs.Config
+	data *Data
+}
+
+func NewCreationSessionRepo(c *configs.Config, data *Data) biz.CreationSessionRepo {
+	return &creationSessionRepo{
+		cfg:  c,
+		data: data,
+	}
+}
+
+func (r *creationSessionRepo) CreateCreationSession(ctx context.Context, req *biz.CreationSession) error {
+	sess := &CreationSession{
+		SessionID: req.SessionID,
+		AccountID: req.AccountID,
+		Stage:     req.Stage,
+		Images:    req.Images,
+		Voice:     req.Voice,
+		Is3D:      req.Is3D,
+	}
+	if err := r.data.db.WithContext(ctx).Model(&CreationSession{}).Create(&sess).Error; err != nil {
+		return err
+	}
+	req.CreateTime = sess.CreatedAt
+	req.UpdateTime = sess.UpdatedAt
+	return nil
+}
+
+func (r *creationSessionRepo) QueryCreationSessionByID(ctx context.Context, id string) (*biz.CreationSession, error) {
+	var sess *CreationSession
+	if err := r.data.db.WithContext(ctx).Model(&CreationSession{}).Where("session_id = ?", id).First(&sess).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return makeBizCreationSession(sess), nil
+}
+
+func (r *creationSessionRepo) UpdateCreationSession(ctx context.Context, req *biz.CreationSession) error {
+	return r.data.db.WithContext(ctx).Model(&CreationSession{}).Where("session_id = ?", req.SessionID).
+		Updates(map[string]interface{}{
+			"stage":  req.Stage,
+			"images": datatypes.JSONSlice[string](req.Images),
+			"voice":  req.Voice,
+			"is_3d":  req.Is3D,
+		}).Error
+}
+
+func (r *creationSessionRepo) QueryCreationSessionsUpdatedBefore(ctx context.Context, before time.Time,
+	limit int) ([]*biz.CreationSession, error) {
+	var res []*CreationSession
+	if err := r.data.db.WithContext(ctx).Model(&CreationSession{}).Where("updated_at < ?", before).
+		Order("updated_at").Limit(limit).Find(&res).Error; err != nil {
+		return nil, err
+	}
+	sessions := make([]*biz.CreationSession, len(res))
+	for i := range res {
+		sessions[i] = makeBizCreationSession(res[i])
+	}
+	return sessions, nil
+}
+
+func (r *creationSessionRepo) DeleteCreationSession(ctx context.Context, id string) error {
+	return r.data.db.WithContext(ctx).Model(&CreationSession{}).Where("session_id = ?", id).Delete(&CreationSession{}).Error
+}
+
+func makeBizCreationSession(sess *CreationSession) *biz.CreationSession {
+	return &biz.CreationSession{
+		SessionID:  sess.SessionID,
+		AccountID:  sess.AccountID,
+		Stage:      sess.Stage,
+		Images:     sess.Images,
+		Voice:      sess.Voice,
+		Is3D:       sess.Is3D,
+		CreateTime: sess.CreatedAt,
+		UpdateTime: sess.UpdatedAt,
+	}
+}
@@ -20,17 +20,30 @@ import (
 var ProviderSet = wire.NewSet(NewData, NewCharacterRepo,
 	NewImageModelRepo, NewCharacterAccountLikesRepo,
 	NewConversationRepo, NewAccountRepo,
-	NewCharacterVoiceRepo)
+	NewCharacterVoiceRepo, NewMessageRepo,
+	NewReplyRepo, NewMemoryRepo, NewCreationSessionRepo,
+	NewCharacterRevisionRepo, NewCharacterSearcher,
+	NewTagRepo, NewCharacterTrendRepo,
+	NewCharacterRecommendationRepo, NewCollectionRepo,
+	NewFollowRepo, NewLeaseRepo, NewMigrationRepo)
+
+// defaultReaderPoolSize sizes the pool of the blocking reads when the config
+// leaves it unset.
+const defaultReaderPoolSize = 1000
 
 type Data struct {
 	db  *gorm.DB
 	rdb *redis.Client
+	// readerRdb serves the blocking reads, which hold a connection for as
+	// long as they wait and would otherwise drain the pool of rdb.
+	readerRdb *redis.Client
 }
 
 func NewData(c *configs.Config) *Data {
 	return &Data{
-		db:  NewDB(c),
-		rdb: NewRedis(c),
+		db:        NewDB(c),
+		rdb:       NewRedis(c),
+		readerRdb: NewReaderRedis(c),
 	}
 }
 
@@ -58,7 +71,10 @@ func NewDB(c *configs.Config) *gorm.DB {
 	}
 
 	if err = db.AutoMigrate(&Character{}, &ImageModel{},
-		&CharacterAccountLike{}, &Conversation{}, &CharacterVoice{}); err != nil {
+		&CharacterAccountLike{}, &Conversation{}, &CharacterVoice{},
+		&Message{}, &Memory{}, &CreationSession{}, &CharacterRevision{},
+		&TagCategory{}, &TaxonomyTag{}, &TagAlias{}, &CharacterSimilarity{},
+		&Collection{}, &CollectionCharacter{}, &AccountFollow{}, &Migration{}); err != nil {
 		zap.S().Errorf("failed to migrate db: %v", err)
 		panic("failed to connect database")
 	}
@@ -74,3 +90,16 @@ func NewRedis(cfg *configs.Config) *redis.Client {
 	})
 	return rdb
 }
+
+func NewReaderRedis(cfg *configs.Config) *redis.Client {
+	size := cfg.Data.Redis.ReaderPoolSize
+	if size <= 0 {
+		size = defaultReaderPoolSize
+	}
+	return redis.NewClient(&redis.Options{
+		Addr:     cfg.Data.Redis.Host,
+		Password: cfg.Data.Redis.Password,
+		DB:       0,
+		PoolSize: size,
+	})
+}
@@ -0,0 +1,66 @@
+package data
+
+import (
+	"context"
+	"starland-backend/configs"
+	"starland-backend/internal/biz"
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+// AccountFollow is an account following a creator.
+type AccountFollow struct {
+	FollowerID string `gorm:"primaryKey;size:255"`
+	FolloweeID string `gorm:"primaryKey;size:255;index"`
+	CreatedAt  time.Time
+}
+
+type followRepo struct {
+	cfg  *configs.Config
+	data *Data
+}
+
+func NewFollowRepo(c *configs.Config, data *Data) biz.FollowRepo {
+	return &followRepo{
+		cfg:  c,
+		data: data,
+	}
+}
+
+func (r *followRepo) SaveFollow(ctx context.Context, followerID, followeeID string) error {
+	return r.data.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&AccountFollow{FollowerID: followerID, FolloweeID: followeeID}).Error
+}
+
+func (r *followRepo) DeleteFollow(ctx context.Context, followerID, followeeID string) error {
+	return r.data.db.WithContext(ctx).Where("follower_id = ? and followee_id = ?", followerID, followeeID).
+		Delete(&AccountFollow{}).Error
+}
+
+func (r *followRepo) QueryFollow(ctx context.Context, followerID, followeeID string) (bool, error) {
+	var count int64
+	if err := r.data.db.WithContext(ctx).Model(&AccountFollow{}).
+		Where("follower_id = ? and followee_id = ?", followerID, followeeID).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (r *followRepo) QueryFollowerCount(ctx context.Context, accountID string) (int64, error) {
+	var count int64
+	if err := r.data.db.WithContext(ctx).Model(&AccountFollow{}).Where("followee_id = ?", accountID).
+		Count(&count).Error; err != nil {
+		return count, err
+	}
+	return count, nil
+}
+
+func (r *followRepo) QueryFollowingCount(ctx context.Context, accountID string) (int64, error) {
+	var count int64
+	if err := r.data.db.WithContext(ctx).Model(&AccountFollow{}).Where("follower_id = ?", accountID).
+		Count(&count).Error; err != nil {
+		return count, err
+	}
+	return count, nil
+}
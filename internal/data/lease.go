@@ -0,0 +1,50 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"starland-backend/configs"
+	"starland-backend/internal/biz"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/google/uuid"
+)
+
+// acquireLease extends the lease of its holder or sets it when free.
+var acquireLease = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("pexpire", KEYS[1], ARGV[2])
+end
+if redis.call("set", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+	return 1
+end
+return 0`)
+
+type leaseRepo struct {
+	cfg  *configs.Config
+	data *Data
+	// holder tells this instance apart from the others.
+	holder string
+}
+
+func NewLeaseRepo(c *configs.Config, data *Data) biz.LeaseRepo {
+	return &leaseRepo{
+		cfg:    c,
+		data:   data,
+		holder: uuid.NewString(),
+	}
+}
+
+func leaseKey(name string) string {
+	return fmt.Sprintf("lease:%s", name)
+}
+
+func (r *leaseRepo) AcquireLease(ctx context.Context, name string, ttl time.Duration) (bool, error) {
+	res, err := acquireLease.Run(r.data.rdb.WithContext(ctx), []string{leaseKey(name)},
+		r.holder, ttl.Milliseconds()).Int()
+	if err != nil {
+		return false, err
+	}
+	return res == 1, nil
+}
@@ -0,0 +1,102 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"starland-backend/configs"
+	"starland-backend/internal/biz"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type Memory struct {
+	gorm.Model
+	MemoryID       string `json:"memory_id" gorm:"primary_key;size:255"`
+	AccountID      string `gorm:"index:idx_memory_account_character;size:255"`
+	CharacterID    string `gorm:"index:idx_memory_account_character;size:255"`
+	ConversationID string `gorm:"size:255"`
+	Content        string `gorm:"type:text"`
+	SourceTime     time.Time
+}
+
+type memoryRepo struct {
+	cfg  *configs.Config
+	data *Data
+}
+
+func NewMemoryRepo(c *configs.Config, data *Data) biz.MemoryRepo {
+	return &memoryRepo{
+		cfg:  c,
+		data: data,
+	}
+}
+
+func (r *memoryRepo) SaveMemories(ctx context.Context, req []*biz.MemoryRequest) error {
+	ms := make([]*Memory, len(req))
+	for i := range req {
+		ms[i] = &Memory{
+			MemoryID:       uuid.NewString(),
+			AccountID:      req[i].AccountID,
+			CharacterID:    req[i].CharacterID,
+			ConversationID: req[i].ConversationID,
+			Content:        req[i].Content,
+			SourceTime:     req[i].SourceTime,
+		}
+	}
+	return r.data.db.WithContext(ctx).Model(&Memory{}).Create(&ms).Error
+}
+
+func (r *memoryRepo) QueryMemories(ctx context.Context, accountID, characterID string, limit int) ([]*biz.MemoryResponse, error) {
+	var res []*Memory
+	db := r.data.db.WithContext(ctx).Model(&Memory{}).
+		Where("account_id = ? and character_id = ?", accountID, characterID).Order("created_at desc")
+	if limit > 0 {
+		db = db.Limit(limit)
+	}
+	if err := db.Find(&res).Error; err != nil {
+		return nil, err
+	}
+	return makeBizMemoryResponses(res), nil
+}
+
+func (r *memoryRepo) QueryMemoryByID(ctx context.Context, id string) (*biz.MemoryResponse, error) {
+	var m *Memory
+	if err := r.data.db.WithContext(ctx).Model(&Memory{}).Where("memory_id = ?", id).First(&m).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return makeBizMemoryResponse(m), nil
+}
+
+func (r *memoryRepo) DeleteMemory(ctx context.Context, id string) error {
+	return r.data.db.WithContext(ctx).Model(&Memory{}).Where("memory_id = ?", id).Delete(&Memory{}).Error
+}
+
+func (r *memoryRepo) DeleteMemories(ctx context.Context, accountID, characterID string) error {
+	return r.data.db.WithContext(ctx).Model(&Memory{}).
+		Where("account_id = ? and character_id = ?", accountID, characterID).Delete(&Memory{}).Error
+}
+
+func makeBizMemoryResponse(m *Memory) *biz.MemoryResponse {
+	return &biz.MemoryResponse{
+		MemoryID:       m.MemoryID,
+		AccountID:      m.AccountID,
+		CharacterID:    m.CharacterID,
+		ConversationID: m.ConversationID,
+		Content:        m.Content,
+		SourceTime:     m.SourceTime,
+		CreateTime:     m.CreatedAt,
+	}
+}
+
+func makeBizMemoryResponses(req []*Memory) []*biz.MemoryResponse {
+	res := make([]*biz.MemoryResponse, len(req))
+	for i := range req {
+		res[i] = makeBizMemoryResponse(req[i])
+	}
+	return res
+}
@@ -0,0 +1,189 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"starland-backend/configs"
+	"starland-backend/internal/biz"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type Message struct {
+	gorm.Model
+	MessageID      string `json:"message_id" gorm:"primary_key;size:255"`
+	ConversationID string `gorm:"index;size:255"`
+	ParentID       string `gorm:"index;size:255"`
+	AccountID      string
+	CharacterID    string `gorm:"index:idx_message_created_character,priority:2;size:255"`
+	Role           string
+	Content        string `gorm:"type:text"`
+	VoiceURL       string
+	TokenCount     int
+	Truncated      bool
+	// CreatedAt overrides the one of gorm.Model to index the activity of the
+	// characters by time.
+	CreatedAt time.Time `gorm:"index:idx_message_created_character,priority:1"`
+}
+
+type messageRepo struct {
+	cfg  *configs.Config
+	data *Data
+}
+
+func NewMessageRepo(c *configs.Config, data *Data) biz.MessageRepo {
+	return &messageRepo{
+		cfg:  c,
+		data: data,
+	}
+}
+
+func (r *messageRepo) SaveMessage(ctx context.Context, req *biz.MessageRequest) (string, error) {
+	m := &Message{
+		MessageID:      uuid.NewString(),
+		ConversationID: req.ConversationID,
+		ParentID:       req.ParentID,
+		AccountID:      req.AccountID,
+		CharacterID:    req.CharacterID,
+		Role:           req.Role,
+		Content:        req.Content,
+		VoiceURL:       req.VoiceURL,
+		TokenCount:     req.TokenCount,
+		Truncated:      req.Truncated,
+		CreatedAt:      req.CreateTime,
+	}
+	if err := r.data.db.WithContext(ctx).Model(&Message{}).Create(&m).Error; err != nil {
+		return "", err
+	}
+	return m.MessageID, nil
+}
+
+func (r *messageRepo) QueryMessageByID(ctx context.Context, id string) (*biz.MessageResponse, error) {
+	var m *Message
+	if err := r.data.db.WithContext(ctx).Model(&Message{}).Where("message_id = ?", id).First(&m).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return makeBizMessageResponse(m), nil
+}
+
+func (r *messageRepo) QueryMessagesByConversationID(ctx context.Context, conversationID string) ([]*biz.MessageResponse, error) {
+	var res []*Message
+	if err := r.data.db.WithContext(ctx).Model(&Message{}).Where("conversation_id = ?", conversationID).
+		Order("created_at").Find(&res).Error; err != nil {
+		return nil, err
+	}
+	return makeBizMessageResponses(res), nil
+}
+
+// branchMessages walks up from a message to the root of its branch, the
+// depth counting from the message. A conversation can outgrow the default
+// recursion depth of mysql, hence the hint.
+const branchMessages = `with recursive branch (message_id, parent_id, depth) as (
+	select message_id, parent_id, 1 from messages
+	where message_id = ? and conversation_id = ? and deleted_at is null
+	union all
+	select m.message_id, m.parent_id, b.depth + 1 from messages m
+	join branch b on m.message_id = b.parent_id
+	where m.deleted_at is null
+)
+`
+
+const branchRecursionHint = "/*+ SET_VAR(cte_max_recursion_depth = 1000000) */"
+
+func (r *messageRepo) QueryLatestMessageID(ctx context.Context, conversationID string) (string, error) {
+	var ids []string
+	if err := r.data.db.WithContext(ctx).Model(&Message{}).Where("conversation_id = ?", conversationID).
+		Order("created_at desc").Limit(1).Pluck("message_id", &ids).Error; err != nil {
+		return "", err
+	}
+	if len(ids) == 0 {
+		return "", nil
+	}
+	return ids[0], nil
+}
+
+// QueryBranchMessages returns the messages of the branch ending at the leaf,
+// from the root down, skipping the offset messages closest to the leaf. The
+// siblings of each message are filled in, as is the length of the branch.
+func (r *messageRepo) QueryBranchMessages(ctx context.Context, conversationID, leafID string,
+	offset, limit int) ([]*biz.MessageResponse, int64, error) {
+	var count int64
+	if err := r.data.db.WithContext(ctx).Raw(branchMessages+"select "+branchRecursionHint+" count(*) from branch",
+		leafID, conversationID).Scan(&count).Error; err != nil {
+		return nil, 0, err
+	}
+	if count == 0 {
+		return []*biz.MessageResponse{}, 0, nil
+	}
+
+	query := branchMessages + "select " + branchRecursionHint + ` m.* from branch b
+join messages m on m.message_id = b.message_id and m.deleted_at is null
+order by b.depth`
+	args := []interface{}{leafID, conversationID}
+	if limit > 0 {
+		query += " limit ? offset ?"
+		args = append(args, limit, offset)
+	}
+	var res []*Message
+	if err := r.data.db.WithContext(ctx).Raw(query, args...).Scan(&res).Error; err != nil {
+		return nil, 0, err
+	}
+
+	parentIDs := make([]string, len(res))
+	for i := range res {
+		parentIDs[i] = res[i].ParentID
+	}
+	var siblings []*Message
+	if err := r.data.db.WithContext(ctx).Model(&Message{}).Select("message_id, parent_id").
+		Where("conversation_id = ? and parent_id in ?", conversationID, parentIDs).
+		Order("created_at").Find(&siblings).Error; err != nil {
+		return nil, 0, err
+	}
+	children := make(map[string][]string)
+	for i := range siblings {
+		children[siblings[i].ParentID] = append(children[siblings[i].ParentID], siblings[i].MessageID)
+	}
+
+	messages := make([]*biz.MessageResponse, len(res))
+	for i := range res {
+		m := makeBizMessageResponse(res[i])
+		m.SiblingIDs = children[m.ParentID]
+		// the walk goes up from the leaf, the page is read from the root.
+		messages[len(res)-1-i] = m
+	}
+	return messages, count, nil
+}
+
+func (r *messageRepo) DeleteMessagesByConversationID(ctx context.Context, conversationID string) error {
+	return r.data.db.WithContext(ctx).Model(&Message{}).Where("conversation_id = ?", conversationID).Delete(&Message{}).Error
+}
+
+func makeBizMessageResponse(m *Message) *biz.MessageResponse {
+	return &biz.MessageResponse{
+		MessageID:      m.MessageID,
+		ConversationID: m.ConversationID,
+		ParentID:       m.ParentID,
+		AccountID:      m.AccountID,
+		CharacterID:    m.CharacterID,
+		Role:           m.Role,
+		Content:        m.Content,
+		VoiceURL:       m.VoiceURL,
+		TokenCount:     m.TokenCount,
+		Truncated:      m.Truncated,
+		CreateTime:     m.CreatedAt,
+		UpdateTime:     m.UpdatedAt,
+	}
+}
+
+func makeBizMessageResponses(req []*Message) []*biz.MessageResponse {
+	res := make([]*biz.MessageResponse, len(req))
+	for i := range req {
+		res[i] = makeBizMessageResponse(req[i])
+	}
+	return res
+}
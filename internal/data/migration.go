@@ -0,0 +1,40 @@
+package data
+
+import (
+	"context"
+	"starland-backend/configs"
+	"starland-backend/internal/biz"
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+// Migration is a one-off data migration that was run, or is running.
+type Migration struct {
+	Name      string `gorm:"primaryKey;size:255"`
+	CreatedAt time.Time
+}
+
+type migrationRepo struct {
+	cfg  *configs.Config
+	data *Data
+}
+
+func NewMigrationRepo(c *configs.Config, data *Data) biz.MigrationRepo {
+	return &migrationRepo{
+		cfg:  c,
+		data: data,
+	}
+}
+
+func (r *migrationRepo) ClaimMigration(ctx context.Context, name string) (bool, error) {
+	db := r.data.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&Migration{Name: name})
+	if db.Error != nil {
+		return false, db.Error
+	}
+	return db.RowsAffected > 0, nil
+}
+
+func (r *migrationRepo) ReleaseMigration(ctx context.Context, name string) error {
+	return r.data.db.WithContext(ctx).Where("name = ?", name).Delete(&Migration{}).Error
+}
@@ -0,0 +1,157 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"starland-backend/configs"
+	"starland-backend/internal/biz"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+const (
+	replyStreamMaxLen = 4096
+)
+
+type replyRepo struct {
+	cfg  *configs.Config
+	data *Data
+}
+
+func NewReplyRepo(c *configs.Config, data *Data) biz.ReplyRepo {
+	return &replyRepo{
+		cfg:  c,
+		data: data,
+	}
+}
+
+func replyStreamKey(conversationID, replyID string) string {
+	return fmt.Sprintf("reply:%s:%s", conversationID, replyID)
+}
+
+func latestReplyKey(conversationID string) string {
+	return fmt.Sprintf("reply:%s:latest", conversationID)
+}
+
+func inflightKey(key string) string {
+	return fmt.Sprintf("inflight:%s", key)
+}
+
+func inflightCancelKey(key string) string {
+	return fmt.Sprintf("inflight:%s:cancel", key)
+}
+
+func inflightReaderKey(key string) string {
+	return fmt.Sprintf("inflight:%s:reader", key)
+}
+
+// AppendReplyEvent adds the event to the stream of the reply. With an
+// expiration the stream is extended and made the latest reply of the
+// conversation, in the same round trip.
+func (r *replyRepo) AppendReplyEvent(ctx context.Context, conversationID, replyID string, event *biz.ReplyEvent,
+	expiration time.Duration) (string, error) {
+	key := replyStreamKey(conversationID, replyID)
+	var id *redis.StringCmd
+	_, err := r.data.rdb.WithContext(ctx).Pipelined(func(pipe redis.Pipeliner) error {
+		id = pipe.XAdd(&redis.XAddArgs{
+			Stream:       key,
+			MaxLenApprox: replyStreamMaxLen,
+			Values: map[string]interface{}{
+				"event": event.Event,
+				"data":  event.Data,
+			},
+		})
+		if expiration > 0 {
+			pipe.Expire(key, expiration)
+			pipe.Set(latestReplyKey(conversationID), replyID, expiration)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return id.Val(), nil
+}
+
+func (r *replyRepo) ReadReplyEvents(ctx context.Context, conversationID, replyID, afterID string,
+	block time.Duration) ([]*biz.ReplyEvent, error) {
+	streams, err := r.data.readerRdb.WithContext(ctx).XRead(&redis.XReadArgs{
+		Streams: []string{replyStreamKey(conversationID, replyID), afterID},
+		Block:   block,
+	}).Result()
+	if err == redis.Nil {
+		return []*biz.ReplyEvent{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*biz.ReplyEvent, 0)
+	for i := range streams {
+		for _, m := range streams[i].Messages {
+			event, _ := m.Values["event"].(string)
+			data, _ := m.Values["data"].(string)
+			res = append(res, &biz.ReplyEvent{
+				ID:    m.ID,
+				Event: event,
+				Data:  data,
+			})
+		}
+	}
+	return res, nil
+}
+
+func (r *replyRepo) QueryLatestReply(ctx context.Context, conversationID string) (string, error) {
+	res, err := r.data.rdb.WithContext(ctx).Get(latestReplyKey(conversationID)).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return res, err
+}
+
+func (r *replyRepo) SaveInflight(ctx context.Context, key, accountID string, expiration, readerTimeout time.Duration) error {
+	_, err := r.data.rdb.WithContext(ctx).TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.Set(inflightKey(key), accountID, expiration)
+		pipe.Del(inflightCancelKey(key))
+		if readerTimeout > 0 {
+			pipe.Set(inflightReaderKey(key), 1, readerTimeout)
+		}
+		return nil
+	})
+	return err
+}
+
+func (r *replyRepo) RefreshInflight(ctx context.Context, key string, expiration time.Duration) (bool, bool, error) {
+	var cancelled, read *redis.IntCmd
+	_, err := r.data.rdb.WithContext(ctx).Pipelined(func(pipe redis.Pipeliner) error {
+		pipe.Expire(inflightKey(key), expiration)
+		cancelled = pipe.Exists(inflightCancelKey(key))
+		read = pipe.Exists(inflightReaderKey(key))
+		return nil
+	})
+	if err != nil {
+		return false, false, err
+	}
+	return cancelled.Val() > 0, read.Val() > 0, nil
+}
+
+func (r *replyRepo) DeleteInflight(ctx context.Context, key string) error {
+	return r.data.rdb.WithContext(ctx).Del(inflightKey(key), inflightCancelKey(key), inflightReaderKey(key)).Err()
+}
+
+func (r *replyRepo) QueryInflight(ctx context.Context, key string) (string, error) {
+	res, err := r.data.rdb.WithContext(ctx).Get(inflightKey(key)).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return res, err
+}
+
+func (r *replyRepo) CancelInflight(ctx context.Context, key string, expiration time.Duration) error {
+	return r.data.rdb.WithContext(ctx).Set(inflightCancelKey(key), 1, expiration).Err()
+}
+
+func (r *replyRepo) TouchInflightReader(ctx context.Context, key string, timeout time.Duration) error {
+	return r.data.rdb.WithContext(ctx).Set(inflightReaderKey(key), 1, timeout).Err()
+}
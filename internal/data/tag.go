@@ -0,0 +1,187 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"starland-backend/configs"
+	"starland-backend/internal/biz"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type TagCategory struct {
+	gorm.Model
+	Slug  string                                `gorm:"uniqueIndex;size:64"`
+	Names datatypes.JSONType[map[string]string] `gorm:"type:text"`
+	Sort  int
+}
+
+type TaxonomyTag struct {
+	gorm.Model
+	Slug     string                                `gorm:"uniqueIndex;size:255"`
+	Category string                                `gorm:"index;size:64"`
+	Names    datatypes.JSONType[map[string]string] `gorm:"type:text"`
+	Sort     int
+}
+
+// TagAlias maps a normalized spelling of a tag onto its canonical tag.
+type TagAlias struct {
+	gorm.Model
+	Alias   string `gorm:"uniqueIndex;size:255"`
+	TagSlug string `gorm:"index;size:255"`
+}
+
+type tagRepo struct {
+	cfg  *configs.Config
+	data *Data
+}
+
+func NewTagRepo(c *configs.Config, data *Data) biz.TagRepo {
+	return &tagRepo{
+		cfg:  c,
+		data: data,
+	}
+}
+
+func (r *tagRepo) QueryTagCategories(ctx context.Context) ([]*biz.TagCategory, error) {
+	var res []*TagCategory
+	if err := r.data.db.WithContext(ctx).Model(&TagCategory{}).Order("sort, slug").Find(&res).Error; err != nil {
+		return nil, err
+	}
+	categories := make([]*biz.TagCategory, len(res))
+	for i := range res {
+		categories[i] = &biz.TagCategory{
+			Slug:  res[i].Slug,
+			Names: res[i].Names.Data(),
+			Sort:  res[i].Sort,
+		}
+	}
+	return categories, nil
+}
+
+func (r *tagRepo) QueryCategorizedTags(ctx context.Context) ([]*biz.TaxonomyTag, error) {
+	var res []*TaxonomyTag
+	if err := r.data.db.WithContext(ctx).Model(&TaxonomyTag{}).Where("category != ''").
+		Order("sort, slug").Find(&res).Error; err != nil {
+		return nil, err
+	}
+	tags := make([]*biz.TaxonomyTag, len(res))
+	for i := range res {
+		tags[i] = makeBizTaxonomyTag(res[i])
+	}
+	return tags, nil
+}
+
+func (r *tagRepo) QueryTagByAlias(ctx context.Context, alias string) (*biz.TaxonomyTag, error) {
+	var tag *TaxonomyTag
+	if err := r.data.db.WithContext(ctx).Model(&TaxonomyTag{}).
+		Joins("join tag_aliases on tag_aliases.tag_slug = taxonomy_tags.slug and tag_aliases.deleted_at is null").
+		Where("tag_aliases.alias = ?", alias).First(&tag).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return makeBizTaxonomyTag(tag), nil
+}
+
+// SaveTag creates the tag and its slug alias unless they exist, then loads
+// the stored tag into req, so that a tag created concurrently wins.
+func (r *tagRepo) SaveTag(ctx context.Context, req *biz.TaxonomyTag) error {
+	return r.data.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		tag := &TaxonomyTag{
+			Slug:     req.Slug,
+			Category: req.Category,
+			Names:    datatypes.NewJSONType(req.Names),
+			Sort:     req.Sort,
+		}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&tag).Error; err != nil {
+			return err
+		}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&TagAlias{Alias: req.Slug, TagSlug: req.Slug}).Error; err != nil {
+			return err
+		}
+
+		var stored *TaxonomyTag
+		if err := tx.Model(&TaxonomyTag{}).Where("slug = ?", req.Slug).First(&stored).Error; err != nil {
+			return err
+		}
+		*req = *makeBizTaxonomyTag(stored)
+		return nil
+	})
+}
+
+func (r *tagRepo) SaveTagCategory(ctx context.Context, req *biz.TagCategory) error {
+	return r.data.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "slug"}},
+		DoUpdates: clause.AssignmentColumns([]string{"names", "sort", "updated_at"}),
+	}).Create(&TagCategory{
+		Slug:  req.Slug,
+		Names: datatypes.NewJSONType(req.Names),
+		Sort:  req.Sort,
+	}).Error
+}
+
+func (r *tagRepo) SaveCuratedTag(ctx context.Context, req *biz.TaxonomyTag, aliases []string) error {
+	return r.data.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "slug"}},
+			DoUpdates: clause.AssignmentColumns([]string{"category", "names", "sort", "updated_at"}),
+		}).Create(&TaxonomyTag{
+			Slug:     req.Slug,
+			Category: req.Category,
+			Names:    datatypes.NewJSONType(req.Names),
+			Sort:     req.Sort,
+		}).Error; err != nil {
+			return err
+		}
+		for _, alias := range append([]string{req.Slug}, aliases...) {
+			if err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "alias"}},
+				DoUpdates: clause.AssignmentColumns([]string{"tag_slug", "updated_at"}),
+			}).Create(&TagAlias{Alias: alias, TagSlug: req.Slug}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *tagRepo) QueryCharacterTags(ctx context.Context, afterID string, limit int) ([]*biz.CharacterTags, error) {
+	var res []*Character
+	if err := r.data.db.WithContext(ctx).Model(&Character{}).Select("id, tag").Where("id > ?", afterID).
+		Order("id").Limit(limit).Find(&res).Error; err != nil {
+		return nil, err
+	}
+	characters := make([]*biz.CharacterTags, len(res))
+	for i := range res {
+		tags := make(map[string]string, len(res[i].Tag))
+		for _, t := range res[i].Tag {
+			tags[t.Key] = t.Value
+		}
+		characters[i] = &biz.CharacterTags{CharacterID: res[i].ID, Tags: tags}
+	}
+	return characters, nil
+}
+
+// UpdateCharacterTags leaves updated_at alone, the character was not edited.
+func (r *tagRepo) UpdateCharacterTags(ctx context.Context, id string, tags map[string]string) error {
+	tag := make([]Tag, 0, len(tags))
+	for k, v := range tags {
+		tag = append(tag, Tag{Key: k, Value: v})
+	}
+	return r.data.db.WithContext(ctx).Model(&Character{}).Where("id = ?", id).
+		UpdateColumn("tag", datatypes.JSONSlice[Tag](tag)).Error
+}
+
+func makeBizTaxonomyTag(tag *TaxonomyTag) *biz.TaxonomyTag {
+	return &biz.TaxonomyTag{
+		Slug:     tag.Slug,
+		Category: tag.Category,
+		Names:    tag.Names.Data(),
+		Sort:     tag.Sort,
+	}
+}
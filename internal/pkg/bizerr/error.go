@@ -33,4 +33,12 @@ var (
 	ErrChunkNotExist          = NewBizError("chunk not exists", NotExist)
 	ErrVoiceNotExist          = NewBizError("voice not exists", NotExist)
 	ErrNoPermissionToModify   = NewBizError("no permission to modify", NoEntitlement)
+	ErrConversationNotExist   = NewBizError("conversation not exists", NotExist)
+	ErrMessageNotExist        = NewBizError("message not exists", NotExist)
+	ErrBadRequest             = NewBizError("bad request", BadRequest)
+	ErrReplyNotExist          = NewBizError("reply not exists", NotExist)
+	ErrMemoryNotExist         = NewBizError("memory not exists", NotExist)
+	ErrSessionNotExist        = NewBizError("session not exists", NotExist)
+	ErrRevisionNotExist       = NewBizError("revision not exists", NotExist)
+	ErrCollectionNotExist     = NewBizError("collection not exists", NotExist)
 )
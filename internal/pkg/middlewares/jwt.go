@@ -42,7 +42,10 @@ func JwtParse() fiber.Handler {
 			return ctx.Next()
 		},
 		ErrorHandler: func(ctx *fiber.Ctx, err error) error {
-			if strings.HasSuffix(ctx.Path(), "/character") && string(ctx.Request().Header.Method()) == "GET" {
+			// listing and searching the characters work without an account.
+			path := ctx.Path()
+			if (strings.HasSuffix(path, "/character") || strings.HasSuffix(path, "/character/search")) &&
+				string(ctx.Request().Header.Method()) == "GET" {
 				return ctx.Next()
 			}
 			zap.S().Info(ctx.Get(fiber.HeaderAuthorization))
@@ -127,6 +127,26 @@ func Base64ToVoiceFile(base64str string) (string, error) {
 	return fileName, nil
 }
 
+// CountTokens roughly estimates the token count of a message: every Han
+// character counts as one token and everything else is counted per word.
+func CountTokens(text string) int {
+	var count int
+	inWord := false
+	for _, char := range text {
+		switch {
+		case unicode.Is(unicode.Scripts["Han"], char):
+			count++
+			inWord = false
+		case unicode.IsSpace(char) || unicode.IsPunct(char):
+			inWord = false
+		case !inWord:
+			count++
+			inWord = true
+		}
+	}
+	return count
+}
+
 func URL2FileName(url string) string {
 	parts := strings.Split(url, "/")
 	fileName := parts[len(parts)-1]
@@ -0,0 +1,89 @@
+package util
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+)
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+var ErrInvalidPNG = errors.New("invalid png")
+
+func IsPNG(data []byte) bool {
+	return bytes.HasPrefix(data, pngSignature)
+}
+
+// EmbedPNGText returns the png with a tEXt chunk holding text under keyword,
+// placed right after the header and replacing any chunk of the same keyword.
+func EmbedPNGText(data []byte, keyword, text string) ([]byte, error) {
+	if !IsPNG(data) {
+		return nil, ErrInvalidPNG
+	}
+	var out bytes.Buffer
+	out.Write(pngSignature)
+	err := walkPNGChunks(data, func(typ string, body, raw []byte) {
+		if typ == "tEXt" && bytes.HasPrefix(body, []byte(keyword+"\x00")) {
+			return
+		}
+		out.Write(raw)
+		if typ == "IHDR" {
+			writePNGChunk(&out, "tEXt", append([]byte(keyword+"\x00"), text...))
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// ExtractPNGText returns the text of the first tEXt chunk under keyword.
+func ExtractPNGText(data []byte, keyword string) (string, bool, error) {
+	if !IsPNG(data) {
+		return "", false, ErrInvalidPNG
+	}
+	var (
+		text  string
+		found bool
+	)
+	err := walkPNGChunks(data, func(typ string, body, _ []byte) {
+		if !found && typ == "tEXt" && bytes.HasPrefix(body, []byte(keyword+"\x00")) {
+			text = string(body[len(keyword)+1:])
+			found = true
+		}
+	})
+	return text, found, err
+}
+
+func walkPNGChunks(data []byte, fn func(typ string, body, raw []byte)) error {
+	for p := len(pngSignature); p < len(data); {
+		if len(data)-p < 12 {
+			return ErrInvalidPNG
+		}
+		n := int(binary.BigEndian.Uint32(data[p:]))
+		if n < 0 || len(data)-p-12 < n {
+			return ErrInvalidPNG
+		}
+		typ := string(data[p+4 : p+8])
+		fn(typ, data[p+8:p+8+n], data[p:p+12+n])
+		p += 12 + n
+		if typ == "IEND" {
+			return nil
+		}
+	}
+	return ErrInvalidPNG
+}
+
+func writePNGChunk(w *bytes.Buffer, typ string, body []byte) {
+	var n [4]byte
+	binary.BigEndian.PutUint32(n[:], uint32(len(body)))
+	w.Write(n[:])
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(typ))
+	crc.Write(body)
+	w.WriteString(typ)
+	w.Write(body)
+	binary.BigEndian.PutUint32(n[:], crc.Sum32())
+	w.Write(n[:])
+}
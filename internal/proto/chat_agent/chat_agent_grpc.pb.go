@@ -21,6 +21,7 @@ const _ = grpc.SupportPackageIsVersion7
 const (
 	Agent_Chat_FullMethodName       = "/starland_chat_agent.Agent/Chat"
 	Agent_ChatStream_FullMethodName = "/starland_chat_agent.Agent/ChatStream"
+	Agent_Summarize_FullMethodName  = "/starland_chat_agent.Agent/Summarize"
 )
 
 // AgentClient is the client API for Agent service.
@@ -29,6 +30,7 @@ const (
 type AgentClient interface {
 	Chat(ctx context.Context, in *ChatRequest, opts ...grpc.CallOption) (*ChatResponse, error)
 	ChatStream(ctx context.Context, in *ChatRequest, opts ...grpc.CallOption) (Agent_ChatStreamClient, error)
+	Summarize(ctx context.Context, in *SummarizeRequest, opts ...grpc.CallOption) (*SummarizeResponse, error)
 }
 
 type agentClient struct {
@@ -80,12 +82,22 @@ func (x *agentChatStreamClient) Recv() (*ChatStreamResponse, error) {
 	return m, nil
 }
 
+func (c *agentClient) Summarize(ctx context.Context, in *SummarizeRequest, opts ...grpc.CallOption) (*SummarizeResponse, error) {
+	out := new(SummarizeResponse)
+	err := c.cc.Invoke(ctx, Agent_Summarize_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // AgentServer is the server API for Agent service.
 // All implementations must embed UnimplementedAgentServer
 // for forward compatibility
 type AgentServer interface {
 	Chat(context.Context, *ChatRequest) (*ChatResponse, error)
 	ChatStream(*ChatRequest, Agent_ChatStreamServer) error
+	Summarize(context.Context, *SummarizeRequest) (*SummarizeResponse, error)
 	mustEmbedUnimplementedAgentServer()
 }
 
@@ -99,6 +111,9 @@ func (UnimplementedAgentServer) Chat(context.Context, *ChatRequest) (*ChatRespon
 func (UnimplementedAgentServer) ChatStream(*ChatRequest, Agent_ChatStreamServer) error {
 	return status.Errorf(codes.Unimplemented, "method ChatStream not implemented")
 }
+func (UnimplementedAgentServer) Summarize(context.Context, *SummarizeRequest) (*SummarizeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Summarize not implemented")
+}
 func (UnimplementedAgentServer) mustEmbedUnimplementedAgentServer() {}
 
 // UnsafeAgentServer may be embedded to opt out of forward compatibility for this service.
@@ -151,6 +166,24 @@ func (x *agentChatStreamServer) Send(m *ChatStreamResponse) error {
 	return x.ServerStream.SendMsg(m)
 }
 
+func _Agent_Summarize_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SummarizeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AgentServer).Summarize(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Agent_Summarize_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AgentServer).Summarize(ctx, req.(*SummarizeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // Agent_ServiceDesc is the grpc.ServiceDesc for Agent service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -162,6 +195,10 @@ var Agent_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Chat",
 			Handler:    _Agent_Chat_Handler,
 		},
+		{
+			MethodName: "Summarize",
+			Handler:    _Agent_Summarize_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
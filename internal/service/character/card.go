@@ -0,0 +1,237 @@
+package character
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	"image/png"
+	"os"
+	"starland-backend/internal/biz"
+	"starland-backend/internal/pkg/bizerr"
+	"starland-backend/internal/pkg/util"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	CardFormatJSON = "json"
+	CardFormatPNG  = "png"
+
+	CardSpec        = "chara_card_v2"
+	CardSpecVersion = "2.0"
+
+	// cardChunkKeyword names the tEXt chunk holding the card of a PNG card.
+	cardChunkKeyword = "chara"
+	// cardExampleSeparator starts each example dialogue of mes_example.
+	cardExampleSeparator = "<START>"
+)
+
+// ExportCharacterCard renders a public or unlisted character as a character
+// card, json when no format is given, or a PNG of its portrait carrying the card.
+func (s *CharacterService) ExportCharacterCard(ctx context.Context, req *ExportCharacterCardRequest) (*ExportCharacterCardResponse, error) {
+	ch, err := s.queryVisibleCharacter(ctx, "", req.CharacterID)
+	if err != nil {
+		return nil, fmt.Errorf("ExportCharacterCard: [CharacterId: %s] query character err: %w", req.CharacterID, err)
+	}
+	if ch.State == biz.StateUnconfirmed {
+		return nil, bizerr.ErrCharacterNotExist
+	}
+
+	card, err := json.Marshal(makeCharacterCard(ch))
+	if err != nil {
+		return nil, fmt.Errorf("ExportCharacterCard: marshal card err: %w", err)
+	}
+	res := &ExportCharacterCardResponse{
+		FileName: fmt.Sprintf("character-%s", ch.ID),
+	}
+	switch req.Format {
+	case CardFormatJSON, "":
+		res.Body = card
+		res.ContentType = "application/json"
+		res.FileName += ".json"
+	case CardFormatPNG:
+		portrait, err := s.portraitPNG(ch.ImageURL)
+		if err != nil {
+			return nil, fmt.Errorf("ExportCharacterCard: [CharacterId: %s] load portrait err: %w", ch.ID, err)
+		}
+		res.Body, err = util.EmbedPNGText(portrait, cardChunkKeyword, base64.StdEncoding.EncodeToString(card))
+		if err != nil {
+			return nil, fmt.Errorf("ExportCharacterCard: [CharacterId: %s] embed card err: %w", ch.ID, err)
+		}
+		res.ContentType = "image/png"
+		res.FileName += ".png"
+	default:
+		return nil, bizerr.ErrBadRequest.Wrap(fmt.Errorf("unknown card format %q", req.Format))
+	}
+	return res, nil
+}
+
+// ImportCharacterCard creates a character of the account from a JSON card or
+// a PNG card, whose portrait the caller already stored as req.Image.
+func (s *CharacterService) ImportCharacterCard(ctx context.Context, req *ImportCharacterCardRequest) (*CharacterResponse, error) {
+	data, err := parseCharacterCard(req.Card)
+	if err != nil {
+		return nil, err
+	}
+
+	create := &CreateManualCharacterRequest{
+		ID:               req.ID,
+		AccountID:        req.AccountID,
+		Name:             data.Name,
+		Description:      joinCardPrompt(data),
+		Introduction:     data.CreatorNotes,
+		Tags:             make(map[string]string),
+		Greeting:         data.FirstMes,
+		ExampleDialogues: splitCardExamples(data.MesExample),
+	}
+	for _, tag := range data.Tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || utf8.RuneCountInString(tag) > maxTagLength {
+			continue
+		}
+		if len(create.Tags) == maxTags {
+			break
+		}
+		create.Tags[tag] = tag
+	}
+	if ext := data.Extensions.Starland; ext != nil {
+		create.Gender = ext.Gender
+		create.Is3D = ext.Is3D
+		// voices of another deployment are unknown here, the character
+		// falls back to the default voice.
+		if ext.Voice != "" {
+			if _, err = s.voice.QueryCharacterVoice(ctx, ext.Voice); err == nil {
+				create.Voice = ext.Voice
+			}
+		}
+	}
+	if req.Image != "" {
+		create.Image = req.Image
+		create.Images = []string{req.Image}
+	}
+
+	res, err := s.createCharacter(ctx, create, true)
+	if err != nil {
+		return nil, fmt.Errorf("ImportCharacterCard: %w", err)
+	}
+	return res, nil
+}
+
+// portraitPNG reads the stored portrait behind the image url as a PNG.
+func (s *CharacterService) portraitPNG(imageURL string) ([]byte, error) {
+	path, ok := s.imageFilePath(imageURL)
+	if !ok {
+		return nil, bizerr.ErrBadRequest.Wrap(errors.New("character has no stored portrait"))
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if util.IsPNG(raw) {
+		return raw, nil
+	}
+	img, _, err := image.Decode(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err = png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// parseCharacterCard reads a JSON or PNG card, accepting both the v2 spec
+// and the flat cards of the first spec.
+func parseCharacterCard(raw []byte) (*CharacterCardData, error) {
+	if util.IsPNG(raw) {
+		text, ok, err := util.ExtractPNGText(raw, cardChunkKeyword)
+		if err != nil {
+			return nil, bizerr.ErrBadRequest.Wrap(fmt.Errorf("read png card err: %w", err))
+		}
+		if !ok {
+			return nil, bizerr.ErrBadRequest.Wrap(errors.New("png holds no character card"))
+		}
+		if raw, err = base64.StdEncoding.DecodeString(text); err != nil {
+			return nil, bizerr.ErrBadRequest.Wrap(fmt.Errorf("decode png card err: %w", err))
+		}
+	}
+
+	var card CharacterCard
+	if err := json.Unmarshal(raw, &card); err != nil {
+		return nil, bizerr.ErrBadRequest.Wrap(fmt.Errorf("parse card err: %w", err))
+	}
+	data := card.Data
+	if data == nil {
+		data = new(CharacterCardData)
+		if err := json.Unmarshal(raw, data); err != nil {
+			return nil, bizerr.ErrBadRequest.Wrap(fmt.Errorf("parse card err: %w", err))
+		}
+	}
+	if strings.TrimSpace(data.Name) == "" {
+		return nil, bizerr.ErrBadRequest.Wrap(errors.New("card has no name"))
+	}
+	return data, nil
+}
+
+func makeCharacterCard(ch *biz.CharacterResponse) *CharacterCard {
+	tags := make([]string, len(ch.Tag))
+	for i := range ch.Tag {
+		tags[i] = ch.Tag[i].Value
+	}
+	var examples strings.Builder
+	for i := range ch.ExampleDialogues {
+		if i > 0 {
+			examples.WriteString("\n")
+		}
+		examples.WriteString(cardExampleSeparator + "\n" + ch.ExampleDialogues[i])
+	}
+	return &CharacterCard{
+		Spec:        CardSpec,
+		SpecVersion: CardSpecVersion,
+		Data: &CharacterCardData{
+			Name:         ch.Name,
+			Description:  ch.Prompt,
+			FirstMes:     ch.Greeting,
+			MesExample:   examples.String(),
+			CreatorNotes: ch.Introduction,
+			Tags:         tags,
+			Creator:      ch.AccountName,
+			Extensions: CharacterCardExtensions{
+				Starland: &CharacterCardStarland{
+					Gender: ch.Gender,
+					Voice:  ch.Voice,
+					Is3D:   ch.Is3D,
+				},
+			},
+		},
+	}
+}
+
+// joinCardPrompt folds the personality and scenario of a card, which the
+// character has no fields for, into its prompt.
+func joinCardPrompt(data *CharacterCardData) string {
+	prompt := strings.TrimSpace(data.Description)
+	if p := strings.TrimSpace(data.Personality); p != "" {
+		prompt += "\n\nPersonality: " + p
+	}
+	if sc := strings.TrimSpace(data.Scenario); sc != "" {
+		prompt += "\n\nScenario: " + sc
+	}
+	return strings.TrimSpace(prompt)
+}
+
+func splitCardExamples(mesExample string) []string {
+	var examples []string
+	for _, e := range strings.Split(mesExample, cardExampleSeparator) {
+		if e = strings.TrimSpace(e); e != "" {
+			examples = append(examples, e)
+		}
+	}
+	return examples
+}
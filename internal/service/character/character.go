@@ -5,7 +5,6 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"os"
 	"sort"
 	config "starland-backend/configs"
 	"starland-backend/internal/biz"
@@ -19,15 +18,17 @@ import (
 )
 
 const (
-	Stage1 int = iota
-	Stage2
-	Stage3
-	Stage4
-	Stage5
+	StageNone = biz.CreationStageNone
+	Stage1    = biz.CreationStage1
+	Stage2    = biz.CreationStage2
+	Stage3    = biz.CreationStage3
+	Stage4    = biz.CreationStage4
+	Stage5    = biz.CreationStage5
 
 	AdminName = "StarLand.AI"
 
-	Unconfirmed int = -1
+	// defaultHistoryLimit pages the chat history when the client does not.
+	defaultHistoryLimit = 20
 )
 
 func (s *CharacterService) CreateCharacter(ctx context.Context,
@@ -94,8 +95,8 @@ func (s *CharacterService) CreateCharacter(ctx context.Context,
 				Name:        ccsRes.CharacterSetting.Name,
 				AccountName: accountInfo.Name,
 				AvatarURL:   accountInfo.AvatarURL,
-				Tags:        ccsRes.CharacterSetting.Tags,
-				State:       Unconfirmed,
+				Tags:        s.normalizeTags(ctx, ccsRes.CharacterSetting.Tags),
+				State:       biz.StateUnconfirmed,
 			}
 
 			_, err = s.character.SaveMyCharacter(ctx, character)
@@ -119,6 +120,9 @@ func (s *CharacterService) CreateCharacter(ctx context.Context,
 			if err != nil {
 				return nil, fmt.Errorf("CreateCharacter: save character err: %w", err)
 			}
+			if _, err = s.recordRevision(ctx, req.SessionID, biz.RevisionCreate, 0); err != nil {
+				zap.S().Errorf("CreateCharacter: %v", err)
+			}
 			err = s.ativity.PostActivity(ctx, account, biz.CreateCharacter)
 			if err != nil {
 				zap.S().Errorf("CreateCharacter: [Account: %s] add points err: %w ", account, err)
@@ -147,11 +151,27 @@ func (s *CharacterService) CreateCharacterV2(ctx context.Context,
 
 	ctx = context.Background()
 	if req.SessionID != "" {
+		sess, err := s.loadCreationSession(ctx, req.SessionID, account)
+		if err != nil {
+			return nil, fmt.Errorf("CreateCharacterV2: [SessionId: %s] err: %w", req.SessionID, err)
+		}
+		if err = checkCreationStage(sess, req); err != nil {
+			return nil, fmt.Errorf("CreateCharacterV2: [SessionId: %s State: %d] err: %w", req.SessionID, req.State, err)
+		}
 		switch req.State {
 		case Stage1, Stage4:
+			streamCtx := req.StreamCtx
+			if streamCtx == nil {
+				streamCtx = context.Background()
+			}
+			streamCtx, cancel := context.WithCancel(streamCtx)
+			key := sessionInflightKey(req.SessionID)
+			s.inflight.add(key, account, cancel, 0)
+			defer s.inflight.remove(key)
+
 			resCh := make(chan biz.ChatCompletionStreamResponseChunk)
 			go func() {
-				err = s.character.ChatCompletionsStream(context.Background(), &biz.ChatCompletionsRequest{
+				err = s.character.ChatCompletionsStream(streamCtx, &biz.ChatCompletionsRequest{
 					SessionID: req.SessionID,
 					ResCh:     resCh,
 					Message: &biz.ChatMessage{
@@ -183,28 +203,20 @@ func (s *CharacterService) CreateCharacterV2(ctx context.Context,
 						for i := range res.ImageChunk {
 							res.ImageChunk[i] = fmt.Sprintf("%s%s.png", filePath, res.ImageChunk[i])
 						}
-						if ims, ok := s.imageCache.Get(req.SessionID); ok {
-							list := ims.([]string)
-							list = append(list, res.ImageChunk...)
-							err = s.imageCache.Add(req.SessionID, list, time.Hour)
-							if err != nil {
-								zap.S().Errorf("CreateCharacterV2: gen image to cache")
-							}
-						} else {
-							err = s.imageCache.Add(req.SessionID, res.ImageChunk, time.Hour)
-							if err != nil {
-								zap.S().Errorf("CreateCharacterV2: gen image to cache")
-							}
-						}
+						sess.Images = append(sess.Images, res.ImageChunk...)
+						s.saveCreationSession(ctx, sess)
 					}
 					data := makeChatCompletionStreamResponseChunk(historyRes, req.SessionID, voice, is3D, res)
-					req.ResCh <- data
+					sendCreateChunk(streamCtx, req.ResCh, data)
 					if res.ChatChunk != nil {
 						content = fmt.Sprintf("%s%s", content, data.Message)
 					}
 				} else {
 					historyRes.Message = content
-					req.ResCh <- *historyRes
+					historyRes.ChunkType = 0
+					sendCreateChunk(streamCtx, req.ResCh, *historyRes)
+					sess.Complete(req.State)
+					s.saveCreationSession(ctx, sess)
 					return &CreateCharacterResponse{
 						SessionID: req.SessionID,
 					}, nil
@@ -239,16 +251,19 @@ func (s *CharacterService) CreateCharacterV2(ctx context.Context,
 				Gender:       gender,
 				AccountName:  accountInfo.Name,
 				AvatarURL:    accountInfo.AvatarURL,
-				Tags:         ccsRes.CharacterSetting.Tags,
+				Tags:         s.normalizeTags(ctx, ccsRes.CharacterSetting.Tags),
 				Introduction: ccsRes.CharacterSetting.Introduction,
 				Is3D:         req.Is3D,
-				State:        Unconfirmed,
+				State:        biz.StateUnconfirmed,
 			}
 
 			_, err = s.character.SaveMyCharacter(ctx, character)
 			if err != nil {
 				return nil, fmt.Errorf("CreateCharacterV2: save character err: %w", err)
 			}
+			sess.Is3D = req.Is3D
+			sess.Complete(Stage2)
+			s.saveCreationSession(ctx, sess)
 			res := &CreateCharacterResponse{
 				ChatMessage: makeChatMessage(ccsRes.Message),
 				ConfirmType: ccsRes.ConfirmType,
@@ -268,12 +283,15 @@ func (s *CharacterService) CreateCharacterV2(ctx context.Context,
 			character := &biz.CharacterRequest{
 				ID:    req.SessionID,
 				Voice: req.Message,
-				State: Unconfirmed,
+				State: biz.StateUnconfirmed,
 			}
 			_, err = s.character.SaveMyCharacter(ctx, character)
 			if err != nil {
 				return nil, fmt.Errorf("CreateCharacterV2: save character voice err: %w", err)
 			}
+			sess.Voice = req.Message
+			sess.Complete(Stage3)
+			s.saveCreationSession(ctx, sess)
 			res := ChatCompletionStreamResponseChunk{
 				NeedConfirmChunk: true,
 			}
@@ -289,24 +307,27 @@ func (s *CharacterService) CreateCharacterV2(ctx context.Context,
 			}
 
 			character := &biz.CharacterRequest{
-				ID:       req.SessionID,
-				ImageURL: req.Message,
-				Is3D:     req.Is3D,
-				State:    0,
+				ID:               req.SessionID,
+				ImageURL:         req.Message,
+				Is3D:             req.Is3D,
+				State:            0,
+				Visibility:       req.Visibility,
+				Greeting:         req.Greeting,
+				ExampleDialogues: req.ExampleDialogues,
 			}
 			_, err = s.character.SaveMyCharacter(ctx, character)
 			if err != nil {
 				return nil, fmt.Errorf("CreateCharacterV2: save character err: %w", err)
 			}
-			if ims, ok := s.imageCache.Get(req.SessionID); ok {
-				imList := ims.([]string)
-				for i := range imList {
-					if !strings.Contains(req.Message, imList[i]) {
-						file := fmt.Sprintf("%s%s", s.cfg.File.ImagePath, imList[i])
-						os.Remove(file)
-					}
-				}
+			if _, err = s.recordRevision(ctx, req.SessionID, biz.RevisionCreate, 0); err != nil {
+				zap.S().Errorf("CreateCharacterV2: %v", err)
 			}
+			s.indexCharacter(ctx, req.SessionID)
+			s.removeSessionImages(sess, req.Message)
+			sess.Images = nil
+			sess.Is3D = req.Is3D
+			sess.Complete(Stage5)
+			s.saveCreationSession(ctx, sess)
 			err = s.ativity.PostActivity(ctx, account, biz.CreateCharacter)
 			if err != nil {
 				zap.S().Errorf("CreateCharacterV2: [Account: %s] add points err: %w ", account, err)
@@ -318,8 +339,12 @@ func (s *CharacterService) CreateCharacterV2(ctx context.Context,
 		}
 		return nil, nil
 	} else {
+		sess, err := s.newCreationSession(ctx, uuid.NewString(), account)
+		if err != nil {
+			return nil, fmt.Errorf("CreateCharacterV2: create session err: %w", err)
+		}
 		req.ResCh <- ChatCompletionStreamResponseChunk{
-			SessionID: uuid.NewString(),
+			SessionID: sess.SessionID,
 		}
 		return nil, nil
 	}
@@ -464,12 +489,19 @@ func (s *CharacterService) QueryCharacters(ctx context.Context, req *QueryCharac
 	if req.Account != "" {
 		characters, count, err = s.character.QueryCharactersByAccount(ctx, req.Account, req.Search, req.Page, req.Limit)
 	} else {
-		characters, count, err = s.character.QueryCharactersByNameOrPrompt(ctx, req.Search, req.Page, req.Limit)
+		var tag string
+		if tag, err = s.resolveTag(ctx, req.Tag); err != nil {
+			return nil, 0, fmt.Errorf("QueryCharacters: [Tag: %s] resolve tag err: %w", req.Tag, err)
+		}
+		characters, count, err = s.character.QueryCharactersByNameOrPrompt(ctx, req.Search, tag, req.Sort, req.Page, req.Limit)
 	}
 	if err != nil {
 		return nil, count, fmt.Errorf("QueryCharacters: query err: %w", err)
 	}
 	res := s.makeQueryCharacterResponse(accountID, characters)
+	if req.Sort != "" {
+		return res, count, nil
+	}
 	sort.Slice(res, func(i, j int) bool {
 		if res[i].AccountName == AdminName && res[j].AccountName == AdminName {
 			return res[i].LikeCount+res[i].ChatCount >= res[j].LikeCount+res[j].ChatCount
@@ -489,7 +521,7 @@ func (s *CharacterService) Chat(ctx context.Context, req *ChatRequest) (*ChatRes
 		return nil, err
 	}
 
-	_, err = s.character.QueryCharacterByID(ctx, req.CharacterID)
+	_, err = s.queryVisibleCharacter(ctx, account, req.CharacterID)
 	if err != nil {
 		return nil, fmt.Errorf("Chat: [CharacterId: %s Message: %s] query characterId err: %w ", req.CharacterID, req.Message, err)
 	}
@@ -555,37 +587,40 @@ func (s *CharacterService) ChatV2(ctx context.Context, req *ChatRequestV2) error
 		return err
 	}
 
-	ch, err := s.character.QueryCharacterByID(ctx, req.CharacterID)
+	ch, err := s.queryVisibleCharacter(ctx, account, req.CharacterID)
 	if err != nil {
 		return fmt.Errorf("ChatV2: [CharacterId: %s Message: %s] query characterId err: %w ", req.CharacterID, req.Message, err)
 	}
 
-	cr, err := s.conversation.QueryConversation(ctx, req.AccountID, req.CharacterID)
-	if err != nil {
-		return fmt.Errorf("ChatV2: [CharacterID: %s Message: %s] query conversationId err: %w ", req.CharacterID, req.Message, err)
-	}
-	if cr == nil {
-		cr = &biz.ConversationResponse{
-			ConversationID: "",
-		}
-		var count int64
-		count, err = s.conversation.QueryConversationsCount(ctx, req.CharacterID)
+	var cr *biz.ConversationResponse
+	if req.ConversationID != "" {
+		cr, err = s.queryOwnConversation(ctx, req.AccountID, req.ConversationID)
 		if err != nil {
-			return fmt.Errorf("ChatV2: (character_id:%s  account_id:%s)query chat count err: %w", req.CharacterID, req.AccountID, err)
+			return fmt.Errorf("ChatV2: [ConversationID: %s] query conversation err: %w ", req.ConversationID, err)
 		}
-
-		chReq := &biz.CharacterRequest{
-			ID:        req.CharacterID,
-			ChatCount: int(count) + 1,
+		if cr.CharacterID != req.CharacterID {
+			return bizerr.ErrConversationNotExist
 		}
-
-		_, err = s.character.SaveMyCharacter(ctx, chReq)
+	} else {
+		cr, err = s.conversation.QueryConversation(ctx, req.AccountID, req.CharacterID)
 		if err != nil {
-			return fmt.Errorf("ChatV2: (character_id:%s  account_id:%s) save like count err: %w", req.CharacterID, req.AccountID, err)
+			return fmt.Errorf("ChatV2: [CharacterID: %s Message: %s] query conversationId err: %w ", req.CharacterID, req.Message, err)
 		}
 	}
 
-	conversationID, err := s.conversation.SaveConversation(ctx, req.AccountID, req.CharacterID, cr.ConversationID)
+	var (
+		conversationID string
+		activeID       string
+	)
+	if cr == nil {
+		conversationID, err = s.newConversation(ctx, req.AccountID, req.CharacterID, makeConversationTitle(req.Message))
+		if err == nil {
+			activeID, err = s.saveGreeting(ctx, conversationID, req.AccountID, ch)
+		}
+	} else {
+		activeID = cr.ActiveMessageID
+		conversationID, err = s.conversation.SaveConversation(ctx, req.AccountID, req.CharacterID, cr.ConversationID)
+	}
 	if err != nil {
 		return fmt.Errorf("ChatV2: save conversation err: %w ", err)
 	}
@@ -594,18 +629,29 @@ func (s *CharacterService) ChatV2(ctx context.Context, req *ChatRequestV2) error
 		CharacterID:    req.CharacterID,
 		ConversationID: conversationID,
 	}
-	go func() {
-		err = s.character.ChatStream(context.Background(), &biz.ChatRequest{
-			ConversationID: cr.ConversationID,
-			CharacterId:    cr.CharacterID,
-			Message:        req.Message,
-			ResCh:          req.ResCh,
-			CharacterName:  ch.Name,
-		})
-		if err != nil {
-			zap.S().Errorf("ChatV2: [ConversationId: %s Message: %s] err: %v ", cr.ConversationID, req.Message, err)
-		}
-	}()
+	req.ConversationID = conversationID
+
+	turn, history, err := s.prepareChatTurn(ctx, conversationID, activeID, req)
+	if err != nil {
+		return fmt.Errorf("ChatV2: [ConversationID: %s Action: %s] prepare turn err: %w ", conversationID, req.Action, err)
+	}
+	req.Message = turn.Content
+	req.ParentMessageID = turn.MessageID
+
+	streamCtx, cancel := context.WithCancel(context.Background())
+	req.ReplyID = uuid.NewString()
+	s.inflight.add(replyInflightKey(conversationID, req.ReplyID), req.AccountID, cancel, replyDetachTimeout)
+	go s.produceReply(streamCtx, req, &biz.ChatRequest{
+		ConversationID: cr.ConversationID,
+		CharacterId:    cr.CharacterID,
+		Message:        req.Message,
+		CharacterName:  ch.Name,
+		History:        history,
+		Settings:       ch.Settings,
+		Memories:       s.chatMemories(ctx, req.AccountID, req.CharacterID),
+
+		ExampleDialogues: ch.ExampleDialogues,
+	})
 
 	err = s.ativity.PostActivity(ctx, req.AccountID, biz.Chat)
 	if err != nil {
@@ -614,29 +660,51 @@ func (s *CharacterService) ChatV2(ctx context.Context, req *ChatRequestV2) error
 
 	return nil
 }
+
 func (s *CharacterService) QueryCharactersHistory(ctx context.Context,
 	req *QueryCharactersHistoryRequest) ([]*QueryCharactersHistoryResponse, int64, error) {
-	cr, count, err := s.conversation.QueryConversations(ctx, req.Account, req.Page, req.Limit)
+	page, limit := req.Page, req.Limit
+	if page <= 0 {
+		page = 1
+	}
+	if limit <= 0 {
+		limit = defaultHistoryLimit
+	}
+	cr, count, err := s.conversation.QueryConversations(ctx, req.Account, page, limit)
 	if err != nil {
 		return nil, count, fmt.Errorf("QueryCharactersHistory: query conversations err: %w ", err)
 	}
 
+	ids := make([]string, 0, len(cr))
+	for i := range cr {
+		ids = append(ids, cr[i].CharacterID)
+	}
+	characters, err := s.character.QueryCharactersByIDs(ctx, ids)
+	if err != nil {
+		return nil, count, fmt.Errorf("QueryCharactersHistory: query characters err: %w ", err)
+	}
+	byID := make(map[string]*biz.CharacterResponse, len(characters))
+	for i := range characters {
+		byID[characters[i].ID] = characters[i]
+	}
+
 	res := make([]*QueryCharactersHistoryResponse, 0)
 	for i := range cr {
-		character, err := s.character.QueryCharacterByID(ctx, cr[i].CharacterID)
-		if err != nil {
-			zap.S().Errorf("QueryCharactersHistory: query character err: %w ", err)
+		character, ok := byID[cr[i].CharacterID]
+		if !ok || !character.VisibleTo(req.Account) {
 			continue
 		}
 		res = append(res, &QueryCharactersHistoryResponse{
-			AccountName: character.AccountName,
-			AvatarURL:   character.AvatarURL,
-			Name:        character.Name,
-			Gender:      character.Gender,
-			ImageURL:    character.ImageURL,
-			IsMint:      character.IsMint,
-			LatestTime:  cr[i].UpdateTime,
-			CharacterID: character.ID,
+			AccountName:    character.AccountName,
+			AvatarURL:      character.AvatarURL,
+			Name:           character.Name,
+			Gender:         character.Gender,
+			ImageURL:       character.ImageURL,
+			IsMint:         character.IsMint,
+			LatestTime:     cr[i].UpdateTime,
+			CharacterID:    character.ID,
+			ConversationID: cr[i].ConversationID,
+			Title:          cr[i].Title,
 		})
 	}
 
@@ -644,24 +712,18 @@ func (s *CharacterService) QueryCharactersHistory(ctx context.Context,
 }
 
 func (s *CharacterService) QueryCharacterInfo(ctx context.Context, id string) (*QueryCharacterResponse, error) {
-	cr, err := s.character.QueryCharacterByID(ctx, id)
-	if err != nil {
-		return nil, fmt.Errorf("QueryCharacterInfo: query character info err: %w", err)
-	}
-
-	tags := make([]Tag, len(cr.Tag))
-	for i := range cr.Tag {
-		tags[i] = Tag{
-			Key:   cr.Tag[i].Key,
-			Value: cr.Tag[i].Value,
-		}
-	}
 	var accountID string
 	account := ctx.Value("account")
 	if account != nil {
 		zap.S().Info("accountID:", account)
 		accountID = account.(string)
 	}
+	cr, err := s.queryVisibleCharacter(ctx, accountID, id)
+	if err != nil {
+		return nil, fmt.Errorf("QueryCharacterInfo: query character info err: %w", err)
+	}
+
+	tags := makeTags(cr.Tag)
 
 	isLike, err := s.character.QueryCharacterLikeByAccount(context.Background(), id, accountID)
 	if err != nil {
@@ -686,15 +748,39 @@ func (s *CharacterService) QueryCharacterInfo(ctx context.Context, id string) (*
 		ImageURLs:   cr.ImageURLs,
 		Is3D:        cr.Is3D,
 		Voice:       cr.Voice,
+		Visibility:  cr.Visibility,
+		ForkCount:   cr.ForkCount,
+
+		Greeting:         cr.Greeting,
+		ExampleDialogues: cr.ExampleDialogues,
+	}
+	if cr.ForkedFrom != "" {
+		res.ForkedFrom = s.queryForkAttribution(ctx, cr.ForkedFrom)
 	}
 	if cr.Is3D {
 		res.ObjURL = strings.Replace(res.ImageURL, ".png", ".obj", 1)
 		res.GlbURL = strings.Replace(res.ImageURL, ".png", ".glb", 1)
 	}
+	if accountID != "" && accountID == cr.AccountID {
+		res.GenerationSettings = makeGenerationSettings(cr.Settings)
+	}
 	zap.S().Infof("res: ", account, cr.AccountID)
 	return res, nil
 }
 
+// queryVisibleCharacter loads a character the account may see, private
+// characters of other accounts are reported as missing.
+func (s *CharacterService) queryVisibleCharacter(ctx context.Context, accountID, id string) (*biz.CharacterResponse, error) {
+	ch, err := s.character.QueryCharacterByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !ch.VisibleTo(accountID) {
+		return nil, bizerr.ErrCharacterNotExist
+	}
+	return ch, nil
+}
+
 func (s *CharacterService) CharacterMint(ctx context.Context, req *CharacterMintRequest) error {
 	zap.S().Infof("CharacterMint: req: %+v", *req)
 	if _, err := s.character.QueryCharacterByID(ctx, req.ID); err != nil {
@@ -705,6 +791,7 @@ func (s *CharacterService) CharacterMint(ctx context.Context, req *CharacterMint
 	if err != nil {
 		return fmt.Errorf("CharacterMint: save mint err: %w", err)
 	}
+	s.indexCharacter(ctx, req.ID)
 	return nil
 }
 
@@ -755,6 +842,24 @@ func (s *CharacterService) UpdateCharacter(ctx context.Context, req *UpdateChara
 	if ch.AccountID != req.AccountID {
 		return bizerr.ErrNoPermissionToModify
 	}
+	if err = checkGenerationSettings(req.Settings); err != nil {
+		return err
+	}
+	if err = checkVisibility(req.Visibility); err != nil {
+		return err
+	}
+	if req.Greeting != nil || req.ExampleDialogues != nil {
+		greeting := ch.Greeting
+		if req.Greeting != nil {
+			greeting = *req.Greeting
+		}
+		if err = checkDialogues(greeting, req.ExampleDialogues); err != nil {
+			return err
+		}
+	}
+	if err = s.recordBaseline(ctx, ch); err != nil {
+		return fmt.Errorf("UpdateCharacter: %w", err)
+	}
 	zap.S().Info(req.Images[0])
 
 	sort.Slice(req.Images, func(i, j int) bool {
@@ -772,9 +877,21 @@ func (s *CharacterService) UpdateCharacter(ctx context.Context, req *UpdateChara
 		Name:        req.Name,
 		Image:       req.Image,
 		Voice:       req.Voice,
+		Visibility:  req.Visibility,
+		Settings:    makeBizGenerationSettings(req.Settings),
+
+		Greeting:         req.Greeting,
+		ExampleDialogues: req.ExampleDialogues,
 	}); err != nil {
 		return fmt.Errorf("UpdateCharacter: update err: %w", err)
 	}
+	if _, err = s.recordRevision(ctx, req.ID, biz.RevisionUpdate, 0); err != nil {
+		return fmt.Errorf("UpdateCharacter: %w", err)
+	}
+	s.indexCharacter(ctx, req.ID)
+	if req.Visibility == biz.VisibilityPrivate {
+		s.pruneCollections(ctx, req.ID, ch.AccountID)
+	}
 	return nil
 }
 
@@ -792,9 +909,22 @@ func (s *CharacterService) DeleteCharacter(ctx context.Context, req *DeleteChara
 	if err != nil {
 		return fmt.Errorf("DeleteCharacter: delete character err: %w", err)
 	}
+	s.indexCharacter(ctx, req.ID)
+	s.pruneCollections(ctx, req.ID, "")
 	return nil
 }
 
+func makeTags(req []biz.Tag) []Tag {
+	res := make([]Tag, len(req))
+	for i := range req {
+		res[i] = Tag{
+			Key:   req[i].Key,
+			Value: req[i].Value,
+		}
+	}
+	return res
+}
+
 func makeChatMessage(req []*biz.ChatMessage) []string {
 	res := make([]string, len(req))
 	for i := range req {
@@ -840,12 +970,13 @@ func makeImageModelResponse(req []*biz.ImageModel) []*ImageModelResponse {
 
 func makeCharacterResponse(req *biz.CharacterResponse) *CharacterResponse {
 	return &CharacterResponse{
-		ID:        req.ID,
-		AccountID: req.AccountID,
-		Name:      req.Name,
-		Gender:    req.Gender,
-		Prompt:    req.Introduction,
-		ImageURL:  req.ImageURL,
+		ID:         req.ID,
+		AccountID:  req.AccountID,
+		Name:       req.Name,
+		Gender:     req.Gender,
+		Prompt:     req.Introduction,
+		ImageURL:   req.ImageURL,
+		Visibility: req.Visibility,
 	}
 }
 
@@ -877,6 +1008,71 @@ func (s *CharacterService) makeQueryCharacterResponse(accountID string, req []*b
 	return res
 }
 
+const (
+	maxTemperature   = 2
+	maxStopSequences = 4
+)
+
+func checkGenerationSettings(req *GenerationSettings) error {
+	if req == nil {
+		return nil
+	}
+	if req.Temperature != nil && (*req.Temperature < 0 || *req.Temperature > maxTemperature) {
+		return bizerr.ErrBadRequest.Wrap(fmt.Errorf("temperature must be between 0 and %d", maxTemperature))
+	}
+	if req.MaxHistory != nil && *req.MaxHistory < 0 {
+		return bizerr.ErrBadRequest.Wrap(errors.New("max history must not be negative"))
+	}
+	if req.MaxReplyLength != nil && *req.MaxReplyLength < 0 {
+		return bizerr.ErrBadRequest.Wrap(errors.New("max reply length must not be negative"))
+	}
+	if len(req.StopSequences) > maxStopSequences {
+		return bizerr.ErrBadRequest.Wrap(fmt.Errorf("at most %d stop sequences are allowed", maxStopSequences))
+	}
+	return nil
+}
+
+// checkVisibility accepts the visibilities of a character, 0 leaving it as is.
+func checkVisibility(visibility int) error {
+	if visibility < 0 || visibility > biz.VisibilityPrivate {
+		return bizerr.ErrBadRequest.Wrap(fmt.Errorf("unknown visibility %d", visibility))
+	}
+	return nil
+}
+
+func makeGenerationSettings(req *biz.GenerationSettings) *GenerationSettings {
+	if req == nil {
+		return nil
+	}
+	return &GenerationSettings{
+		Temperature:    req.Temperature,
+		MaxHistory:     req.MaxHistory,
+		MaxReplyLength: req.MaxReplyLength,
+		StopSequences:  req.StopSequences,
+	}
+}
+
+func makeBizGenerationSettings(req *GenerationSettings) *biz.GenerationSettings {
+	if req == nil {
+		return nil
+	}
+	return &biz.GenerationSettings{
+		Temperature:    req.Temperature,
+		MaxHistory:     req.MaxHistory,
+		MaxReplyLength: req.MaxReplyLength,
+		StopSequences:  req.StopSequences,
+	}
+}
+
+// sendCreateChunk gives up on the chunk once the stream is cancelled, the
+// client reading the channel may be gone by then.
+func sendCreateChunk(ctx context.Context, ch chan<- ChatCompletionStreamResponseChunk, data ChatCompletionStreamResponseChunk) {
+	select {
+	case ch <- data:
+	case <-ctx.Done():
+	}
+}
+
 func makeChatCompletionStreamResponseChunk(historyRes *ChatCompletionStreamResponseChunk, session_id, voice string, Is3D bool, req biz.ChatCompletionStreamResponseChunk) ChatCompletionStreamResponseChunk {
 	var settingChunk struct {
 		Description string `json:"description"`
@@ -885,6 +1081,7 @@ func makeChatCompletionStreamResponseChunk(historyRes *ChatCompletionStreamRespo
 		Voice       string `json:"voice,omitempty"`
 	}
 
+	historyRes.ChunkType = req.ChunkType
 	switch req.ChunkType {
 	case biz.ChatChunk:
 		historyRes.Message = req.ChatChunk.Content
@@ -0,0 +1,256 @@
+package character
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"starland-backend/internal/biz"
+	"starland-backend/internal/pkg/bizerr"
+	"strings"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+)
+
+const (
+	maxCollectionNameLength        = 50
+	maxCollectionDescriptionLength = 1000
+)
+
+// QueryLikedCharacters lists the characters the account likes, the last
+// liked first.
+func (s *CharacterService) QueryLikedCharacters(ctx context.Context, req *QueryLikedCharactersRequest) ([]*QueryCharacterResponse, int64, error) {
+	characters, count, err := s.character.QueryLikedCharacters(ctx, req.AccountID, req.Page, req.Limit)
+	if err != nil {
+		return nil, count, fmt.Errorf("QueryLikedCharacters: [AccountId: %s] query err: %w", req.AccountID, err)
+	}
+	return s.makeQueryCharacterResponse(req.AccountID, characters), count, nil
+}
+
+func (s *CharacterService) CreateCollection(ctx context.Context, req *CreateCollectionRequest) (*CollectionResponse, error) {
+	name := strings.TrimSpace(req.Name)
+	visibility := req.Visibility
+	if visibility == 0 {
+		visibility = biz.VisibilityPublic
+	}
+	if err := checkCollection(name, req.Description, visibility); err != nil {
+		return nil, err
+	}
+
+	id, err := s.collection.CreateCollection(ctx, &biz.CollectionRequest{
+		AccountID:   req.AccountID,
+		Name:        name,
+		Description: req.Description,
+		Visibility:  visibility,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("CreateCollection: %w", err)
+	}
+	c, err := s.collection.QueryCollection(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("CreateCollection: query collection err: %w", err)
+	}
+	return makeCollectionResponse(c), nil
+}
+
+func (s *CharacterService) QueryCollections(ctx context.Context, req *QueryCollectionsRequest) ([]*CollectionResponse, int64, error) {
+	owner := req.Owner
+	if owner == "" {
+		owner = req.AccountID
+	}
+	collections, count, err := s.collection.QueryCollections(ctx, owner, owner != req.AccountID, req.Page, req.Limit)
+	if err != nil {
+		return nil, count, fmt.Errorf("QueryCollections: [Owner: %s] query err: %w", owner, err)
+	}
+	res := make([]*CollectionResponse, len(collections))
+	for i := range collections {
+		res[i] = makeCollectionResponse(collections[i])
+	}
+	return res, count, nil
+}
+
+func (s *CharacterService) QueryCollection(ctx context.Context, req *CollectionRequest) (*CollectionResponse, error) {
+	c, err := s.queryVisibleCollection(ctx, req.AccountID, req.CollectionID)
+	if err != nil {
+		return nil, fmt.Errorf("QueryCollection: %w", err)
+	}
+	return makeCollectionResponse(c), nil
+}
+
+func (s *CharacterService) UpdateCollection(ctx context.Context, req *UpdateCollectionRequest) (*CollectionResponse, error) {
+	c, err := s.queryOwnCollection(ctx, req.AccountID, req.CollectionID)
+	if err != nil {
+		return nil, fmt.Errorf("UpdateCollection: %w", err)
+	}
+	name, description, visibility := c.Name, c.Description, c.Visibility
+	if req.Name != nil {
+		name = strings.TrimSpace(*req.Name)
+		req.Name = &name
+	}
+	if req.Description != nil {
+		description = *req.Description
+	}
+	if req.Visibility != nil {
+		visibility = *req.Visibility
+	}
+	if err = checkCollection(name, description, visibility); err != nil {
+		return nil, err
+	}
+
+	if err = s.collection.UpdateCollection(ctx, &biz.UpdateCollectionRequest{
+		CollectionID: req.CollectionID,
+		Name:         req.Name,
+		Description:  req.Description,
+		Visibility:   req.Visibility,
+	}); err != nil {
+		return nil, fmt.Errorf("UpdateCollection: %w", err)
+	}
+	if c, err = s.collection.QueryCollection(ctx, req.CollectionID); err != nil {
+		return nil, fmt.Errorf("UpdateCollection: query collection err: %w", err)
+	}
+	return makeCollectionResponse(c), nil
+}
+
+func (s *CharacterService) DeleteCollection(ctx context.Context, req *CollectionRequest) error {
+	if _, err := s.queryOwnCollection(ctx, req.AccountID, req.CollectionID); err != nil {
+		return fmt.Errorf("DeleteCollection: %w", err)
+	}
+	if err := s.collection.DeleteCollection(ctx, req.CollectionID); err != nil {
+		return fmt.Errorf("DeleteCollection: %w", err)
+	}
+	return nil
+}
+
+// QueryCollectionCharacters pages through the characters of the collection
+// in their order, leaving out the ones gone or hidden from the account.
+func (s *CharacterService) QueryCollectionCharacters(ctx context.Context,
+	req *QueryCollectionCharactersRequest) ([]*QueryCharacterResponse, int64, error) {
+	if _, err := s.queryVisibleCollection(ctx, req.AccountID, req.CollectionID); err != nil {
+		return nil, 0, fmt.Errorf("QueryCollectionCharacters: %w", err)
+	}
+	ids, err := s.collection.QueryCollectionCharacterIDs(ctx, req.CollectionID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("QueryCollectionCharacters: %w", err)
+	}
+	characters, err := s.character.QueryCharactersByIDs(ctx, ids)
+	if err != nil {
+		return nil, 0, fmt.Errorf("QueryCollectionCharacters: query characters err: %w", err)
+	}
+	visible := make([]*biz.CharacterResponse, 0, len(characters))
+	for i := range characters {
+		if characters[i].State != biz.StateUnconfirmed && characters[i].VisibleTo(req.AccountID) {
+			visible = append(visible, characters[i])
+		}
+	}
+
+	count := int64(len(visible))
+	start := (req.Page - 1) * req.Limit
+	if start < 0 || start >= len(visible) {
+		return []*QueryCharacterResponse{}, count, nil
+	}
+	end := start + req.Limit
+	if req.Limit <= 0 || end > len(visible) {
+		end = len(visible)
+	}
+	return s.makeQueryCharacterResponse(req.AccountID, visible[start:end]), count, nil
+}
+
+func (s *CharacterService) AddCollectionCharacter(ctx context.Context, req *CollectionCharacterRequest) error {
+	if _, err := s.queryOwnCollection(ctx, req.AccountID, req.CollectionID); err != nil {
+		return fmt.Errorf("AddCollectionCharacter: %w", err)
+	}
+	ch, err := s.queryVisibleCharacter(ctx, req.AccountID, req.CharacterID)
+	if err != nil {
+		return fmt.Errorf("AddCollectionCharacter: [CharacterId: %s] query character err: %w", req.CharacterID, err)
+	}
+	if ch.State == biz.StateUnconfirmed {
+		return bizerr.ErrCharacterNotExist
+	}
+	if err = s.collection.AddCollectionCharacter(ctx, req.CollectionID, req.CharacterID); err != nil {
+		return fmt.Errorf("AddCollectionCharacter: %w", err)
+	}
+	return nil
+}
+
+func (s *CharacterService) RemoveCollectionCharacter(ctx context.Context, req *CollectionCharacterRequest) error {
+	if _, err := s.queryOwnCollection(ctx, req.AccountID, req.CollectionID); err != nil {
+		return fmt.Errorf("RemoveCollectionCharacter: %w", err)
+	}
+	if err := s.collection.RemoveCollectionCharacter(ctx, req.CollectionID, req.CharacterID); err != nil {
+		return fmt.Errorf("RemoveCollectionCharacter: %w", err)
+	}
+	return nil
+}
+
+// SortCollection moves the characters listed to the front of the collection,
+// in the order given.
+func (s *CharacterService) SortCollection(ctx context.Context, req *SortCollectionRequest) error {
+	if _, err := s.queryOwnCollection(ctx, req.AccountID, req.CollectionID); err != nil {
+		return fmt.Errorf("SortCollection: %w", err)
+	}
+	if err := s.collection.SortCollectionCharacters(ctx, req.CollectionID, req.CharacterIDs); err != nil {
+		return fmt.Errorf("SortCollection: %w", err)
+	}
+	return nil
+}
+
+// queryVisibleCollection returns the collection when the account may see it,
+// a private collection of another account being reported as missing.
+func (s *CharacterService) queryVisibleCollection(ctx context.Context, accountID, id string) (*biz.CollectionResponse, error) {
+	c, err := s.collection.QueryCollection(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !c.VisibleTo(accountID) {
+		return nil, bizerr.ErrCollectionNotExist
+	}
+	return c, nil
+}
+
+func (s *CharacterService) queryOwnCollection(ctx context.Context, accountID, id string) (*biz.CollectionResponse, error) {
+	c, err := s.queryVisibleCollection(ctx, accountID, id)
+	if err != nil {
+		return nil, err
+	}
+	if c.AccountID != accountID {
+		return nil, bizerr.ErrNoPermissionToModify
+	}
+	return c, nil
+}
+
+func checkCollection(name, description string, visibility int) error {
+	if name == "" {
+		return bizerr.ErrBadRequest.Wrap(errors.New("name is required"))
+	}
+	if utf8.RuneCountInString(name) > maxCollectionNameLength {
+		return bizerr.ErrBadRequest.Wrap(fmt.Errorf("name is longer than %d characters", maxCollectionNameLength))
+	}
+	if utf8.RuneCountInString(description) > maxCollectionDescriptionLength {
+		return bizerr.ErrBadRequest.Wrap(fmt.Errorf("description is longer than %d characters", maxCollectionDescriptionLength))
+	}
+	if visibility != biz.VisibilityPublic && visibility != biz.VisibilityPrivate {
+		return bizerr.ErrBadRequest.Wrap(fmt.Errorf("visibility must be %d or %d", biz.VisibilityPublic, biz.VisibilityPrivate))
+	}
+	return nil
+}
+
+func makeCollectionResponse(req *biz.CollectionResponse) *CollectionResponse {
+	return &CollectionResponse{
+		CollectionID:   req.CollectionID,
+		AccountID:      req.AccountID,
+		Name:           req.Name,
+		Description:    req.Description,
+		Visibility:     req.Visibility,
+		CharacterCount: req.CharacterCount,
+		CreateTime:     req.CreateTime,
+		UpdateTime:     req.UpdateTime,
+	}
+}
+
+// pruneCollections takes a character out of the collections that may no
+// longer show it. A failure leaves hidden rows behind, so it is only logged.
+func (s *CharacterService) pruneCollections(ctx context.Context, characterID, ownerID string) {
+	if err := s.collection.RemoveCharacter(ctx, characterID, ownerID); err != nil {
+		zap.S().Errorf("pruneCollections: %v", err)
+	}
+}
@@ -0,0 +1,192 @@
+package character
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"starland-backend/internal/biz"
+	"starland-backend/internal/pkg/bizerr"
+	"starland-backend/internal/pkg/util"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+const (
+	conversationTitleLength = 30
+	// defaultConversationTitle names the threads started without a title.
+	defaultConversationTitle = "New chat"
+)
+
+func (s *CharacterService) CreateConversation(ctx context.Context, req *CreateConversationRequest) (*ConversationResponse, error) {
+	ch, err := s.queryVisibleCharacter(ctx, req.AccountID, req.CharacterID)
+	if err != nil {
+		return nil, fmt.Errorf("CreateConversation: query character err: %w", err)
+	}
+
+	title := capConversationTitle(req.Title)
+	if title == "" {
+		title = defaultConversationTitle
+	}
+	id, err := s.newConversation(ctx, req.AccountID, req.CharacterID, title)
+	if err != nil {
+		return nil, fmt.Errorf("CreateConversation: %w", err)
+	}
+	if _, err = s.saveGreeting(ctx, id, req.AccountID, ch); err != nil {
+		return nil, fmt.Errorf("CreateConversation: %w", err)
+	}
+
+	cr, err := s.conversation.QueryConversationByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("CreateConversation: query conversation err: %w", err)
+	}
+	return makeConversationResponse(cr), nil
+}
+
+func (s *CharacterService) QueryConversations(ctx context.Context, req *QueryConversationsRequest) ([]*ConversationResponse, int64, error) {
+	crs, count, err := s.conversation.QueryConversationsByCharacter(ctx, req.AccountID, req.CharacterID, req.Archived, req.Page, req.Limit)
+	if err != nil {
+		return nil, count, fmt.Errorf("QueryConversations: query conversations err: %w", err)
+	}
+
+	res := make([]*ConversationResponse, len(crs))
+	for i := range crs {
+		res[i] = makeConversationResponse(crs[i])
+	}
+	return res, count, nil
+}
+
+func (s *CharacterService) UpdateConversation(ctx context.Context, req *UpdateConversationRequest) error {
+	if _, err := s.queryOwnConversation(ctx, req.AccountID, req.ID); err != nil {
+		return fmt.Errorf("UpdateConversation: %w", err)
+	}
+
+	if req.Title != nil {
+		title := capConversationTitle(*req.Title)
+		if title == "" {
+			return bizerr.ErrBadRequest.Wrap(errors.New("the title of a conversation cannot be empty"))
+		}
+		if err := s.conversation.RenameConversation(ctx, req.ID, title); err != nil {
+			return fmt.Errorf("UpdateConversation: rename err: %w", err)
+		}
+	}
+	if req.Archived != nil {
+		if err := s.conversation.ArchiveConversation(ctx, req.ID, *req.Archived); err != nil {
+			return fmt.Errorf("UpdateConversation: archive err: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *CharacterService) DeleteConversation(ctx context.Context, req *DeleteConversationRequest) error {
+	if _, err := s.queryOwnConversation(ctx, req.AccountID, req.ID); err != nil {
+		return fmt.Errorf("DeleteConversation: %w", err)
+	}
+
+	if err := s.conversation.DeleteConversation(ctx, req.ID); err != nil {
+		return fmt.Errorf("DeleteConversation: delete conversation err: %w", err)
+	}
+	if err := s.message.DeleteMessages(ctx, req.ID); err != nil {
+		return fmt.Errorf("DeleteConversation: delete messages err: %w", err)
+	}
+	return nil
+}
+
+// queryOwnConversation loads a conversation and makes sure it belongs to the account.
+func (s *CharacterService) queryOwnConversation(ctx context.Context, accountID, id string) (*biz.ConversationResponse, error) {
+	cr, err := s.conversation.QueryConversationByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if cr.AccountID != accountID {
+		return nil, bizerr.ErrNoPermissionToModify
+	}
+	return cr, nil
+}
+
+// newConversation opens a new thread on the current revision of the
+// character and refreshes its chat count, the number of accounts that talked
+// to it.
+func (s *CharacterService) newConversation(ctx context.Context, accountID, characterID, title string) (string, error) {
+	version, err := s.revision.QueryLatestVersion(ctx, characterID)
+	if err != nil {
+		zap.S().Errorf("newConversation: (character_id:%s  account_id:%s) query revision err: %v", characterID, accountID, err)
+	}
+	id, err := s.conversation.CreateConversation(ctx, accountID, characterID, title, version)
+	if err != nil {
+		return "", fmt.Errorf("create conversation err: %w", err)
+	}
+	s.refreshChatCount(ctx, accountID, characterID)
+	return id, nil
+}
+
+// refreshChatCount recounts the accounts that talked to the character.
+func (s *CharacterService) refreshChatCount(ctx context.Context, accountID, characterID string) {
+	count, err := s.conversation.QueryConversationsCount(ctx, characterID)
+	if err != nil {
+		zap.S().Errorf("refreshChatCount: (character_id:%s  account_id:%s) query chat count err: %v", characterID, accountID, err)
+		return
+	}
+	_, err = s.character.SaveMyCharacter(ctx, &biz.CharacterRequest{
+		ID:        characterID,
+		ChatCount: int(count),
+	})
+	if err != nil {
+		zap.S().Errorf("refreshChatCount: (character_id:%s  account_id:%s) save chat count err: %v", characterID, accountID, err)
+	}
+}
+
+// saveGreeting opens a new conversation with the greeting of the character
+// as its first assistant message, returning the id of the message saved.
+func (s *CharacterService) saveGreeting(ctx context.Context, conversationID, accountID string,
+	ch *biz.CharacterResponse) (string, error) {
+	if strings.TrimSpace(ch.Greeting) == "" {
+		return "", nil
+	}
+	id, err := s.message.SaveMessage(ctx, &biz.MessageRequest{
+		ConversationID: conversationID,
+		AccountID:      accountID,
+		CharacterID:    ch.ID,
+		Role:           biz.MessageRoleAssistant,
+		Content:        ch.Greeting,
+		TokenCount:     util.CountTokens(ch.Greeting),
+	})
+	if err != nil {
+		return "", fmt.Errorf("[ConversationId: %s] save greeting err: %w", conversationID, err)
+	}
+	if err = s.conversation.SetActiveMessage(ctx, conversationID, id); err != nil {
+		return "", fmt.Errorf("[ConversationId: %s] set active message err: %w", conversationID, err)
+	}
+	return id, nil
+}
+
+func makeConversationTitle(message string) string {
+	title := []rune(message)
+	if len(title) > conversationTitleLength {
+		return string(title[:conversationTitleLength]) + "..."
+	}
+	return string(title)
+}
+
+// capConversationTitle trims a title given by the client and cuts it to
+// conversationTitleLength characters.
+func capConversationTitle(title string) string {
+	runes := []rune(strings.TrimSpace(title))
+	if len(runes) > conversationTitleLength {
+		runes = runes[:conversationTitleLength]
+	}
+	return strings.TrimSpace(string(runes))
+}
+
+func makeConversationResponse(req *biz.ConversationResponse) *ConversationResponse {
+	return &ConversationResponse{
+		ConversationID: req.ConversationID,
+		CharacterID:    req.CharacterID,
+		Title:          req.Title,
+		Archived:       req.Archived,
+
+		CharacterVersion: req.CharacterVersion,
+		CreateTime:       req.CreateTime,
+		LatestTime:       req.UpdateTime,
+	}
+}
@@ -0,0 +1,77 @@
+package character
+
+import (
+	"context"
+	"fmt"
+)
+
+// QueryCreatorProfile returns the public profile of the creator, whether the
+// account follows them included.
+func (s *CharacterService) QueryCreatorProfile(ctx context.Context, req *CreatorRequest) (*CreatorProfileResponse, error) {
+	account, err := s.ativity.QueryAccount(ctx, req.CreatorID)
+	if err != nil {
+		return nil, fmt.Errorf("QueryCreatorProfile: [CreatorId: %s] query account err: %w", req.CreatorID, err)
+	}
+	stats, err := s.character.QueryCreatorStats(ctx, req.CreatorID)
+	if err != nil {
+		return nil, fmt.Errorf("QueryCreatorProfile: %w", err)
+	}
+	followers, following, err := s.follow.QueryFollowCounts(ctx, req.CreatorID)
+	if err != nil {
+		return nil, fmt.Errorf("QueryCreatorProfile: [CreatorId: %s] %w", req.CreatorID, err)
+	}
+	isFollowing, err := s.follow.IsFollowing(ctx, req.AccountID, req.CreatorID)
+	if err != nil {
+		return nil, fmt.Errorf("QueryCreatorProfile: %w", err)
+	}
+
+	return &CreatorProfileResponse{
+		AccountID:      req.CreatorID,
+		Name:           account.Name,
+		AvatarURL:      account.AvatarURL,
+		CharacterCount: stats.CharacterCount,
+		LikeCount:      stats.LikeCount,
+		ChatCount:      stats.ChatCount,
+		FollowerCount:  followers,
+		FollowingCount: following,
+		IsFollowing:    isFollowing,
+	}, nil
+}
+
+// QueryCreatorCharacters lists the public characters of the creator, the
+// newest first.
+func (s *CharacterService) QueryCreatorCharacters(ctx context.Context,
+	req *QueryCreatorCharactersRequest) ([]*QueryCharacterResponse, int64, error) {
+	characters, count, err := s.character.QueryCreatorCharacters(ctx, req.CreatorID, req.Page, req.Limit)
+	if err != nil {
+		return nil, count, fmt.Errorf("QueryCreatorCharacters: [CreatorId: %s] %w", req.CreatorID, err)
+	}
+	return s.makeQueryCharacterResponse(req.AccountID, characters), count, nil
+}
+
+func (s *CharacterService) FollowCreator(ctx context.Context, req *CreatorRequest) error {
+	if _, err := s.ativity.QueryAccount(ctx, req.CreatorID); err != nil {
+		return fmt.Errorf("FollowCreator: [CreatorId: %s] query account err: %w", req.CreatorID, err)
+	}
+	if err := s.follow.Follow(ctx, req.AccountID, req.CreatorID); err != nil {
+		return fmt.Errorf("FollowCreator: %w", err)
+	}
+	return nil
+}
+
+func (s *CharacterService) UnfollowCreator(ctx context.Context, req *CreatorRequest) error {
+	if err := s.follow.Unfollow(ctx, req.AccountID, req.CreatorID); err != nil {
+		return fmt.Errorf("UnfollowCreator: %w", err)
+	}
+	return nil
+}
+
+// QueryFollowingFeed lists the public characters of the creators the account
+// follows, the newest first.
+func (s *CharacterService) QueryFollowingFeed(ctx context.Context, req *QueryFollowingFeedRequest) ([]*QueryCharacterResponse, int64, error) {
+	characters, count, err := s.character.QueryFollowedCharacters(ctx, req.AccountID, req.Page, req.Limit)
+	if err != nil {
+		return nil, count, fmt.Errorf("QueryFollowingFeed: [AccountId: %s] %w", req.AccountID, err)
+	}
+	return s.makeQueryCharacterResponse(req.AccountID, characters), count, nil
+}
@@ -0,0 +1,170 @@
+package character
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"starland-backend/internal/biz"
+	"starland-backend/internal/pkg/bizerr"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultDraftMaxAge        = 7 * 24 * time.Hour
+	defaultDraftPurgeInterval = time.Hour
+	draftPurgeBatch           = 100
+)
+
+func (s *CharacterService) QueryDrafts(ctx context.Context, req *QueryDraftsRequest) ([]*DraftResponse, int64, error) {
+	drafts, count, err := s.character.QueryDrafts(ctx, req.AccountID, req.Page, req.Limit)
+	if err != nil {
+		return nil, count, fmt.Errorf("QueryDrafts: query drafts err: %w", err)
+	}
+
+	res := make([]*DraftResponse, len(drafts))
+	for i := range drafts {
+		res[i] = makeDraftResponse(drafts[i])
+	}
+	return res, count, nil
+}
+
+// ResumeDraft returns the creation session of the draft, restoring it when it
+// expired, so the wizard carries on after the confirmed setting.
+func (s *CharacterService) ResumeDraft(ctx context.Context, req *DraftRequest) (*CreationSessionResponse, error) {
+	draft, err := s.queryOwnDraft(ctx, req.AccountID, req.ID)
+	if err != nil {
+		return nil, fmt.Errorf("ResumeDraft: %w", err)
+	}
+
+	_, err = s.session.QuerySession(ctx, draft.ID)
+	if errors.Is(err, bizerr.ErrSessionNotExist) {
+		sess := biz.NewCreationSession(draft.ID, req.AccountID)
+		sess.Voice = draft.Voice
+		sess.Is3D = draft.Is3D
+		sess.Stage = Stage2
+		if draft.Voice != "" {
+			sess.Stage = Stage3
+		}
+		err = s.session.RestoreSession(ctx, sess)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ResumeDraft: [CharacterId: %s] restore session err: %w", draft.ID, err)
+	}
+
+	res, err := s.QueryCreationSession(ctx, &QueryCreationSessionRequest{
+		AccountID: req.AccountID,
+		SessionID: draft.ID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ResumeDraft: %w", err)
+	}
+	return res, nil
+}
+
+func (s *CharacterService) DiscardDraft(ctx context.Context, req *DraftRequest) error {
+	draft, err := s.queryOwnDraft(ctx, req.AccountID, req.ID)
+	if err != nil {
+		return fmt.Errorf("DiscardDraft: %w", err)
+	}
+	if err = s.discardDraft(ctx, draft); err != nil {
+		return fmt.Errorf("DiscardDraft: %w", err)
+	}
+	return nil
+}
+
+// queryOwnDraft loads a draft and makes sure it belongs to the account.
+func (s *CharacterService) queryOwnDraft(ctx context.Context, accountID, id string) (*biz.CharacterResponse, error) {
+	ch, err := s.character.QueryCharacterByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if ch.State != biz.StateUnconfirmed {
+		return nil, bizerr.ErrCharacterNotExist
+	}
+	if ch.AccountID != accountID {
+		return nil, bizerr.ErrNoPermissionToModify
+	}
+	return ch, nil
+}
+
+// discardDraft deletes the draft with its creation session and the images
+// generated for it. A session that already expired is left to the session
+// purge, which removes its images as well.
+func (s *CharacterService) discardDraft(ctx context.Context, draft *biz.CharacterResponse) error {
+	sess, err := s.session.QuerySession(ctx, draft.ID)
+	if err != nil && !errors.Is(err, bizerr.ErrSessionNotExist) {
+		return fmt.Errorf("[CharacterId: %s] query session err: %w", draft.ID, err)
+	}
+	if sess != nil {
+		s.removeSessionImages(sess, "")
+		if err = s.session.DeleteSession(ctx, sess.SessionID); err != nil {
+			return fmt.Errorf("[CharacterId: %s] delete session err: %w", draft.ID, err)
+		}
+	}
+
+	if err = s.character.DeleteCharacter(ctx, draft.ID); err != nil {
+		return fmt.Errorf("[CharacterId: %s] delete draft err: %w", draft.ID, err)
+	}
+	return nil
+}
+
+// draftTask purges the drafts left untouched for longer than the configured
+// age, sparing those whose wizard is still in progress.
+func (s *CharacterService) draftTask() {
+	defer func() {
+		if p := recover(); p != nil {
+			zap.S().Errorf("draftTask: recover err: %v", p)
+		}
+		s.draftTask()
+	}()
+
+	maxAge, interval := defaultDraftMaxAge, defaultDraftPurgeInterval
+	if s.cfg.Draft != nil {
+		if s.cfg.Draft.MaxAge > 0 {
+			maxAge = s.cfg.Draft.MaxAge
+		}
+		if s.cfg.Draft.PurgeInterval > 0 {
+			interval = s.cfg.Draft.PurgeInterval
+		}
+	}
+	t := time.NewTicker(interval)
+	for range t.C {
+		ctx := context.Background()
+		for {
+			drafts, err := s.character.QueryExpiredDrafts(ctx, maxAge, draftPurgeBatch)
+			if err != nil {
+				zap.S().Errorf("draftTask: query drafts err: %v", err)
+				break
+			}
+			purged := 0
+			for i := range drafts {
+				if _, err = s.session.QuerySession(ctx, drafts[i].ID); err == nil {
+					continue
+				}
+				if err = s.discardDraft(ctx, drafts[i]); err != nil {
+					zap.S().Errorf("draftTask: %v", err)
+					continue
+				}
+				purged++
+			}
+			if len(drafts) < draftPurgeBatch || purged == 0 {
+				break
+			}
+		}
+	}
+}
+
+func makeDraftResponse(req *biz.CharacterResponse) *DraftResponse {
+	return &DraftResponse{
+		ID:           req.ID,
+		Name:         req.Name,
+		Gender:       req.Gender,
+		Introduction: req.Introduction,
+		Tags:         makeTags(req.Tag),
+		Voice:        req.Voice,
+		Is3D:         req.Is3D,
+		UpdateTime:   req.UpdateTime,
+	}
+}
@@ -0,0 +1,197 @@
+package character
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"starland-backend/internal/biz"
+	"starland-backend/internal/pkg/bizerr"
+	"starland-backend/internal/pkg/util"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	ExportFormatJSON     = "json"
+	ExportFormatMarkdown = "markdown"
+	ExportFormatTxt      = "txt"
+
+	// ExportVersion is bumped whenever the JSON export changes in a way older
+	// imports cannot read.
+	ExportVersion = 1
+
+	// importMessageLimit bounds how many messages a single import may restore.
+	importMessageLimit = 2000
+
+	exportTimeLayout = "2006-01-02 15:04:05"
+)
+
+// ExportConversation renders the active branch of the conversation in the
+// requested format, json when none is given.
+func (s *CharacterService) ExportConversation(ctx context.Context, req *ExportConversationRequest) (*ExportConversationResponse, error) {
+	cr, err := s.queryOwnConversation(ctx, req.AccountID, req.ConversationID)
+	if err != nil {
+		return nil, fmt.Errorf("ExportConversation: %w", err)
+	}
+
+	ch, err := s.character.QueryCharacterByID(ctx, cr.CharacterID)
+	if err != nil {
+		return nil, fmt.Errorf("ExportConversation: [CharacterId: %s] query character err: %w", cr.CharacterID, err)
+	}
+	tree, err := s.message.QueryMessageTree(ctx, cr.ConversationID)
+	if err != nil {
+		return nil, fmt.Errorf("ExportConversation: query messages err: %w", err)
+	}
+	leaf := cr.ActiveMessageID
+	if _, ok := tree.Message(leaf); !ok {
+		leaf = tree.Leaf("")
+	}
+	branch := tree.Branch(leaf)
+
+	export := &ConversationExport{
+		Version:        ExportVersion,
+		ConversationID: cr.ConversationID,
+		Title:          cr.Title,
+		CharacterID:    cr.CharacterID,
+		CharacterName:  ch.Name,
+		CreateTime:     cr.CreateTime,
+		ExportTime:     time.Now(),
+		Messages:       make([]*ExportMessage, len(branch)),
+	}
+	for i := range branch {
+		export.Messages[i] = &ExportMessage{
+			Role:       branch[i].Role,
+			Content:    branch[i].Content,
+			Voice:      branch[i].VoiceURL,
+			Truncated:  branch[i].Truncated,
+			CreateTime: branch[i].CreateTime,
+		}
+	}
+
+	res := &ExportConversationResponse{
+		FileName: fmt.Sprintf("conversation-%s", cr.ConversationID),
+	}
+	switch req.Format {
+	case ExportFormatJSON, "":
+		res.Body, err = json.MarshalIndent(export, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("ExportConversation: marshal export err: %w", err)
+		}
+		res.ContentType = "application/json"
+		res.FileName += ".json"
+	case ExportFormatMarkdown:
+		res.Body = renderMarkdownExport(export)
+		res.ContentType = "text/markdown; charset=utf-8"
+		res.FileName += ".md"
+	case ExportFormatTxt:
+		res.Body = renderTxtExport(export)
+		res.ContentType = "text/plain; charset=utf-8"
+		res.FileName += ".txt"
+	default:
+		return nil, bizerr.ErrBadRequest.Wrap(fmt.Errorf("unknown export format %q", req.Format))
+	}
+	return res, nil
+}
+
+// ImportConversation restores a JSON export into a new conversation of the
+// account. The messages are saved as a single branch in the exported order,
+// keeping their times, and together with the conversation so that a failed
+// import leaves nothing behind.
+func (s *CharacterService) ImportConversation(ctx context.Context, req *ImportConversationRequest) (*ConversationResponse, error) {
+	export := req.Export
+	if export == nil || export.Version != ExportVersion {
+		return nil, bizerr.ErrBadRequest.Wrap(fmt.Errorf("unsupported export version"))
+	}
+	if len(export.Messages) > importMessageLimit {
+		return nil, bizerr.ErrBadRequest.Wrap(fmt.Errorf("an import holds at most %d messages", importMessageLimit))
+	}
+	for i := range export.Messages {
+		if r := export.Messages[i].Role; r != RoleUser && r != RoleAssistant {
+			return nil, bizerr.ErrBadRequest.Wrap(fmt.Errorf("unknown message role %q", r))
+		}
+	}
+	if _, err := s.queryVisibleCharacter(ctx, req.AccountID, export.CharacterID); err != nil {
+		return nil, fmt.Errorf("ImportConversation: [CharacterId: %s] query character err: %w", export.CharacterID, err)
+	}
+
+	messages := make([]*biz.MessageRequest, len(export.Messages))
+	for i, m := range export.Messages {
+		messages[i] = &biz.MessageRequest{
+			AccountID:   req.AccountID,
+			CharacterID: export.CharacterID,
+			Role:        m.Role,
+			Content:     m.Content,
+			VoiceURL:    m.Voice,
+			TokenCount:  util.CountTokens(m.Content),
+			Truncated:   m.Truncated,
+			CreateTime:  m.CreateTime,
+		}
+	}
+	version, err := s.revision.QueryLatestVersion(ctx, export.CharacterID)
+	if err != nil {
+		zap.S().Errorf("ImportConversation: [CharacterId: %s] query revision err: %v", export.CharacterID, err)
+	}
+	id, err := s.conversation.ImportConversation(ctx, req.AccountID, export.CharacterID, export.Title, version, messages)
+	if err != nil {
+		return nil, fmt.Errorf("ImportConversation: %w", err)
+	}
+	s.refreshChatCount(ctx, req.AccountID, export.CharacterID)
+
+	cr, err := s.conversation.QueryConversationByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("ImportConversation: query conversation err: %w", err)
+	}
+	return makeConversationResponse(cr), nil
+}
+
+func renderMarkdownExport(export *ConversationExport) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "# %s\n\n", exportTitle(export))
+	fmt.Fprintf(&b, "- Character: %s\n", export.CharacterName)
+	fmt.Fprintf(&b, "- Started: %s\n", export.CreateTime.Format(exportTimeLayout))
+	fmt.Fprintf(&b, "- Exported: %s\n", export.ExportTime.Format(exportTimeLayout))
+	for _, m := range export.Messages {
+		fmt.Fprintf(&b, "\n### %s · %s\n\n%s\n", exportSpeaker(export, m), m.CreateTime.Format(exportTimeLayout), m.Content)
+		if m.Truncated {
+			b.WriteString("\n_(reply interrupted)_\n")
+		}
+		if m.Voice != "" {
+			fmt.Fprintf(&b, "\n[Voice](%s)\n", m.Voice)
+		}
+	}
+	return b.Bytes()
+}
+
+func renderTxtExport(export *ConversationExport) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s\n", exportTitle(export))
+	fmt.Fprintf(&b, "Character: %s\n", export.CharacterName)
+	fmt.Fprintf(&b, "Started: %s\n", export.CreateTime.Format(exportTimeLayout))
+	fmt.Fprintf(&b, "Exported: %s\n", export.ExportTime.Format(exportTimeLayout))
+	for _, m := range export.Messages {
+		fmt.Fprintf(&b, "\n[%s] %s:\n%s\n", m.CreateTime.Format(exportTimeLayout), exportSpeaker(export, m), m.Content)
+		if m.Truncated {
+			b.WriteString("(reply interrupted)\n")
+		}
+		if m.Voice != "" {
+			fmt.Fprintf(&b, "Voice: %s\n", m.Voice)
+		}
+	}
+	return b.Bytes()
+}
+
+func exportTitle(export *ConversationExport) string {
+	if export.Title != "" {
+		return export.Title
+	}
+	return fmt.Sprintf("Conversation with %s", export.CharacterName)
+}
+
+func exportSpeaker(export *ConversationExport, m *ExportMessage) string {
+	if m.Role == RoleAssistant {
+		return export.CharacterName
+	}
+	return "You"
+}
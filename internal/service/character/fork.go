@@ -0,0 +1,164 @@
+package character
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"starland-backend/internal/biz"
+	"starland-backend/internal/pkg/bizerr"
+	"starland-backend/internal/pkg/util"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// ForkCharacter copies a public character into a new draft of the account.
+// The draft resumes at the image pick, the images of the source copied as
+// its candidates so that dropping them never touches the source.
+func (s *CharacterService) ForkCharacter(ctx context.Context, req *ForkCharacterRequest) (*CreationSessionResponse, error) {
+	err := s.ativity.QueryActivityLimit(ctx, req.AccountID, biz.CreateCharacter)
+	if err != nil {
+		return nil, err
+	}
+	source, err := s.queryVisibleCharacter(ctx, req.AccountID, req.CharacterID)
+	if err != nil {
+		return nil, fmt.Errorf("ForkCharacter: [CharacterId: %s] query character err: %w", req.CharacterID, err)
+	}
+	if source.State == biz.StateUnconfirmed {
+		return nil, bizerr.ErrCharacterNotExist
+	}
+	accountInfo, err := s.ativity.QueryAccount(ctx, req.AccountID)
+	if err != nil {
+		return nil, fmt.Errorf("ForkCharacter: query account err: %w", err)
+	}
+
+	id := uuid.NewString()
+	images := source.ImageURLs
+	if len(images) == 0 && source.ImageURL != "" {
+		images = []string{source.ImageURL}
+	}
+	candidates := make([]string, 0, len(images))
+	for i := range images {
+		image, err := s.copyImage(images[i], req.AccountID+"/"+id, strconv.Itoa(i+1))
+		if err != nil {
+			s.removeSessionImages(&biz.CreationSession{SessionID: id, Images: candidates}, "")
+			return nil, fmt.Errorf("ForkCharacter: [CharacterId: %s] copy image err: %w", source.ID, err)
+		}
+		candidates = append(candidates, image)
+	}
+
+	tags := make(map[string]string, len(source.Tag))
+	for i := range source.Tag {
+		tags[source.Tag[i].Key] = source.Tag[i].Value
+	}
+	_, err = s.character.SaveMyCharacter(ctx, &biz.CharacterRequest{
+		ID:               id,
+		AccountID:        req.AccountID,
+		AccountName:      accountInfo.Name,
+		AvatarURL:        accountInfo.AvatarURL,
+		Name:             source.Name,
+		Gender:           source.Gender,
+		Prompt:           source.Prompt,
+		Introduction:     source.Introduction,
+		Tags:             tags,
+		Voice:            source.Voice,
+		Is3D:             source.Is3D,
+		State:            biz.StateUnconfirmed,
+		Greeting:         source.Greeting,
+		ExampleDialogues: source.ExampleDialogues,
+		ForkedFrom:       source.ID,
+	})
+	if err != nil {
+		s.removeSessionImages(&biz.CreationSession{SessionID: id, Images: candidates}, "")
+		return nil, fmt.Errorf("ForkCharacter: save draft err: %w", err)
+	}
+
+	sess := biz.NewCreationSession(id, req.AccountID)
+	sess.Voice = source.Voice
+	sess.Is3D = source.Is3D
+	sess.Images = candidates
+	sess.Stage = Stage3
+	if len(candidates) > 0 {
+		sess.Stage = Stage4
+	}
+	if err = s.session.CreateSession(ctx, sess); err != nil {
+		s.removeSessionImages(&biz.CreationSession{SessionID: id, Images: candidates}, "")
+		if derr := s.character.DeleteCharacter(ctx, id); derr != nil {
+			zap.S().Errorf("ForkCharacter: [CharacterId: %s] delete draft err: %v", id, derr)
+		}
+		return nil, fmt.Errorf("ForkCharacter: [CharacterId: %s] create session err: %w", id, err)
+	}
+
+	if err = s.character.IncreaseForkCount(ctx, source.ID); err != nil {
+		zap.S().Errorf("ForkCharacter: %v", err)
+	}
+
+	res, err := s.QueryCreationSession(ctx, &QueryCreationSessionRequest{
+		AccountID: req.AccountID,
+		SessionID: id,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ForkCharacter: %w", err)
+	}
+	return res, nil
+}
+
+// queryForkAttribution names the character a fork was copied from. A source
+// deleted since is still reported by its id.
+func (s *CharacterService) queryForkAttribution(ctx context.Context, id string) *ForkAttribution {
+	res := &ForkAttribution{ID: id}
+	source, err := s.character.QueryCharacterByID(ctx, id)
+	if err != nil {
+		if !errors.Is(err, bizerr.ErrCharacterNotExist) {
+			zap.S().Errorf("queryForkAttribution: [CharacterId: %s] err: %v", id, err)
+		}
+		return res
+	}
+	res.Name = source.Name
+	res.AccountID = source.AccountID
+	res.AccountName = source.AccountName
+	return res
+}
+
+// copyImage copies a stored image into dir of the image path, named after key,
+// and returns the url of the copy. Images stored elsewhere are shared as they are.
+func (s *CharacterService) copyImage(url, dir, key string) (string, error) {
+	src, ok := s.imageFilePath(url)
+	if !ok {
+		return url, nil
+	}
+	if err := util.Mkdir(filepath.Join(s.cfg.File.ImagePath, dir)); err != nil {
+		return "", err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+
+	name := dir + "/" + key + filepath.Ext(src)
+	out, err := os.Create(filepath.Join(s.cfg.File.ImagePath, name))
+	if err != nil {
+		return "", err
+	}
+	defer out.Close()
+	if _, err = io.Copy(out, in); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s?t=%d", s.cfg.File.ImagesEndpoint+name, time.Now().Nanosecond()), nil
+}
+
+// imageFilePath returns the file behind an image url of the image endpoint.
+func (s *CharacterService) imageFilePath(url string) (string, bool) {
+	if !strings.HasPrefix(url, s.cfg.File.ImagesEndpoint) {
+		return "", false
+	}
+	name, _, _ := strings.Cut(strings.TrimPrefix(url, s.cfg.File.ImagesEndpoint), "?")
+	return filepath.Join(s.cfg.File.ImagePath, name), true
+}
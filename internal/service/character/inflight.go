@@ -0,0 +1,98 @@
+package character
+
+import (
+	"context"
+	"fmt"
+	"starland-backend/internal/biz"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// inflight tracks the agent streams running on this instance. Cancels and
+// reader heartbeats go through redis since the requests of the owner may be
+// served by any instance, each stream polls them until it is removed.
+type inflight struct {
+	reply   *biz.ReplyUsecase
+	mu      sync.Mutex
+	entries map[string]*inflightEntry
+}
+
+type inflightEntry struct {
+	cancel context.CancelFunc
+	stop   chan struct{}
+}
+
+func newInflight(reply *biz.ReplyUsecase) *inflight {
+	return &inflight{reply: reply, entries: make(map[string]*inflightEntry)}
+}
+
+func replyInflightKey(conversationID, replyID string) string {
+	return fmt.Sprintf("reply:%s:%s", conversationID, replyID)
+}
+
+func sessionInflightKey(sessionID string) string {
+	return fmt.Sprintf("session:%s", sessionID)
+}
+
+// add registers a stream of the account. With a positive readerTimeout the
+// stream is also cancelled once nobody has read it for that long.
+func (f *inflight) add(key, accountID string, cancel context.CancelFunc, readerTimeout time.Duration) {
+	if err := f.reply.StartInflight(context.Background(), key, accountID, readerTimeout); err != nil {
+		zap.S().Errorf("inflight: [Key: %s] err: %v", key, err)
+	}
+	e := &inflightEntry{cancel: cancel, stop: make(chan struct{})}
+	f.mu.Lock()
+	f.entries[key] = e
+	f.mu.Unlock()
+	go f.watch(key, e, readerTimeout > 0)
+}
+
+func (f *inflight) watch(key string, e *inflightEntry, readers bool) {
+	t := time.NewTicker(biz.InflightCheckInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-e.stop:
+			return
+		case <-t.C:
+		}
+		cancelled, read, err := f.reply.CheckInflight(context.Background(), key)
+		if err != nil {
+			zap.S().Errorf("inflight: [Key: %s] err: %v", key, err)
+			continue
+		}
+		if cancelled || (readers && !read) {
+			e.cancel()
+			return
+		}
+	}
+}
+
+func (f *inflight) remove(key string) {
+	f.mu.Lock()
+	e, ok := f.entries[key]
+	delete(f.entries, key)
+	f.mu.Unlock()
+	if !ok {
+		return
+	}
+	close(e.stop)
+	e.cancel()
+	if err := f.reply.StopInflight(context.Background(), key); err != nil {
+		zap.S().Errorf("inflight: [Key: %s] err: %v", key, err)
+	}
+}
+
+// cancel stops the stream, whichever instance produces it.
+func (f *inflight) cancel(ctx context.Context, key, accountID string) error {
+	return f.reply.CancelInflight(ctx, key, accountID)
+}
+
+// heartbeat keeps the stream going for timeout more, on behalf of a reader.
+func (f *inflight) heartbeat(key string, timeout time.Duration) {
+	if err := f.reply.TouchInflightReader(context.Background(), key, timeout); err != nil {
+		zap.S().Errorf("inflight: [Key: %s] err: %v", key, err)
+	}
+}
@@ -0,0 +1,148 @@
+package character
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"starland-backend/internal/biz"
+	"starland-backend/internal/pkg/bizerr"
+	"strings"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+)
+
+const (
+	maxNameLength         = 50
+	maxDescriptionLength  = 8000
+	maxIntroductionLength = 1000
+	maxTags               = 10
+	maxTagLength          = 30
+
+	maxGreetingLength        = 2000
+	maxExampleDialogues      = 10
+	maxExampleDialogueLength = 2000
+)
+
+// CreateManualCharacter creates a confirmed character from a filled in form,
+// counting as a creation the same way the wizard does.
+func (s *CharacterService) CreateManualCharacter(ctx context.Context, req *CreateManualCharacterRequest) (*CharacterResponse, error) {
+	if req.Image == "" {
+		return nil, bizerr.ErrBadRequest.Wrap(errors.New("a portrait is required"))
+	}
+	res, err := s.createCharacter(ctx, req, false)
+	if err != nil {
+		return nil, fmt.Errorf("CreateManualCharacter: %w", err)
+	}
+	return res, nil
+}
+
+// createCharacter saves a confirmed character made outside of the wizard.
+// Imports may leave the gender unknown, which the form has to set.
+func (s *CharacterService) createCharacter(ctx context.Context, req *CreateManualCharacterRequest,
+	imported bool) (*CharacterResponse, error) {
+	err := s.ativity.QueryActivityLimit(ctx, req.AccountID, biz.CreateCharacter)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkManualCharacter(req, imported); err != nil {
+		return nil, err
+	}
+	if req.Voice != "" {
+		if _, err = s.voice.QueryCharacterVoice(ctx, req.Voice); err != nil {
+			return nil, fmt.Errorf("check voice err: %w", err)
+		}
+	}
+	accountInfo, err := s.ativity.QueryAccount(ctx, req.AccountID)
+	if err != nil {
+		return nil, fmt.Errorf("query account err: %w", err)
+	}
+
+	_, err = s.character.SaveMyCharacter(ctx, &biz.CharacterRequest{
+		ID:               req.ID,
+		AccountID:        req.AccountID,
+		AccountName:      accountInfo.Name,
+		AvatarURL:        accountInfo.AvatarURL,
+		Name:             strings.TrimSpace(req.Name),
+		Gender:           req.Gender,
+		Prompt:           req.Description,
+		Introduction:     req.Introduction,
+		Tags:             s.normalizeTags(ctx, req.Tags),
+		Voice:            req.Voice,
+		ImageURL:         req.Image,
+		ImageURLs:        req.Images,
+		Is3D:             req.Is3D,
+		State:            0,
+		Visibility:       req.Visibility,
+		Greeting:         req.Greeting,
+		ExampleDialogues: req.ExampleDialogues,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("[CharacterId: %s] save character err: %w", req.ID, err)
+	}
+
+	if err = s.ativity.PostActivity(ctx, req.AccountID, biz.CreateCharacter); err != nil {
+		zap.S().Errorf("createCharacter: [Account: %s] add points err: %v ", req.AccountID, err)
+	}
+	if _, err = s.recordRevision(ctx, req.ID, biz.RevisionCreate, 0); err != nil {
+		zap.S().Errorf("createCharacter: %v", err)
+	}
+	s.indexCharacter(ctx, req.ID)
+
+	ch, err := s.character.QueryCharacterByID(ctx, req.ID)
+	if err != nil {
+		return nil, fmt.Errorf("[CharacterId: %s] query character err: %w", req.ID, err)
+	}
+	return makeCharacterResponse(ch), nil
+}
+
+func checkManualCharacter(req *CreateManualCharacterRequest, imported bool) error {
+	name := strings.TrimSpace(req.Name)
+	if name == "" || utf8.RuneCountInString(name) > maxNameLength {
+		return bizerr.ErrBadRequest.Wrap(fmt.Errorf("name must be between 1 and %d characters", maxNameLength))
+	}
+	if strings.TrimSpace(req.Description) == "" || utf8.RuneCountInString(req.Description) > maxDescriptionLength {
+		return bizerr.ErrBadRequest.Wrap(fmt.Errorf("description must be between 1 and %d characters", maxDescriptionLength))
+	}
+	if utf8.RuneCountInString(req.Introduction) > maxIntroductionLength {
+		return bizerr.ErrBadRequest.Wrap(fmt.Errorf("introduction must be at most %d characters", maxIntroductionLength))
+	}
+	if len(req.Tags) > maxTags {
+		return bizerr.ErrBadRequest.Wrap(fmt.Errorf("at most %d tags are allowed", maxTags))
+	}
+	if err := checkVisibility(req.Visibility); err != nil {
+		return err
+	}
+	if imported {
+		if req.Gender < 0 || req.Gender > 2 {
+			return bizerr.ErrBadRequest.Wrap(errors.New("gender must be 0, 1 or 2"))
+		}
+	} else if req.Gender != 1 && req.Gender != 2 {
+		return bizerr.ErrBadRequest.Wrap(errors.New("gender must be 1 or 2"))
+	}
+	if err := checkDialogues(req.Greeting, req.ExampleDialogues); err != nil {
+		return err
+	}
+	for k, v := range req.Tags {
+		if k == "" || v == "" || utf8.RuneCountInString(k) > maxTagLength || utf8.RuneCountInString(v) > maxTagLength {
+			return bizerr.ErrBadRequest.Wrap(fmt.Errorf("tags must be between 1 and %d characters", maxTagLength))
+		}
+	}
+	return nil
+}
+
+// checkDialogues bounds the greeting and the example dialogues of a character.
+func checkDialogues(greeting string, examples []string) error {
+	if utf8.RuneCountInString(greeting) > maxGreetingLength {
+		return bizerr.ErrBadRequest.Wrap(fmt.Errorf("greeting must be at most %d characters", maxGreetingLength))
+	}
+	if len(examples) > maxExampleDialogues {
+		return bizerr.ErrBadRequest.Wrap(fmt.Errorf("at most %d example dialogues are allowed", maxExampleDialogues))
+	}
+	for i := range examples {
+		if utf8.RuneCountInString(examples[i]) > maxExampleDialogueLength {
+			return bizerr.ErrBadRequest.Wrap(fmt.Errorf("example dialogues must be at most %d characters", maxExampleDialogueLength))
+		}
+	}
+	return nil
+}
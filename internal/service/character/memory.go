@@ -0,0 +1,206 @@
+package character
+
+import (
+	"context"
+	"fmt"
+	"starland-backend/internal/biz"
+	"starland-backend/internal/pkg/bizerr"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultMemoryInterval = 10 * time.Minute
+	defaultMemoryBatch    = 10
+	defaultMaxMemories    = 20
+	// memoryLookback bounds how far back the conversations to summarize are
+	// looked for, the ones left with too few pending messages are given up.
+	memoryLookback = 24 * time.Hour
+)
+
+func (s *CharacterService) QueryMemories(ctx context.Context, req *QueryMemoriesRequest) ([]*MemoryResponse, error) {
+	ms, err := s.memory.QueryMemories(ctx, req.AccountID, req.CharacterID, 0)
+	if err != nil {
+		return nil, fmt.Errorf("QueryMemories: [CharacterId: %s] query memories err: %w", req.CharacterID, err)
+	}
+
+	res := make([]*MemoryResponse, len(ms))
+	for i := range ms {
+		res[i] = makeMemoryResponse(ms[i])
+	}
+	return res, nil
+}
+
+func (s *CharacterService) DeleteMemory(ctx context.Context, req *DeleteMemoryRequest) error {
+	m, err := s.memory.QueryMemory(ctx, req.MemoryID)
+	if err != nil {
+		return fmt.Errorf("DeleteMemory: [MemoryId: %s] query memory err: %w", req.MemoryID, err)
+	}
+	if m.AccountID != req.AccountID || m.CharacterID != req.CharacterID {
+		return bizerr.ErrMemoryNotExist
+	}
+
+	if err = s.memory.DeleteMemory(ctx, req.MemoryID); err != nil {
+		return fmt.Errorf("DeleteMemory: [MemoryId: %s] delete memory err: %w", req.MemoryID, err)
+	}
+	return nil
+}
+
+func (s *CharacterService) DeleteMemories(ctx context.Context, req *DeleteMemoriesRequest) error {
+	if err := s.memory.DeleteMemories(ctx, req.AccountID, req.CharacterID); err != nil {
+		return fmt.Errorf("DeleteMemories: [CharacterId: %s] delete memories err: %w", req.CharacterID, err)
+	}
+	return nil
+}
+
+// chatMemories returns what the character remembers about the account. A
+// failure only costs the reply its memories, so it is logged and ignored.
+func (s *CharacterService) chatMemories(ctx context.Context, accountID, characterID string) []string {
+	ms, err := s.memory.QueryMemories(ctx, accountID, characterID, s.maxMemories())
+	if err != nil {
+		zap.S().Errorf("chatMemories: [Account: %s CharacterId: %s] err: %v", accountID, characterID, err)
+		return nil
+	}
+	return memoryContents(ms)
+}
+
+// memoryTask summarizes the conversations that changed after they were last
+// summarized. Every instance runs it, each conversation is claimed by the one
+// that moves its memorized_at first.
+func (s *CharacterService) memoryTask() {
+	defer func() {
+		if p := recover(); p != nil {
+			zap.S().Errorf("memoryTask: recover err: %v", p)
+		}
+		s.memoryTask()
+	}()
+
+	interval := defaultMemoryInterval
+	if s.cfg.Agent != nil && s.cfg.Agent.MemoryInterval > 0 {
+		interval = s.cfg.Agent.MemoryInterval
+	}
+	t := time.NewTicker(interval)
+	for range t.C {
+		ctx := context.Background()
+		crs, err := s.conversation.QueryConversationsToMemorize(ctx, time.Now().Add(-memoryLookback))
+		if err != nil {
+			zap.S().Errorf("memoryTask: query conversations err: %v", err)
+			continue
+		}
+		for i := range crs {
+			if err = s.summarizeConversation(ctx, crs[i]); err != nil {
+				zap.S().Errorf("memoryTask: [ConversationId: %s] err: %v", crs[i].ConversationID, err)
+			}
+		}
+	}
+}
+
+// summarizeConversation turns the messages of the active branch that have
+// left the history window of the agent into memories. Nothing is done until
+// enough of them are pending, so every summary has some context to work on.
+func (s *CharacterService) summarizeConversation(ctx context.Context, cr *biz.ConversationResponse) error {
+	tree, err := s.message.QueryMessageTree(ctx, cr.ConversationID)
+	if err != nil {
+		return fmt.Errorf("summarizeConversation: query messages err: %w", err)
+	}
+	activeID := cr.ActiveMessageID
+	if _, ok := tree.Message(activeID); !ok {
+		activeID = ""
+	}
+	branch := tree.Branch(tree.Leaf(activeID))
+
+	window := 0
+	if s.cfg.Agent != nil {
+		window = int(s.cfg.Agent.MaxChatHistoryContextLength)
+	}
+	if len(branch) <= window {
+		return nil
+	}
+	pending := make([]*biz.ChatMessage, 0)
+	var last time.Time
+	for _, m := range branch[:len(branch)-window] {
+		if cr.MemorizedAt != nil && !m.CreateTime.After(*cr.MemorizedAt) {
+			continue
+		}
+		pending = append(pending, &biz.ChatMessage{Role: m.Role, Content: m.Content})
+		last = m.CreateTime
+	}
+	batch := defaultMemoryBatch
+	if s.cfg.Agent != nil && s.cfg.Agent.MemoryBatch > 0 {
+		batch = s.cfg.Agent.MemoryBatch
+	}
+	if len(pending) < batch {
+		return nil
+	}
+
+	ok, err := s.conversation.SetMemorizedAt(ctx, cr.ConversationID, cr.MemorizedAt, &last)
+	if err != nil {
+		return fmt.Errorf("summarizeConversation: claim err: %w", err)
+	}
+	if !ok {
+		return nil
+	}
+	if err = s.memorize(ctx, cr, pending, last); err != nil {
+		// hand the messages back to the next run.
+		if _, rerr := s.conversation.SetMemorizedAt(ctx, cr.ConversationID, &last, cr.MemorizedAt); rerr != nil {
+			zap.S().Errorf("summarizeConversation: [ConversationId: %s] release err: %v", cr.ConversationID, rerr)
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *CharacterService) memorize(ctx context.Context, cr *biz.ConversationResponse, pending []*biz.ChatMessage,
+	last time.Time) error {
+	ms, err := s.memory.QueryMemories(ctx, cr.AccountID, cr.CharacterID, s.maxMemories())
+	if err != nil {
+		return fmt.Errorf("memorize: query memories err: %w", err)
+	}
+	facts, err := s.character.Summarize(ctx, cr.CharacterID, pending, memoryContents(ms))
+	if err != nil {
+		return fmt.Errorf("memorize: summarize err: %w", err)
+	}
+
+	req := make([]*biz.MemoryRequest, 0, len(facts))
+	for i := range facts {
+		if facts[i] == "" {
+			continue
+		}
+		req = append(req, &biz.MemoryRequest{
+			AccountID:      cr.AccountID,
+			CharacterID:    cr.CharacterID,
+			ConversationID: cr.ConversationID,
+			Content:        facts[i],
+			SourceTime:     last,
+		})
+	}
+	if err = s.memory.SaveMemories(ctx, req); err != nil {
+		return fmt.Errorf("memorize: save memories err: %w", err)
+	}
+	return nil
+}
+
+func (s *CharacterService) maxMemories() int {
+	if s.cfg.Agent != nil && s.cfg.Agent.MaxMemories > 0 {
+		return s.cfg.Agent.MaxMemories
+	}
+	return defaultMaxMemories
+}
+
+func memoryContents(ms []*biz.MemoryResponse) []string {
+	res := make([]string, len(ms))
+	for i := range ms {
+		res[i] = ms[i].Content
+	}
+	return res
+}
+
+func makeMemoryResponse(req *biz.MemoryResponse) *MemoryResponse {
+	return &MemoryResponse{
+		MemoryID:       req.MemoryID,
+		ConversationID: req.ConversationID,
+		Content:        req.Content,
+		CreateTime:     req.CreateTime,
+	}
+}
@@ -0,0 +1,179 @@
+package character
+
+import (
+	"context"
+	"fmt"
+	"starland-backend/internal/biz"
+	"starland-backend/internal/pkg/bizerr"
+	"starland-backend/internal/pkg/util"
+)
+
+func (s *CharacterService) SaveChatMessage(ctx context.Context, req *SaveChatMessageRequest) error {
+	id, err := s.message.SaveMessage(ctx, &biz.MessageRequest{
+		ConversationID: req.ConversationID,
+		ParentID:       req.ParentID,
+		AccountID:      req.AccountID,
+		CharacterID:    req.CharacterID,
+		Role:           req.Role,
+		Content:        req.Content,
+		VoiceURL:       req.Voice,
+		TokenCount:     req.TokenCount,
+		Truncated:      req.Truncated,
+	})
+	if err != nil {
+		return fmt.Errorf("SaveChatMessage: save message err: %w ", err)
+	}
+	if err = s.conversation.SetActiveMessage(ctx, req.ConversationID, id); err != nil {
+		return fmt.Errorf("SaveChatMessage: set active message err: %w ", err)
+	}
+	return nil
+}
+
+func (s *CharacterService) QueryChatMessages(ctx context.Context, req *QueryChatMessagesRequest) ([]*ChatMessageResponse, int64, error) {
+	var (
+		cr  *biz.ConversationResponse
+		err error
+	)
+	if req.ConversationID != "" {
+		cr, err = s.queryOwnConversation(ctx, req.AccountID, req.ConversationID)
+	} else {
+		cr, err = s.conversation.QueryConversation(ctx, req.AccountID, req.CharacterID)
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("QueryChatMessages: query conversation err: %w ", err)
+	}
+	if cr == nil {
+		return []*ChatMessageResponse{}, 0, nil
+	}
+
+	branch, count, err := s.message.QueryBranch(ctx, cr.ConversationID, cr.ActiveMessageID, req.Page, req.Limit)
+	if err != nil {
+		return nil, 0, fmt.Errorf("QueryChatMessages: query messages err: %w ", err)
+	}
+	return makeChatMessageResponse(branch), count, nil
+}
+
+// SwitchBranch makes the branch going through the message the active one of
+// the conversation.
+func (s *CharacterService) SwitchBranch(ctx context.Context, req *SwitchBranchRequest) error {
+	if _, err := s.queryOwnConversation(ctx, req.AccountID, req.ConversationID); err != nil {
+		return fmt.Errorf("SwitchBranch: %w", err)
+	}
+
+	tree, err := s.message.QueryMessageTree(ctx, req.ConversationID)
+	if err != nil {
+		return fmt.Errorf("SwitchBranch: query messages err: %w ", err)
+	}
+	if _, ok := tree.Message(req.MessageID); !ok {
+		return bizerr.ErrMessageNotExist
+	}
+
+	if err = s.conversation.SetActiveMessage(ctx, req.ConversationID, tree.Leaf(req.MessageID)); err != nil {
+		return fmt.Errorf("SwitchBranch: set active message err: %w ", err)
+	}
+	return nil
+}
+
+// prepareChatTurn resolves the user turn the agent has to answer and the
+// branch history leading to it. A new message or an edited one is saved as a
+// child of the active message or as a sibling of the edited one, while a
+// regeneration answers an existing user turn again.
+func (s *CharacterService) prepareChatTurn(ctx context.Context, conversationID, activeID string,
+	req *ChatRequestV2) (*biz.MessageResponse, []*biz.ChatMessage, error) {
+	tree, err := s.message.QueryMessageTree(ctx, conversationID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("query messages err: %w", err)
+	}
+	if _, ok := tree.Message(activeID); !ok {
+		activeID = tree.Leaf("")
+	}
+
+	var turn *biz.MessageResponse
+	switch req.Action {
+	case ChatActionRegenerate:
+		id := req.MessageID
+		if id == "" {
+			id = activeID
+		}
+		m, ok := tree.Message(id)
+		if ok && m.Role == biz.MessageRoleAssistant {
+			m, ok = tree.Message(m.ParentID)
+		}
+		if !ok {
+			return nil, nil, bizerr.ErrMessageNotExist
+		}
+		turn = m
+	case ChatActionEdit:
+		m, ok := tree.Message(req.MessageID)
+		if !ok {
+			return nil, nil, bizerr.ErrMessageNotExist
+		}
+		if m.Role != biz.MessageRoleUser {
+			return nil, nil, bizerr.ErrBadRequest.Wrap(fmt.Errorf("only user messages can be edited"))
+		}
+		turn, err = s.saveUserMessage(ctx, m.ParentID, req)
+	case "":
+		turn, err = s.saveUserMessage(ctx, activeID, req)
+	default:
+		return nil, nil, bizerr.ErrBadRequest.Wrap(fmt.Errorf("unknown chat action %q", req.Action))
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err = s.conversation.SetActiveMessage(ctx, conversationID, turn.MessageID); err != nil {
+		return nil, nil, fmt.Errorf("set active message err: %w", err)
+	}
+
+	branch := tree.Branch(turn.ParentID)
+	history := make([]*biz.ChatMessage, len(branch))
+	for i := range branch {
+		history[i] = &biz.ChatMessage{
+			Role:    branch[i].Role,
+			Content: branch[i].Content,
+		}
+	}
+	return turn, history, nil
+}
+
+func (s *CharacterService) saveUserMessage(ctx context.Context, parentID string, req *ChatRequestV2) (*biz.MessageResponse, error) {
+	m := &biz.MessageRequest{
+		ConversationID: req.ConversationID,
+		ParentID:       parentID,
+		AccountID:      req.AccountID,
+		CharacterID:    req.CharacterID,
+		Role:           biz.MessageRoleUser,
+		Content:        req.Message,
+		TokenCount:     util.CountTokens(req.Message),
+	}
+	id, err := s.message.SaveMessage(ctx, m)
+	if err != nil {
+		return nil, fmt.Errorf("save message err: %w", err)
+	}
+	return &biz.MessageResponse{
+		MessageID:      id,
+		ConversationID: m.ConversationID,
+		ParentID:       m.ParentID,
+		Role:           m.Role,
+		Content:        m.Content,
+	}, nil
+}
+
+func makeChatMessageResponse(req []*biz.MessageResponse) []*ChatMessageResponse {
+	res := make([]*ChatMessageResponse, len(req))
+	for i := range req {
+		res[i] = &ChatMessageResponse{
+			MessageID:      req[i].MessageID,
+			ConversationID: req[i].ConversationID,
+			ParentID:       req[i].ParentID,
+			SiblingIDs:     req[i].SiblingIDs,
+			Role:           req[i].Role,
+			Content:        req[i].Content,
+			Voice:          req[i].VoiceURL,
+			TokenCount:     req[i].TokenCount,
+			Truncated:      req[i].Truncated,
+			CreateTime:     req[i].CreateTime,
+		}
+	}
+	return res
+}
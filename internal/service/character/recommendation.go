@@ -0,0 +1,54 @@
+package character
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultRecommendationInterval = time.Hour
+	defaultRecommendationLimit    = 10
+	maxRecommendationLimit        = 50
+)
+
+// RecommendCharacters suggests characters the account has not talked to yet.
+func (s *CharacterService) RecommendCharacters(ctx context.Context, req *RecommendCharactersRequest) ([]*QueryCharacterResponse, error) {
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultRecommendationLimit
+	} else if limit > maxRecommendationLimit {
+		limit = maxRecommendationLimit
+	}
+	characters, err := s.recommend.RecommendCharacters(ctx, req.AccountID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("RecommendCharacters: [AccountId: %s] recommend err: %w", req.AccountID, err)
+	}
+	return s.makeQueryCharacterResponse(req.AccountID, characters), nil
+}
+
+// recommendationTask recomputes the similarities between the characters, on
+// start and then every configured interval, on the instance holding the lease
+// of the job.
+func (s *CharacterService) recommendationTask() {
+	defer func() {
+		if p := recover(); p != nil {
+			zap.S().Errorf("recommendationTask: recover err: %v", p)
+		}
+		s.recommendationTask()
+	}()
+
+	interval := defaultRecommendationInterval
+	if s.cfg.Recommendation != nil && s.cfg.Recommendation.Interval > 0 {
+		interval = s.cfg.Recommendation.Interval
+	}
+	t := time.NewTicker(interval)
+	for {
+		if err := s.recommend.ComputeSimilarities(context.Background(), 2*interval); err != nil {
+			zap.S().Errorf("recommendationTask: %v", err)
+		}
+		<-t.C
+	}
+}
@@ -0,0 +1,201 @@
+package character
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"starland-backend/internal/biz"
+	"starland-backend/internal/pkg/util"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// replyIdleReads is how many empty blocking reads a reader waits for
+	// before giving up on a reply whose producer went away.
+	replyIdleReads = int(biz.ReplyExpiration / biz.ReplyReadBlock)
+	// replyDetachTimeout is how long a reply keeps being generated without a
+	// reader heartbeat, leaving the client time to resume it.
+	replyDetachTimeout = 30 * time.Second
+)
+
+// produceReply runs the agent stream and buffers every event of the reply, so
+// the reply is persisted and can be replayed whether or not a client is still
+// reading it. A cancelled reply is persisted as truncated.
+func (s *CharacterService) produceReply(ctx context.Context, req *ChatRequestV2, chatReq *biz.ChatRequest) {
+	defer s.inflight.remove(replyInflightKey(req.ConversationID, req.ReplyID))
+
+	resCh := make(chan interface{})
+	chatReq.ResCh = resCh
+	go func() {
+		if err := s.character.ChatStream(ctx, chatReq); err != nil {
+			zap.S().Errorf("ChatV2: [ConversationId: %s Message: %s] err: %v ", req.ConversationID, req.Message, err)
+		}
+	}()
+
+	var (
+		content   string
+		streamErr error
+		// refreshed is when the buffer was last extended, which the tokens
+		// do only once in a while.
+		refreshed time.Time
+	)
+	for resMessage := range resCh {
+		switch m := resMessage.(type) {
+		case string:
+			content = fmt.Sprintf("%s%s", content, m)
+			refresh := time.Since(refreshed) > biz.ReplyExpiration/2
+			if refresh {
+				refreshed = time.Now()
+			}
+			s.appendReplyEvent(req, ReplyEventToken, &ReplyTokenData{Content: m}, refresh)
+		case error:
+			streamErr = m
+		}
+	}
+	truncated := streamErr != nil && ctx.Err() != nil
+
+	zap.S().Infof("chat res: %s", content)
+	var voice string
+	if streamErr == nil {
+		var err error
+		voice, err = s.MessageToVoice(context.Background(), req.CharacterID, content)
+		if err != nil {
+			zap.S().Errorf("MessageToVoice: err: %v", err)
+		}
+	}
+	err := s.SaveChatMessage(context.Background(), &SaveChatMessageRequest{
+		ConversationID: req.ConversationID,
+		ParentID:       req.ParentMessageID,
+		AccountID:      req.AccountID,
+		CharacterID:    req.CharacterID,
+		Role:           RoleAssistant,
+		Content:        content,
+		Voice:          voice,
+		TokenCount:     util.CountTokens(content),
+		Truncated:      truncated,
+	})
+	if err != nil {
+		zap.S().Errorf("SaveChatMessage: err: %v", err)
+	}
+
+	if streamErr != nil && !truncated {
+		s.appendReplyEvent(req, ReplyEventError, util.MakeErrResponse(streamErr), true)
+		return
+	}
+	if voice != "" {
+		s.appendReplyEvent(req, ReplyEventVoice, &ReplyVoiceData{Voice: voice}, false)
+	}
+	s.appendReplyEvent(req, ReplyEventDone, &ReplyDoneData{
+		ChatMessage:    content,
+		Voice:          voice,
+		ConversationID: req.ConversationID,
+		ParentID:       req.ParentMessageID,
+		Truncated:      truncated,
+	}, true)
+}
+
+func (s *CharacterService) appendReplyEvent(req *ChatRequestV2, event string, data interface{}, refresh bool) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		zap.S().Errorf("appendReplyEvent: marshal %s event err: %v", event, err)
+		return
+	}
+	_, err = s.reply.AppendReplyEvent(context.Background(), req.ConversationID, req.ReplyID, &biz.ReplyEvent{
+		Event: event,
+		Data:  string(b),
+	}, refresh)
+	if err != nil {
+		zap.S().Errorf("appendReplyEvent: [ConversationId: %s] err: %v", req.ConversationID, err)
+	}
+}
+
+// StreamReply replays the buffered events of a reply on req.ResCh and keeps
+// following it until it is done, failed or ctx is cancelled. Without a
+// ReplyID the reply is resolved from LastEventID, or else it is the latest
+// reply of the conversation.
+func (s *CharacterService) StreamReply(ctx context.Context, req *StreamReplyRequest) error {
+	if _, err := s.queryOwnConversation(ctx, req.AccountID, req.ConversationID); err != nil {
+		return fmt.Errorf("StreamReply: %w", err)
+	}
+
+	var (
+		replyID = req.ReplyID
+		afterID string
+		err     error
+	)
+	switch {
+	case req.LastEventID != "":
+		replyID, afterID, err = biz.ParseReplyEventID(req.LastEventID)
+	case replyID == "":
+		replyID, err = s.reply.QueryLatestReply(ctx, req.ConversationID)
+	}
+	if err != nil {
+		return fmt.Errorf("StreamReply: [ConversationId: %s] resolve reply err: %w", req.ConversationID, err)
+	}
+
+	key := replyInflightKey(req.ConversationID, replyID)
+	go func() {
+		defer close(req.ResCh)
+		for idle := 0; idle < replyIdleReads && ctx.Err() == nil; {
+			s.inflight.heartbeat(key, replyDetachTimeout)
+			events, err := s.reply.ReadReplyEvents(ctx, req.ConversationID, replyID, afterID)
+			if err != nil {
+				zap.S().Errorf("StreamReply: [ConversationId: %s] err: %v", req.ConversationID, err)
+				return
+			}
+			if len(events) == 0 {
+				idle++
+				continue
+			}
+			idle = 0
+			for i := range events {
+				afterID = events[i].ID
+				select {
+				case req.ResCh <- &ReplyEvent{
+					ID:    biz.MakeReplyEventID(replyID, events[i].ID),
+					Event: events[i].Event,
+					Data:  json.RawMessage(events[i].Data),
+				}:
+				case <-ctx.Done():
+					return
+				}
+				if events[i].Event == ReplyEventDone || events[i].Event == ReplyEventError {
+					return
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// CancelReply stops the generation of a reply, the latest one of the
+// conversation when no ReplyID is given. What was generated so far is kept
+// as a truncated message.
+func (s *CharacterService) CancelReply(ctx context.Context, req *CancelReplyRequest) error {
+	if _, err := s.queryOwnConversation(ctx, req.AccountID, req.ConversationID); err != nil {
+		return fmt.Errorf("CancelReply: %w", err)
+	}
+
+	replyID := req.ReplyID
+	if replyID == "" {
+		var err error
+		replyID, err = s.reply.QueryLatestReply(ctx, req.ConversationID)
+		if err != nil {
+			return fmt.Errorf("CancelReply: [ConversationId: %s] query latest reply err: %w", req.ConversationID, err)
+		}
+	}
+	if err := s.inflight.cancel(ctx, replyInflightKey(req.ConversationID, replyID), req.AccountID); err != nil {
+		return fmt.Errorf("CancelReply: [ConversationId: %s ReplyId: %s] err: %w", req.ConversationID, replyID, err)
+	}
+	return nil
+}
+
+// CancelSession stops the reply streamed by the creation session.
+func (s *CharacterService) CancelSession(ctx context.Context, req *CancelSessionRequest) error {
+	if err := s.inflight.cancel(ctx, sessionInflightKey(req.SessionID), req.AccountID); err != nil {
+		return fmt.Errorf("CancelSession: [SessionId: %s] err: %w", req.SessionID, err)
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+package character
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"starland-backend/internal/biz"
+	"starland-backend/internal/pkg/bizerr"
+)
+
+// revisionFields lists the fields compared by DiffRevisions, in the order
+// the changes are reported.
+var revisionFields = []struct {
+	name  string
+	value func(*RevisionResponse) interface{}
+}{
+	{"name", func(r *RevisionResponse) interface{} { return r.Name }},
+	{"gender", func(r *RevisionResponse) interface{} { return r.Gender }},
+	{"prompt", func(r *RevisionResponse) interface{} { return r.Prompt }},
+	{"introduction", func(r *RevisionResponse) interface{} { return r.Introduction }},
+	{"image_url", func(r *RevisionResponse) interface{} { return r.ImageURL }},
+	{"image_urls", func(r *RevisionResponse) interface{} { return r.ImageURLs }},
+	{"voice", func(r *RevisionResponse) interface{} { return r.Voice }},
+	{"tags", func(r *RevisionResponse) interface{} { return r.Tags }},
+	{"is_3d", func(r *RevisionResponse) interface{} { return r.Is3D }},
+	{"greeting", func(r *RevisionResponse) interface{} { return r.Greeting }},
+	{"example_dialogues", func(r *RevisionResponse) interface{} { return r.ExampleDialogues }},
+	{"settings", func(r *RevisionResponse) interface{} { return r.Settings }},
+}
+
+func (s *CharacterService) QueryRevisions(ctx context.Context, req *QueryRevisionsRequest) ([]*RevisionResponse, int64, error) {
+	if _, err := s.queryOwnCharacter(ctx, req.AccountID, req.CharacterID); err != nil {
+		return nil, 0, fmt.Errorf("QueryRevisions: %w", err)
+	}
+	revisions, count, err := s.revision.QueryRevisions(ctx, req.CharacterID, req.Page, req.Limit)
+	if err != nil {
+		return nil, count, fmt.Errorf("QueryRevisions: [CharacterId: %s] query revisions err: %w", req.CharacterID, err)
+	}
+
+	res := make([]*RevisionResponse, len(revisions))
+	for i := range revisions {
+		res[i] = makeRevisionResponse(revisions[i])
+	}
+	return res, count, nil
+}
+
+// DiffRevisions lists the fields changed from the compared revision to the
+// requested one. The first revision is compared with an empty character.
+func (s *CharacterService) DiffRevisions(ctx context.Context, req *DiffRevisionsRequest) (*RevisionDiffResponse, error) {
+	if _, err := s.queryOwnCharacter(ctx, req.AccountID, req.CharacterID); err != nil {
+		return nil, fmt.Errorf("DiffRevisions: %w", err)
+	}
+	against := req.Against
+	if against == 0 {
+		against = req.Version - 1
+	}
+	if against < 0 || against == req.Version {
+		return nil, bizerr.ErrBadRequest.Wrap(fmt.Errorf("cannot compare revision %d with revision %d", req.Version, against))
+	}
+
+	rev, err := s.revision.QueryRevision(ctx, req.CharacterID, req.Version)
+	if err != nil {
+		return nil, fmt.Errorf("DiffRevisions: [CharacterId: %s] query revision %d err: %w", req.CharacterID, req.Version, err)
+	}
+	from := makeRevisionResponse(&biz.CharacterRevision{Settings: &biz.GenerationSettings{}})
+	if against > 0 {
+		old, err := s.revision.QueryRevision(ctx, req.CharacterID, against)
+		if err != nil {
+			return nil, fmt.Errorf("DiffRevisions: [CharacterId: %s] query revision %d err: %w", req.CharacterID, against, err)
+		}
+		from = makeRevisionResponse(old)
+	}
+	to := makeRevisionResponse(rev)
+
+	res := &RevisionDiffResponse{
+		Version: req.Version,
+		Against: against,
+		Changes: make([]*RevisionChange, 0),
+	}
+	for _, f := range revisionFields {
+		a, b := f.value(from), f.value(to)
+		if !sameRevisionValue(a, b) {
+			res.Changes = append(res.Changes, &RevisionChange{Field: f.name, From: a, To: b})
+		}
+	}
+	return res, nil
+}
+
+// RollbackRevision restores the character to the revision. The rollback is
+// itself recorded as a new revision, so it can be undone the same way.
+func (s *CharacterService) RollbackRevision(ctx context.Context, req *RevisionRequest) (*RevisionResponse, error) {
+	if _, err := s.queryOwnCharacter(ctx, req.AccountID, req.CharacterID); err != nil {
+		return nil, fmt.Errorf("RollbackRevision: %w", err)
+	}
+	rev, err := s.revision.QueryRevision(ctx, req.CharacterID, req.Version)
+	if err != nil {
+		return nil, fmt.Errorf("RollbackRevision: [CharacterId: %s] query revision err: %w", req.CharacterID, err)
+	}
+	if err = s.character.RestoreCharacter(ctx, rev); err != nil {
+		return nil, fmt.Errorf("RollbackRevision: %w", err)
+	}
+
+	latest, err := s.recordRevision(ctx, req.CharacterID, biz.RevisionRollback, req.Version)
+	if err != nil {
+		return nil, fmt.Errorf("RollbackRevision: %w", err)
+	}
+	s.indexCharacter(ctx, req.CharacterID)
+	return makeRevisionResponse(latest), nil
+}
+
+// recordRevision appends the current state of the character to its history.
+func (s *CharacterService) recordRevision(ctx context.Context, characterID, reason string,
+	rollbackFrom int) (*biz.CharacterRevision, error) {
+	ch, err := s.character.QueryCharacterByID(ctx, characterID)
+	if err != nil {
+		return nil, fmt.Errorf("[CharacterId: %s] query character err: %w", characterID, err)
+	}
+	rev, err := s.revision.RecordRevision(ctx, ch, reason, rollbackFrom)
+	if err != nil {
+		return nil, fmt.Errorf("[CharacterId: %s] record revision err: %w", characterID, err)
+	}
+	return rev, nil
+}
+
+// recordBaseline records the character as it is when it has no revision yet,
+// so that the edit about to be made can be diffed and rolled back.
+func (s *CharacterService) recordBaseline(ctx context.Context, ch *biz.CharacterResponse) error {
+	latest, err := s.revision.QueryLatestVersion(ctx, ch.ID)
+	if err != nil {
+		return fmt.Errorf("[CharacterId: %s] query latest revision err: %w", ch.ID, err)
+	}
+	if latest > 0 {
+		return nil
+	}
+	if _, err = s.revision.RecordRevision(ctx, ch, biz.RevisionBaseline, 0); err != nil {
+		return fmt.Errorf("[CharacterId: %s] record baseline err: %w", ch.ID, err)
+	}
+	return nil
+}
+
+// queryOwnCharacter loads a character and makes sure it belongs to the account.
+func (s *CharacterService) queryOwnCharacter(ctx context.Context, accountID, id string) (*biz.CharacterResponse, error) {
+	ch, err := s.character.QueryCharacterByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if ch.AccountID != accountID {
+		return nil, bizerr.ErrNoPermissionToModify
+	}
+	return ch, nil
+}
+
+// sameRevisionValue compares two field values, empty lists being equal
+// whether they were stored as null or as an empty array.
+func sameRevisionValue(a, b interface{}) bool {
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	if va.Kind() == reflect.Slice && vb.Kind() == reflect.Slice && va.Len() == 0 && vb.Len() == 0 {
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func makeRevisionResponse(req *biz.CharacterRevision) *RevisionResponse {
+	return &RevisionResponse{
+		Version:          req.Version,
+		Reason:           req.Reason,
+		RollbackFrom:     req.RollbackFrom,
+		Name:             req.Name,
+		Gender:           req.Gender,
+		Prompt:           req.Prompt,
+		Introduction:     req.Introduction,
+		ImageURL:         req.ImageURL,
+		ImageURLs:        req.ImageURLs,
+		Voice:            req.Voice,
+		Tags:             makeTags(req.Tag),
+		Is3D:             req.Is3D,
+		Greeting:         req.Greeting,
+		ExampleDialogues: req.ExampleDialogues,
+		Settings:         makeGenerationSettings(req.Settings),
+		CreateTime:       req.CreateTime,
+	}
+}
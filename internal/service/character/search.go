@@ -0,0 +1,70 @@
+package character
+
+import (
+	"context"
+	"fmt"
+	"starland-backend/internal/biz"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const defaultSearchRebuildInterval = 10 * time.Minute
+
+// SearchCharacters ranks the public characters matching the query and the
+// filters of the request.
+func (s *CharacterService) SearchCharacters(ctx context.Context, req *SearchCharactersRequest) ([]*QueryCharacterResponse, int64, error) {
+	tag, err := s.resolveTag(ctx, req.Tag)
+	if err != nil {
+		return nil, 0, fmt.Errorf("SearchCharacters: [Tag: %s] resolve tag err: %w", req.Tag, err)
+	}
+	characters, count, err := s.search.SearchCharacters(ctx, &biz.CharacterSearchRequest{
+		Query:  req.Query,
+		Gender: req.Gender,
+		Is3D:   req.Is3D,
+		Tag:    tag,
+		Minted: req.Minted,
+		Sort:   req.Sort,
+		Page:   req.Page,
+		Limit:  req.Limit,
+	})
+	if err != nil {
+		return nil, count, fmt.Errorf("SearchCharacters: [Query: %s] search err: %w", req.Query, err)
+	}
+	return s.makeQueryCharacterResponse(req.AccountID, characters), count, nil
+}
+
+// indexCharacter refreshes the character in the search index after a
+// change. A failure only delays the change until the next rebuild.
+func (s *CharacterService) indexCharacter(ctx context.Context, id string) {
+	if err := s.search.IndexCharacter(ctx, id); err != nil {
+		zap.S().Errorf("indexCharacter: %v", err)
+	}
+}
+
+// searchIndexTask rebuilds the search index from the characters table, on
+// start and then every configured interval, when the search has an index
+// of its own.
+func (s *CharacterService) searchIndexTask() {
+	if !s.search.Indexed() {
+		return
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			zap.S().Errorf("searchIndexTask: recover err: %v", p)
+		}
+		s.searchIndexTask()
+	}()
+
+	interval := defaultSearchRebuildInterval
+	if s.cfg.Search.RebuildInterval > 0 {
+		interval = s.cfg.Search.RebuildInterval
+	}
+	t := time.NewTicker(interval)
+	for {
+		if err := s.search.RebuildIndex(context.Background()); err != nil {
+			zap.S().Errorf("searchIndexTask: %v", err)
+		}
+		<-t.C
+	}
+}
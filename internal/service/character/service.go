@@ -1,13 +1,14 @@
 package character
 
 import (
+	"context"
+	"encoding/json"
 	"starland-backend/configs"
 	"starland-backend/internal/biz"
 
 	"time"
 
 	"github.com/google/wire"
-	"github.com/patrickmn/go-cache"
 )
 
 var ProviderSet = wire.NewSet(NewCharacterService)
@@ -19,6 +20,28 @@ const (
 	ImageSetting     ConfirmType = "image_setting"
 )
 
+const (
+	RoleUser      = biz.MessageRoleUser
+	RoleAssistant = biz.MessageRoleAssistant
+
+	ChatActionRegenerate = "regenerate"
+	ChatActionEdit       = "edit"
+)
+
+const (
+	ChunkTypeChat        = biz.ChatChunk
+	ChunkTypeImage       = biz.ImageChunk
+	ChunkTypeNeedConfirm = biz.NeedConfirmChunk
+	ChunkTypeSetting     = biz.SettingChunk
+)
+
+const (
+	ReplyEventToken = "token"
+	ReplyEventVoice = "voice"
+	ReplyEventDone  = "done"
+	ReplyEventError = "error"
+)
+
 type CharacterService struct {
 	cfg          *configs.Config
 	character    *biz.CharacterUsecase
@@ -26,7 +49,18 @@ type CharacterService struct {
 	imageModel   *biz.ImageModelUsecase
 	conversation *biz.ConversationUsecase
 	voice        *biz.CharacterVoiceUsecase
-	imageCache   *cache.Cache
+	message      *biz.MessageUsecase
+	reply        *biz.ReplyUsecase
+	memory       *biz.MemoryUsecase
+	session      *biz.CreationSessionUsecase
+	revision     *biz.CharacterRevisionUsecase
+	search       *biz.CharacterSearchUsecase
+	tag          *biz.TagUsecase
+	trend        *biz.CharacterTrendUsecase
+	recommend    *biz.CharacterRecommendationUsecase
+	collection   *biz.CollectionUsecase
+	follow       *biz.FollowUsecase
+	inflight     *inflight
 }
 
 func NewCharacterService(cfg *configs.Config,
@@ -34,26 +68,62 @@ func NewCharacterService(cfg *configs.Config,
 	character *biz.CharacterUsecase,
 	ativity *biz.AccountAndActivitySerClientUsecase,
 	conversation *biz.ConversationUsecase,
-	voice *biz.CharacterVoiceUsecase) *CharacterService {
-	c := cache.New(30*time.Minute, 30*time.Minute)
+	voice *biz.CharacterVoiceUsecase,
+	message *biz.MessageUsecase,
+	reply *biz.ReplyUsecase,
+	memory *biz.MemoryUsecase,
+	session *biz.CreationSessionUsecase,
+	revision *biz.CharacterRevisionUsecase,
+	search *biz.CharacterSearchUsecase,
+	tag *biz.TagUsecase,
+	trend *biz.CharacterTrendUsecase,
+	recommend *biz.CharacterRecommendationUsecase,
+	collection *biz.CollectionUsecase,
+	follow *biz.FollowUsecase) *CharacterService {
 	s := &CharacterService{cfg: cfg,
 		character:    character,
 		imageModel:   model,
 		ativity:      ativity,
 		conversation: conversation,
 		voice:        voice,
-		imageCache:   c}
+		message:      message,
+		reply:        reply,
+		memory:       memory,
+		session:      session,
+		revision:     revision,
+		search:       search,
+		tag:          tag,
+		trend:        trend,
+		recommend:    recommend,
+		collection:   collection,
+		follow:       follow,
+		inflight:     newInflight(reply)}
 	go s.refreshCharacterTask()
+	go s.memoryTask()
+	go s.creationSessionTask()
+	go s.draftTask()
+	go s.searchIndexTask()
+	go s.trendingTask()
+	go s.recommendationTask()
+	go s.taxonomyTask()
 	return s
 }
 
 type CreateCharacterRequest struct {
 	AccountID string `json:"account_id"`
-	Message   string `json:"message"`   
-	SessionID string `json:"session_id"` 
+	Message   string `json:"message"`
+	SessionID string `json:"session_id"`
 	State     int    `json:"state"`
 	Is3D      bool   `json:"is_3d"`
-	ResCh     chan ChatCompletionStreamResponseChunk
+	// Visibility, Greeting and ExampleDialogues are set when the character
+	// is finished. Visibility is one of the biz visibilities, 0 meaning
+	// public.
+	Visibility       int      `json:"visibility"`
+	Greeting         string   `json:"greeting"`
+	ExampleDialogues []string `json:"example_dialogues"`
+	ResCh            chan ChatCompletionStreamResponseChunk
+	// StreamCtx bounds the agent stream of the stages that stream a reply.
+	StreamCtx context.Context `json:"-"`
 }
 
 type CreateCharacterResponse struct {
@@ -93,20 +163,46 @@ type ImageModelResponse struct {
 }
 
 type CharacterResponse struct {
-	ID        string `json:"id,omitempty"`
-	AccountID string `json:"account_id,omitempty"`
-	Name      string `json:"name,omitempty"`
-	Gender    int    `json:"gender,omitempty"`
-	Prompt    string `json:"prompt,omitempty"`
-	ImageURL  string `json:"image_url,omitempty"`
+	ID         string `json:"id,omitempty"`
+	AccountID  string `json:"account_id,omitempty"`
+	Name       string `json:"name,omitempty"`
+	Gender     int    `json:"gender,omitempty"`
+	Prompt     string `json:"prompt,omitempty"`
+	ImageURL   string `json:"image_url,omitempty"`
+	Visibility int    `json:"visibility,omitempty"`
 }
 
 type QueryCharacterRequest struct {
 	Search  string
 	Account string
-	Page    int
-	Limit   int
+	// Tag narrows the public listing to the characters carrying the tag.
+	Tag string
+	// Sort is "trending", "new" or "top", the listing keeping the characters
+	// of StarLand.AI first when it is empty.
+	Sort  string
+	Page  int
+	Limit int
 }
+
+// SearchCharactersRequest filters on the fields set, Is3D and Minted being
+// ignored when nil and Gender when 0. Sort is "relevance" or "popular".
+type SearchCharactersRequest struct {
+	AccountID string
+	Query     string
+	Gender    int
+	Is3D      *bool
+	Tag       string
+	Minted    *bool
+	Sort      string
+	Page      int
+	Limit     int
+}
+
+type RecommendCharactersRequest struct {
+	AccountID string
+	Limit     int
+}
+
 type QueryCharacterResponse struct {
 	ID          string   `json:"id"`
 	AccountID   string   `json:"account_id"`
@@ -127,12 +223,45 @@ type QueryCharacterResponse struct {
 	ObjURL      string   `json:"obj_url,omitempty"`
 	GlbURL      string   `json:"glb_url,omitempty"`
 	Voice       string   `json:"voice"`
+	Visibility  int      `json:"visibility"`
+
+	Greeting         string   `json:"greeting,omitempty"`
+	ExampleDialogues []string `json:"example_dialogues,omitempty"`
+
+	ForkCount  int              `json:"fork_count"`
+	ForkedFrom *ForkAttribution `json:"forked_from,omitempty"`
+
+	GenerationSettings *GenerationSettings `json:"generation_settings,omitempty"`
+}
+
+// GenerationSettings are the per-character generation parameters, unset
+// fields use the agent defaults.
+type GenerationSettings struct {
+	Temperature    *float32 `json:"temperature,omitempty"`
+	MaxHistory     *int32   `json:"max_history,omitempty"`
+	MaxReplyLength *int32   `json:"max_reply_length,omitempty"`
+	StopSequences  []string `json:"stop_sequences,omitempty"`
 }
 
 type Tag struct {
 	Key   string `json:"key"`
 	Value string `json:"value"`
 }
+
+type QueryTagsRequest struct {
+	Locale string
+}
+
+type TagCategoryResponse struct {
+	Slug string         `json:"slug"`
+	Name string         `json:"name"`
+	Tags []*TagResponse `json:"tags"`
+}
+
+type TagResponse struct {
+	Slug string `json:"slug"`
+	Name string `json:"name"`
+}
 type ChatRequest struct {
 	Message     string `json:"message"`
 	CharacterID string `json:"character_id"`
@@ -140,10 +269,14 @@ type ChatRequest struct {
 }
 
 type ChatRequestV2 struct {
-	Message     string `json:"message"`
-	CharacterID string `json:"character_id"`
-	AccountID   string `json:"account_id"`
-	ResCh       chan interface{}
+	Message         string `json:"message"`
+	CharacterID     string `json:"character_id"`
+	AccountID       string `json:"account_id"`
+	ConversationID  string `json:"conversation_id"`
+	Action          string `json:"action"`
+	MessageID       string `json:"message_id"`
+	ParentMessageID string `json:"parent_message_id"`
+	ReplyID         string `json:"reply_id"`
 }
 type ChatResponse struct {
 	Message string `json:"message"`
@@ -156,14 +289,16 @@ type QueryCharactersHistoryRequest struct {
 }
 
 type QueryCharactersHistoryResponse struct {
-	AccountName string    `json:"account_name"`
-	AvatarURL   string    `json:"avatar_url"`
-	Name        string    `json:"name"`
-	Gender      int       `json:"gender"`
-	ImageURL    string    `json:"image_url"`
-	IsMint      bool      `json:"is_mint"`
-	LatestTime  time.Time `json:"latest_time"`
-	CharacterID string    `json:"character_id"`
+	AccountName    string    `json:"account_name"`
+	AvatarURL      string    `json:"avatar_url"`
+	Name           string    `json:"name"`
+	Gender         int       `json:"gender"`
+	ImageURL       string    `json:"image_url"`
+	IsMint         bool      `json:"is_mint"`
+	LatestTime     time.Time `json:"latest_time"`
+	CharacterID    string    `json:"character_id"`
+	ConversationID string    `json:"conversation_id"`
+	Title          string    `json:"title"`
 }
 
 type CharacterMintRequest struct {
@@ -211,9 +346,473 @@ type UpdateCharacterRequest struct {
 	Name        string
 	Description string
 	Voice       string
+	Visibility  int
+	Settings    *GenerationSettings
+	// Greeting and ExampleDialogues are left as they are when nil.
+	Greeting         *string
+	ExampleDialogues []string
+}
+
+type CreateManualCharacterRequest struct {
+	ID           string
+	AccountID    string
+	Name         string
+	Gender       int
+	Description  string
+	Introduction string
+	Tags         map[string]string
+	Voice        string
+	Images       []string
+	Image        string
+	Is3D         bool
+	Visibility   int
+
+	Greeting         string
+	ExampleDialogues []string
+}
+
+type SaveChatMessageRequest struct {
+	ConversationID string
+	ParentID       string
+	AccountID      string
+	CharacterID    string
+	Role           string
+	Content        string
+	Voice          string
+	TokenCount     int
+	Truncated      bool
+}
+
+type QueryChatMessagesRequest struct {
+	CharacterID    string
+	AccountID      string
+	ConversationID string
+	Page           int
+	Limit          int
+}
+
+type ChatMessageResponse struct {
+	MessageID      string    `json:"message_id"`
+	ConversationID string    `json:"conversation_id"`
+	ParentID       string    `json:"parent_id"`
+	SiblingIDs     []string  `json:"sibling_ids"`
+	Role           string    `json:"role"`
+	Content        string    `json:"content"`
+	Voice          string    `json:"voice"`
+	TokenCount     int       `json:"token_count"`
+	Truncated      bool      `json:"truncated"`
+	CreateTime     time.Time `json:"create_time"`
+}
+
+type CreateConversationRequest struct {
+	AccountID   string
+	CharacterID string
+	Title       string
+}
+
+type QueryConversationsRequest struct {
+	AccountID   string
+	CharacterID string
+	Archived    bool
+	Page        int
+	Limit       int
+}
+
+type UpdateConversationRequest struct {
+	ID        string
+	AccountID string
+	Title     *string
+	Archived  *bool
+}
+
+type SwitchBranchRequest struct {
+	ConversationID string
+	AccountID      string
+	MessageID      string
+}
+
+type DeleteConversationRequest struct {
+	ID        string
+	AccountID string
+}
+
+type ConversationResponse struct {
+	ConversationID   string    `json:"conversation_id"`
+	CharacterID      string    `json:"character_id"`
+	Title            string    `json:"title"`
+	Archived         bool      `json:"archived"`
+	CharacterVersion int       `json:"character_version"`
+	CreateTime       time.Time `json:"create_time"`
+	LatestTime       time.Time `json:"latest_time"`
+}
+
+type ExportConversationRequest struct {
+	AccountID      string
+	ConversationID string
+	Format         string
+}
+
+type ExportConversationResponse struct {
+	ContentType string
+	FileName    string
+	Body        []byte
+}
+
+// ConversationExport is the JSON export of a conversation, which is also
+// what ImportConversation accepts.
+type ConversationExport struct {
+	Version        int              `json:"version"`
+	ConversationID string           `json:"conversation_id"`
+	Title          string           `json:"title"`
+	CharacterID    string           `json:"character_id"`
+	CharacterName  string           `json:"character_name"`
+	CreateTime     time.Time        `json:"create_time"`
+	ExportTime     time.Time        `json:"export_time"`
+	Messages       []*ExportMessage `json:"messages"`
+}
+
+type ExportMessage struct {
+	Role       string    `json:"role"`
+	Content    string    `json:"content"`
+	Voice      string    `json:"voice,omitempty"`
+	Truncated  bool      `json:"truncated,omitempty"`
+	CreateTime time.Time `json:"create_time"`
+}
+
+type ImportConversationRequest struct {
+	AccountID string
+	Export    *ConversationExport
+}
+
+type QueryRevisionsRequest struct {
+	AccountID   string
+	CharacterID string
+	Page        int
+	Limit       int
+}
+
+type RevisionRequest struct {
+	AccountID   string
+	CharacterID string
+	Version     int
+}
+
+type DiffRevisionsRequest struct {
+	AccountID   string
+	CharacterID string
+	Version     int
+	// Against is the version compared with, the previous one when 0.
+	Against int
+}
+
+type RevisionResponse struct {
+	Version          int                 `json:"version"`
+	Reason           string              `json:"reason"`
+	RollbackFrom     int                 `json:"rollback_from,omitempty"`
+	Name             string              `json:"name"`
+	Gender           int                 `json:"gender"`
+	Prompt           string              `json:"prompt"`
+	Introduction     string              `json:"introduction"`
+	ImageURL         string              `json:"image_url"`
+	ImageURLs        []string            `json:"image_urls"`
+	Voice            string              `json:"voice"`
+	Tags             []Tag               `json:"tags"`
+	Is3D             bool                `json:"is_3d"`
+	Greeting         string              `json:"greeting"`
+	ExampleDialogues []string            `json:"example_dialogues"`
+	Settings         *GenerationSettings `json:"settings,omitempty"`
+	CreateTime       time.Time           `json:"create_time"`
+}
+
+type RevisionDiffResponse struct {
+	Version int               `json:"version"`
+	Against int               `json:"against"`
+	Changes []*RevisionChange `json:"changes"`
+}
+
+// RevisionChange is a field that differs between two revisions, From holding
+// its value in the older one.
+type RevisionChange struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from"`
+	To    interface{} `json:"to"`
+}
+
+type ForkCharacterRequest struct {
+	AccountID   string
+	CharacterID string
+}
+
+// ForkAttribution names the character a fork was copied from.
+type ForkAttribution struct {
+	ID          string `json:"id"`
+	Name        string `json:"name,omitempty"`
+	AccountID   string `json:"account_id,omitempty"`
+	AccountName string `json:"account_name,omitempty"`
+}
+
+type ExportCharacterCardRequest struct {
+	CharacterID string
+	Format      string
+}
+
+type ExportCharacterCardResponse struct {
+	ContentType string
+	FileName    string
+	Body        []byte
+}
+
+// CharacterCard is a community character card of the chara_card_v2 spec,
+// the format of both the JSON export and the chunk embedded in PNG cards.
+type CharacterCard struct {
+	Spec        string             `json:"spec"`
+	SpecVersion string             `json:"spec_version"`
+	Data        *CharacterCardData `json:"data"`
+}
+
+type CharacterCardData struct {
+	Name         string                  `json:"name"`
+	Description  string                  `json:"description"`
+	Personality  string                  `json:"personality"`
+	Scenario     string                  `json:"scenario"`
+	FirstMes     string                  `json:"first_mes"`
+	MesExample   string                  `json:"mes_example"`
+	CreatorNotes string                  `json:"creator_notes"`
+	Tags         []string                `json:"tags"`
+	Creator      string                  `json:"creator"`
+	Extensions   CharacterCardExtensions `json:"extensions"`
+}
+
+type CharacterCardExtensions struct {
+	Starland *CharacterCardStarland `json:"starland,omitempty"`
+}
+
+// CharacterCardStarland keeps the fields of a character that the card spec
+// has no place for.
+type CharacterCardStarland struct {
+	Gender int    `json:"gender"`
+	Voice  string `json:"voice,omitempty"`
+	Is3D   bool   `json:"is_3d,omitempty"`
+}
+
+type ImportCharacterCardRequest struct {
+	ID        string
+	AccountID string
+	Card      []byte
+	Image     string
+}
+
+type QueryCreationSessionRequest struct {
+	AccountID string
+	SessionID string
+}
+
+type CreationSessionResponse struct {
+	SessionID  string                   `json:"session_id"`
+	Stage      int                      `json:"stage"`
+	NextStages []int                    `json:"next_stages"`
+	Settings   *CreationSettingResponse `json:"settings,omitempty"`
+	Images     []string                 `json:"images"`
+	Voice      string                   `json:"voice"`
+	Is3D       bool                     `json:"is_3d"`
+	CreateTime time.Time                `json:"create_time"`
+	UpdateTime time.Time                `json:"update_time"`
+}
+
+type CreationSettingResponse struct {
+	Name         string `json:"name"`
+	Gender       int    `json:"gender"`
+	Introduction string `json:"introduction"`
+	Tags         []Tag  `json:"tags"`
+}
+
+type QueryDraftsRequest struct {
+	AccountID string
+	Page      int
+	Limit     int
+}
+
+type DraftRequest struct {
+	ID        string
+	AccountID string
+}
+
+type DraftResponse struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"name"`
+	Gender       int       `json:"gender"`
+	Introduction string    `json:"introduction"`
+	Tags         []Tag     `json:"tags"`
+	Voice        string    `json:"voice"`
+	Is3D         bool      `json:"is_3d"`
+	UpdateTime   time.Time `json:"update_time"`
+}
+
+type QueryMemoriesRequest struct {
+	AccountID   string
+	CharacterID string
+}
+
+type DeleteMemoryRequest struct {
+	AccountID   string
+	CharacterID string
+	MemoryID    string
+}
+
+type DeleteMemoriesRequest struct {
+	AccountID   string
+	CharacterID string
+}
+
+type MemoryResponse struct {
+	MemoryID       string    `json:"memory_id"`
+	ConversationID string    `json:"conversation_id"`
+	Content        string    `json:"content"`
+	CreateTime     time.Time `json:"create_time"`
 }
 
 type DeleteCharacterRequest struct {
 	ID        string
 	AccountID string
 }
+
+type StreamReplyRequest struct {
+	AccountID      string
+	ConversationID string
+	ReplyID        string
+	LastEventID    string
+	ResCh          chan *ReplyEvent
+}
+
+type ReplyEvent struct {
+	ID    string
+	Event string
+	Data  json.RawMessage
+}
+
+type ReplyTokenData struct {
+	Content string `json:"content"`
+}
+
+type ReplyVoiceData struct {
+	Voice string `json:"voice"`
+}
+
+type ReplyDoneData struct {
+	ChatMessage    string `json:"chat_message"`
+	Voice          string `json:"voice"`
+	ConversationID string `json:"conversation_id"`
+	ParentID       string `json:"parent_id"`
+	Truncated      bool   `json:"truncated"`
+}
+
+type CancelReplyRequest struct {
+	AccountID      string
+	ConversationID string
+	ReplyID        string
+}
+
+type CancelSessionRequest struct {
+	AccountID string
+	SessionID string
+}
+
+type QueryLikedCharactersRequest struct {
+	AccountID string
+	Page      int
+	Limit     int
+}
+
+type CreateCollectionRequest struct {
+	AccountID   string
+	Name        string
+	Description string
+	// Visibility is VisibilityPublic or VisibilityPrivate, 0 meaning
+	// public.
+	Visibility int
+}
+
+// QueryCollectionsRequest lists the collections of Owner, only the public
+// ones unless Owner is the account asking. Owner is the account when empty.
+type QueryCollectionsRequest struct {
+	AccountID string
+	Owner     string
+	Page      int
+	Limit     int
+}
+
+type CollectionRequest struct {
+	AccountID    string
+	CollectionID string
+}
+
+// UpdateCollectionRequest changes the fields that are not nil.
+type UpdateCollectionRequest struct {
+	AccountID    string
+	CollectionID string
+	Name         *string
+	Description  *string
+	Visibility   *int
+}
+
+type QueryCollectionCharactersRequest struct {
+	AccountID    string
+	CollectionID string
+	Page         int
+	Limit        int
+}
+
+type CollectionCharacterRequest struct {
+	AccountID    string
+	CollectionID string
+	CharacterID  string
+}
+
+type SortCollectionRequest struct {
+	AccountID    string
+	CollectionID string
+	CharacterIDs []string
+}
+
+type CollectionResponse struct {
+	CollectionID   string    `json:"collection_id"`
+	AccountID      string    `json:"account_id"`
+	Name           string    `json:"name"`
+	Description    string    `json:"description"`
+	Visibility     int       `json:"visibility"`
+	CharacterCount int       `json:"character_count"`
+	CreateTime     time.Time `json:"create_time"`
+	UpdateTime     time.Time `json:"update_time"`
+}
+
+type CreatorRequest struct {
+	AccountID string
+	CreatorID string
+}
+
+type QueryCreatorCharactersRequest struct {
+	AccountID string
+	CreatorID string
+	Page      int
+	Limit     int
+}
+
+type QueryFollowingFeedRequest struct {
+	AccountID string
+	Page      int
+	Limit     int
+}
+
+// CreatorProfileResponse is the public profile of a creator, the counts
+// covering their public characters only.
+type CreatorProfileResponse struct {
+	AccountID      string `json:"account_id"`
+	Name           string `json:"name"`
+	AvatarURL      string `json:"avatar_url"`
+	CharacterCount int64  `json:"character_count"`
+	LikeCount      int64  `json:"like_count"`
+	ChatCount      int64  `json:"chat_count"`
+	FollowerCount  int64  `json:"follower_count"`
+	FollowingCount int64  `json:"following_count"`
+	IsFollowing    bool   `json:"is_following"`
+}
@@ -0,0 +1,173 @@
+package character
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"starland-backend/internal/biz"
+	"starland-backend/internal/pkg/bizerr"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	creationSessionPurgeInterval = 10 * time.Minute
+	creationSessionPurgeBatch    = 100
+)
+
+// QueryCreationSession returns where a creation wizard stands, so the client
+// can resume it after a reload.
+func (s *CharacterService) QueryCreationSession(ctx context.Context, req *QueryCreationSessionRequest) (*CreationSessionResponse, error) {
+	sess, err := s.loadCreationSession(ctx, req.SessionID, req.AccountID)
+	if err != nil {
+		return nil, fmt.Errorf("QueryCreationSession: [SessionId: %s] err: %w", req.SessionID, err)
+	}
+
+	res := &CreationSessionResponse{
+		SessionID:  sess.SessionID,
+		Stage:      sess.Stage,
+		NextStages: sess.NextStages(),
+		Images:     sess.Images,
+		Voice:      sess.Voice,
+		Is3D:       sess.Is3D,
+		CreateTime: sess.CreateTime,
+		UpdateTime: sess.UpdateTime,
+	}
+	if res.Images == nil {
+		res.Images = []string{}
+	}
+	if sess.Stage >= Stage2 {
+		ch, err := s.character.QueryCharacterByID(ctx, sess.SessionID)
+		if err != nil && !errors.Is(err, bizerr.ErrCharacterNotExist) {
+			return nil, fmt.Errorf("QueryCreationSession: [SessionId: %s] query character err: %w", req.SessionID, err)
+		}
+		if ch != nil {
+			res.Settings = &CreationSettingResponse{
+				Name:         ch.Name,
+				Gender:       ch.Gender,
+				Introduction: ch.Introduction,
+				Tags:         makeTags(ch.Tag),
+			}
+		}
+	}
+	return res, nil
+}
+
+func (s *CharacterService) newCreationSession(ctx context.Context, sessionID, accountID string) (*biz.CreationSession, error) {
+	sess := biz.NewCreationSession(sessionID, accountID)
+	if err := s.session.CreateSession(ctx, sess); err != nil {
+		return nil, err
+	}
+	return sess, nil
+}
+
+// loadCreationSession returns the session of the account, changes to it are
+// kept by saveCreationSession.
+func (s *CharacterService) loadCreationSession(ctx context.Context, sessionID, accountID string) (*biz.CreationSession, error) {
+	sess, err := s.session.QuerySession(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if sess.AccountID != accountID {
+		return nil, bizerr.ErrNoPermissionToModify
+	}
+	return sess, nil
+}
+
+// saveCreationSession stores the session, a failure is only logged since the
+// wizard step it records has already been taken.
+func (s *CharacterService) saveCreationSession(ctx context.Context, sess *biz.CreationSession) {
+	if err := s.session.SaveSession(ctx, sess); err != nil {
+		zap.S().Errorf("saveCreationSession: [SessionId: %s] err: %v", sess.SessionID, err)
+	}
+}
+
+// creationSessionTask purges the sessions abandoned for longer than
+// biz.CreationSessionExpiration together with the candidate images nobody
+// picked. Every instance runs it, removing a file twice is harmless.
+func (s *CharacterService) creationSessionTask() {
+	defer func() {
+		if p := recover(); p != nil {
+			zap.S().Errorf("creationSessionTask: recover err: %v", p)
+		}
+		s.creationSessionTask()
+	}()
+
+	t := time.NewTicker(creationSessionPurgeInterval)
+	for range t.C {
+		ctx := context.Background()
+		for {
+			sessions, err := s.session.QueryExpiredSessions(ctx, creationSessionPurgeBatch)
+			if err != nil {
+				zap.S().Errorf("creationSessionTask: query sessions err: %v", err)
+				break
+			}
+			for i := range sessions {
+				s.purgeCreationSession(ctx, sessions[i])
+			}
+			if len(sessions) < creationSessionPurgeBatch {
+				break
+			}
+		}
+	}
+}
+
+// purgeCreationSession removes an expired session. A finished session has
+// already dropped its candidates when the image was picked.
+func (s *CharacterService) purgeCreationSession(ctx context.Context, sess *biz.CreationSession) {
+	s.removeSessionImages(sess, "")
+	if err := s.session.DeleteSession(ctx, sess.SessionID); err != nil {
+		zap.S().Errorf("purgeCreationSession: [SessionId: %s] err: %v", sess.SessionID, err)
+	}
+}
+
+// removeSessionImages deletes the candidate images of the session that are
+// not part of picked.
+func (s *CharacterService) removeSessionImages(sess *biz.CreationSession, picked string) {
+	for i := range sess.Images {
+		if picked != "" && strings.Contains(picked, sess.Images[i]) {
+			continue
+		}
+		path, ok := s.imageFilePath(sess.Images[i])
+		if !ok {
+			continue
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			zap.S().Errorf("removeSessionImages: [SessionId: %s] err: %v", sess.SessionID, err)
+		}
+	}
+}
+
+// checkCreationStage validates the request against the stage it asks for.
+func checkCreationStage(sess *biz.CreationSession, req *CreateCharacterRequest) error {
+	if err := sess.CheckStage(req.State); err != nil {
+		return err
+	}
+	switch req.State {
+	case Stage1, Stage4:
+		if strings.TrimSpace(req.Message) == "" {
+			return bizerr.ErrBadRequest.Wrap(fmt.Errorf("message is empty"))
+		}
+	case Stage3:
+		if req.Message == "" {
+			return bizerr.ErrBadRequest.Wrap(fmt.Errorf("voice is empty"))
+		}
+	case Stage5:
+		if err := checkVisibility(req.Visibility); err != nil {
+			return err
+		}
+		if err := checkDialogues(req.Greeting, req.ExampleDialogues); err != nil {
+			return err
+		}
+		for i := range sess.Images {
+			if strings.Contains(req.Message, sess.Images[i]) {
+				return nil
+			}
+		}
+		return bizerr.ErrBadRequest.Wrap(fmt.Errorf("image is not one of the session candidates"))
+	}
+	return nil
+}
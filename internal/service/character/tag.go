@@ -0,0 +1,83 @@
+package character
+
+import (
+	"context"
+	"fmt"
+	"starland-backend/internal/biz"
+
+	"go.uber.org/zap"
+)
+
+// QueryTags returns the tag categories with their tags, named in the locale
+// of the request. Tags without a category, as made up by the agent, are left
+// out until they are curated.
+func (s *CharacterService) QueryTags(ctx context.Context, req *QueryTagsRequest) ([]*TagCategoryResponse, error) {
+	locale := req.Locale
+	if locale == "" {
+		locale = biz.DefaultTagLocale
+	}
+	categories, tags, err := s.tag.QueryTaxonomy(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("QueryTags: %w", err)
+	}
+
+	res := make([]*TagCategoryResponse, len(categories))
+	bySlug := make(map[string]*TagCategoryResponse, len(categories))
+	for i := range categories {
+		res[i] = &TagCategoryResponse{
+			Slug: categories[i].Slug,
+			Name: categories[i].Name(locale),
+			Tags: make([]*TagResponse, 0),
+		}
+		bySlug[categories[i].Slug] = res[i]
+	}
+	for i := range tags {
+		category, ok := bySlug[tags[i].Category]
+		if !ok {
+			continue
+		}
+		category.Tags = append(category.Tags, &TagResponse{
+			Slug: tags[i].Slug,
+			Name: tags[i].Name(locale),
+		})
+	}
+	return res, nil
+}
+
+// normalizeTags maps the tags onto the taxonomy. The tags are kept as they
+// are when that fails, rather than failing the creation over them.
+func (s *CharacterService) normalizeTags(ctx context.Context, tags map[string]string) map[string]string {
+	res, err := s.tag.NormalizeTags(ctx, tags)
+	if err != nil {
+		zap.S().Errorf("normalizeTags: %v", err)
+		return tags
+	}
+	return res
+}
+
+// resolveTag turns a tag filter into the slug of its canonical tag.
+func (s *CharacterService) resolveTag(ctx context.Context, tag string) (string, error) {
+	if tag == "" {
+		return "", nil
+	}
+	return s.tag.ResolveTag(ctx, tag)
+}
+
+// taxonomyTask writes the curated taxonomy on start, then maps the tags of
+// the characters saved before it onto it.
+func (s *CharacterService) taxonomyTask() {
+	defer func() {
+		if p := recover(); p != nil {
+			zap.S().Errorf("taxonomyTask: recover err: %v", p)
+		}
+	}()
+
+	ctx := context.Background()
+	if err := s.tag.SeedTaxonomy(ctx); err != nil {
+		zap.S().Errorf("taxonomyTask: %v", err)
+		return
+	}
+	if err := s.tag.BackfillCharacterTags(ctx); err != nil {
+		zap.S().Errorf("taxonomyTask: %v", err)
+	}
+}
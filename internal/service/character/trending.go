@@ -0,0 +1,34 @@
+package character
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const defaultTrendingInterval = 15 * time.Minute
+
+// trendingTask recomputes the trending scores of the characters, on start
+// and then every configured interval. The instances take turns through a
+// lease lasting two intervals, so another one takes over when it lapses.
+func (s *CharacterService) trendingTask() {
+	defer func() {
+		if p := recover(); p != nil {
+			zap.S().Errorf("trendingTask: recover err: %v", p)
+		}
+		s.trendingTask()
+	}()
+
+	interval := defaultTrendingInterval
+	if s.cfg.Trending != nil && s.cfg.Trending.Interval > 0 {
+		interval = s.cfg.Trending.Interval
+	}
+	t := time.NewTicker(interval)
+	for {
+		if err := s.trend.RankCharacters(context.Background(), 2*interval); err != nil {
+			zap.S().Errorf("trendingTask: %v", err)
+		}
+		<-t.C
+	}
+}